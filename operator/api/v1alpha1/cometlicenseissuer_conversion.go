@@ -0,0 +1,57 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/cometbackup/comet-server-operator/api/v1beta1"
+)
+
+var _ conversion.Convertible = &CometLicenseIssuer{}
+
+// ConvertTo converts this CometLicenseIssuer to the Hub version (v1beta1).
+func (src *CometLicenseIssuer) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.CometLicenseIssuer)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1.CometLicenseIssuer but got a %T", dstRaw)
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Auth.Email = src.Spec.Auth.Email
+	dst.Spec.Auth.Token = src.Spec.Auth.Token
+	dst.Spec.Auth.TokenSecretRef = src.Spec.Auth.TokenSecretRef.DeepCopy()
+	dst.Spec.Features = convertLicenseFeaturesTo(src.Spec.Features)
+	dst.Spec.MaxServers = src.Spec.MaxServers
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *CometLicenseIssuer) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.CometLicenseIssuer)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1.CometLicenseIssuer but got a %T", srcRaw)
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Auth.Email = src.Spec.Auth.Email
+	dst.Spec.Auth.Token = src.Spec.Auth.Token
+	dst.Spec.Auth.TokenSecretRef = src.Spec.Auth.TokenSecretRef.DeepCopy()
+	dst.Spec.Features = convertLicenseFeaturesFrom(src.Spec.Features)
+	dst.Spec.MaxServers = src.Spec.MaxServers
+	return nil
+}
@@ -17,18 +17,30 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// CometLicenseFeatures maps account.cometbackup.com license feature names to their value, a
+// count or 0/1 for flags. Names are not checked - v1beta1 has a typed schema of the known features.
 type CometLicenseFeatures map[string]int
 
 // CometLicenseIssuerAuth defines the API authentication for account.cometbackup.com
 type CometLicenseIssuerAuth struct {
 	Email string `json:"email,omitempty"`
 	Token string `json:"token,omitempty"`
+
+	// TokenSecretRef selects the Secret key holding the API token, in place of Token.
+	// +optional
+	TokenSecretRef *corev1.SecretKeySelector `json:"tokenSecretRef,omitempty"`
 }
 
 // CometLicenseIssuerSpec defines the desired state of CometLicenseIssuer
@@ -38,6 +50,12 @@ type CometLicenseIssuerSpec struct {
 
 	Auth     CometLicenseIssuerAuth `json:"auth,omitempty"`
 	Features CometLicenseFeatures   `json:"features,omitempty"`
+
+	// MaxServers caps the number of CometServers holding a serial number issued by this issuer.
+	// Unlimited if zero.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxServers int `json:"maxServers,omitempty"`
 }
 
 // CometLicenseIssuerStatus defines the observed state of CometLicenseIssuer
@@ -58,6 +76,23 @@ type CometLicenseIssuer struct {
 	Status CometLicenseIssuerStatus `json:"status,omitempty"`
 }
 
+// AuthToken returns the API token, reading it from the Secret if TokenSecretRef is set.
+func (r *CometLicenseIssuer) AuthToken(ctx context.Context, c client.Reader) (string, error) {
+	ref := r.Spec.Auth.TokenSecretRef
+	if ref == nil {
+		return r.Spec.Auth.Token, nil
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: r.Namespace}, secret); err != nil {
+		return "", err
+	}
+	token, ok := secret.Data[ref.Key]
+	if !ok || len(token) == 0 {
+		return "", fmt.Errorf("secret %s has no %q key", ref.Name, ref.Key)
+	}
+	return string(token), nil
+}
+
 //+kubebuilder:object:root=true
 
 // CometLicenseIssuerList contains a list of CometLicenseIssuer
@@ -0,0 +1,93 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net/mail"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var cometlicenseissuerlog = logf.Log.WithName("cometlicenseissuer-resource")
+
+func (r *CometLicenseIssuer) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-cometd-cometbackup-com-v1alpha1-cometlicenseissuer,mutating=false,failurePolicy=fail,sideEffects=None,groups=cometd.cometbackup.com,resources=cometlicenseissuers,verbs=create;update,versions=v1alpha1,name=vcometlicenseissuer.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &CometLicenseIssuer{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *CometLicenseIssuer) ValidateCreate() error {
+	cometlicenseissuerlog.Info("validate create", "name", r.Name)
+
+	return r.validateCometLicenseIssuer()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *CometLicenseIssuer) ValidateUpdate(old runtime.Object) error {
+	cometlicenseissuerlog.Info("validate update", "name", r.Name)
+
+	return r.validateCometLicenseIssuer()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *CometLicenseIssuer) ValidateDelete() error {
+	return nil
+}
+
+func (r *CometLicenseIssuer) validateCometLicenseIssuer() error {
+	var allErrs field.ErrorList
+	auth := field.NewPath("spec", "auth")
+
+	if r.Spec.Auth.Email == "" {
+		allErrs = append(allErrs, field.Required(auth.Child("email"), "the email address of the account.cometbackup.com account"))
+	} else if _, err := mail.ParseAddress(r.Spec.Auth.Email); err != nil {
+		allErrs = append(allErrs, field.Invalid(auth.Child("email"), r.Spec.Auth.Email, "must be an email address"))
+	}
+	if ref := r.Spec.Auth.TokenSecretRef; ref != nil {
+		if r.Spec.Auth.Token != "" {
+			allErrs = append(allErrs, field.Forbidden(auth.Child("token"), "may not be set with tokenSecretRef"))
+		}
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(auth.Child("tokenSecretRef", "name"), "the name of the Secret holding the API token"))
+		}
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(auth.Child("tokenSecretRef", "key"), "the Secret key holding the API token"))
+		}
+	} else if r.Spec.Auth.Token == "" {
+		allErrs = append(allErrs, field.Required(auth.Child("token"), "an API token of the account.cometbackup.com account, or a tokenSecretRef"))
+	}
+	if r.Spec.MaxServers < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "maxServers"), r.Spec.MaxServers, "must not be negative"))
+	}
+	allErrs = append(allErrs, validateLicenseFeatures(field.NewPath("spec", "features"), r.Spec.Features)...)
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("CometLicenseIssuer").GroupKind(), r.Name, allErrs)
+}
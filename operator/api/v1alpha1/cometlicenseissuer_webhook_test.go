@@ -0,0 +1,81 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+var _ = Describe("CometLicenseIssuer webhook", func() {
+	var issuer *cometdv1alpha1.CometLicenseIssuer
+
+	BeforeEach(func() {
+		issuer = &cometdv1alpha1.CometLicenseIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"},
+			Spec: cometdv1alpha1.CometLicenseIssuerSpec{
+				Auth: cometdv1alpha1.CometLicenseIssuerAuth{Email: "admin@example.com", Token: "token"},
+			},
+		}
+	})
+
+	It("accepts a valid CometLicenseIssuer", func() {
+		Expect(issuer.ValidateCreate()).To(Succeed())
+	})
+
+	It("accepts a token from a Secret", func() {
+		issuer.Spec.Auth.Token = ""
+		issuer.Spec.Auth.TokenSecretRef = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "issuer-credentials"},
+			Key:                  "token",
+		}
+		Expect(issuer.ValidateCreate()).To(Succeed())
+	})
+
+	DescribeTable("rejects an invalid spec",
+		func(mutate func(issuer *cometdv1alpha1.CometLicenseIssuer), field string) {
+			mutate(issuer)
+			err := issuer.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring(field))
+		},
+		Entry("missing email", func(issuer *cometdv1alpha1.CometLicenseIssuer) { issuer.Spec.Auth.Email = "" }, "spec.auth.email"),
+		Entry("invalid email", func(issuer *cometdv1alpha1.CometLicenseIssuer) { issuer.Spec.Auth.Email = "admin" }, "spec.auth.email"),
+		Entry("missing token", func(issuer *cometdv1alpha1.CometLicenseIssuer) { issuer.Spec.Auth.Token = "" }, "spec.auth.token"),
+		Entry("token and tokenSecretRef", func(issuer *cometdv1alpha1.CometLicenseIssuer) {
+			issuer.Spec.Auth.TokenSecretRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "issuer-credentials"},
+				Key:                  "token",
+			}
+		}, "spec.auth.token"),
+		Entry("tokenSecretRef without a key", func(issuer *cometdv1alpha1.CometLicenseIssuer) {
+			issuer.Spec.Auth.Token = ""
+			issuer.Spec.Auth.TokenSecretRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "issuer-credentials"},
+			}
+		}, "spec.auth.tokenSecretRef.key"),
+		Entry("negative max servers", func(issuer *cometdv1alpha1.CometLicenseIssuer) { issuer.Spec.MaxServers = -1 }, "spec.maxServers"),
+		Entry("negative feature count", func(issuer *cometdv1alpha1.CometLicenseIssuer) {
+			issuer.Spec.Features = cometdv1alpha1.CometLicenseFeatures{"booster": -5}
+		}, "spec.features[booster]"),
+	)
+})
@@ -0,0 +1,82 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CometOperatorConfigName is the name of the CometOperatorConfig read by the operator. Any
+// other CometOperatorConfig is ignored.
+const CometOperatorConfigName = "cluster"
+
+// CometServerDefaults are filled in on new CometServers which leave the fields unset.
+type CometServerDefaults struct {
+	// Version of the Comet Server. Defaults to the latest version known to the operator.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Issuer is the name of the CometLicenseIssuer, in the CometServer's namespace.
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+
+	// IngressHost is the domain CometServers are served under, as <name>.<host>.
+	// +optional
+	IngressHost string `json:"ingressHost,omitempty"`
+
+	// StorageSize of the data volume. Defaults to 8Gi.
+	// +optional
+	StorageSize *resource.Quantity `json:"storageSize,omitempty"`
+
+	// Resources of the Comet Server container.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// CometOperatorConfigSpec defines the desired state of CometOperatorConfig
+type CometOperatorConfigSpec struct {
+	// CometServer defaults, applied when a CometServer is created.
+	// +optional
+	CometServer CometServerDefaults `json:"cometServer,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// CometOperatorConfig is the Schema for the cometoperatorconfigs API. The operator only reads
+// the CometOperatorConfig named "cluster".
+type CometOperatorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CometOperatorConfigSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CometOperatorConfigList contains a list of CometOperatorConfig
+type CometOperatorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CometOperatorConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CometOperatorConfig{}, &CometOperatorConfigList{})
+}
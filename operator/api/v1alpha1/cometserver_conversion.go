@@ -0,0 +1,181 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/cometbackup/comet-server-operator/api/v1beta1"
+)
+
+var _ conversion.Convertible = &CometServer{}
+
+// ConvertTo converts this CometServer to the Hub version (v1beta1).
+func (src *CometServer) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.CometServer)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1.CometServer but got a %T", dstRaw)
+	}
+	dst.ObjectMeta = src.ObjectMeta
+
+	// Spec
+	dst.Spec.Version = src.Spec.Version
+	dst.Spec.License.IssuerRef = corev1.LocalObjectReference{Name: src.Spec.License.Issuer}
+	dst.Spec.License.Features = convertLicenseFeaturesTo(src.Spec.License.Features)
+	dst.Spec.Ingress.Host = src.Spec.Ingress.Host
+	dst.Spec.Admin.SecretRef = src.Spec.Admin.SecretRef
+	dst.Spec.Config = nil
+	if src.Spec.Config != nil {
+		dst.Spec.Config = &v1beta1.CometServerConfig{
+			ConfigMapKeyRef: src.Spec.Config.ConfigMapKeyRef,
+			SecretKeyRef:    src.Spec.Config.SecretKeyRef,
+			Inline:          src.Spec.Config.Inline,
+		}
+	}
+	dst.Spec.RestoreFrom = nil
+	if restore := src.Spec.RestoreFrom; restore != nil {
+		dst.Spec.RestoreFrom = &v1beta1.CometServerRestore{
+			BackupRef:         toLocalObjectReference(restore.BackupRef),
+			VolumeSnapshotRef: toLocalObjectReference(restore.VolumeSnapshotRef),
+			SerialNumber:      restore.SerialNumber,
+		}
+		if s3 := restore.S3; s3 != nil {
+			dst.Spec.RestoreFrom.S3 = &v1beta1.CometServerRestoreS3Source{
+				Endpoint:             s3.Endpoint,
+				Region:               s3.Region,
+				Bucket:               s3.Bucket,
+				Key:                  s3.Key,
+				CredentialsSecretRef: s3.CredentialsSecretRef,
+			}
+		}
+	}
+	dst.Spec.CloneFrom = nil
+	if clone := src.Spec.CloneFrom; clone != nil {
+		dst.Spec.CloneFrom = &v1beta1.CometServerClone{
+			ServerRef:               corev1.LocalObjectReference{Name: clone.ServerRef},
+			VolumeSnapshotClassName: clone.VolumeSnapshotClassName,
+			DisableOutbound:         clone.DisableOutbound,
+		}
+	}
+	dst.Spec.Storage = v1beta1.CometServerStorage{
+		Size:                    src.Spec.Storage.Size,
+		DeletionPolicy:          v1beta1.CometServerDeletionPolicy(src.Spec.Storage.DeletionPolicy),
+		VolumeSnapshotClassName: src.Spec.Storage.VolumeSnapshotClassName,
+	}
+	dst.Spec.DeletionProtection = src.Spec.DeletionProtection
+	dst.Spec.Suspend = src.Spec.Suspend
+	dst.Spec.LogFiles = src.Spec.LogFiles
+	dst.Spec.Resources = src.Spec.Resources
+
+	// Status
+	dst.Status.ConfigHash = src.Status.ConfigHash
+	dst.Status.Conditions = src.Status.Conditions
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *CometServer) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.CometServer)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1.CometServer but got a %T", srcRaw)
+	}
+	dst.ObjectMeta = src.ObjectMeta
+
+	// Spec
+	dst.Spec.Version = src.Spec.Version
+	dst.Spec.License.Issuer = src.Spec.License.IssuerRef.Name
+	dst.Spec.License.Features = convertLicenseFeaturesFrom(src.Spec.License.Features)
+	dst.Spec.Ingress.Host = src.Spec.Ingress.Host
+	dst.Spec.Admin.SecretRef = src.Spec.Admin.SecretRef
+	dst.Spec.Config = nil
+	if src.Spec.Config != nil {
+		dst.Spec.Config = &CometServerConfig{
+			ConfigMapKeyRef: src.Spec.Config.ConfigMapKeyRef,
+			SecretKeyRef:    src.Spec.Config.SecretKeyRef,
+			Inline:          src.Spec.Config.Inline,
+		}
+	}
+	dst.Spec.RestoreFrom = nil
+	if restore := src.Spec.RestoreFrom; restore != nil {
+		dst.Spec.RestoreFrom = &CometServerRestore{
+			BackupRef:         fromLocalObjectReference(restore.BackupRef),
+			VolumeSnapshotRef: fromLocalObjectReference(restore.VolumeSnapshotRef),
+			SerialNumber:      restore.SerialNumber,
+		}
+		if s3 := restore.S3; s3 != nil {
+			dst.Spec.RestoreFrom.S3 = &CometServerRestoreS3Source{
+				Endpoint:             s3.Endpoint,
+				Region:               s3.Region,
+				Bucket:               s3.Bucket,
+				Key:                  s3.Key,
+				CredentialsSecretRef: s3.CredentialsSecretRef,
+			}
+		}
+	}
+	dst.Spec.CloneFrom = nil
+	if clone := src.Spec.CloneFrom; clone != nil {
+		dst.Spec.CloneFrom = &CometServerClone{
+			ServerRef:               clone.ServerRef.Name,
+			VolumeSnapshotClassName: clone.VolumeSnapshotClassName,
+			DisableOutbound:         clone.DisableOutbound,
+		}
+	}
+	dst.Spec.Storage = CometServerStorage{
+		Size:                    src.Spec.Storage.Size,
+		DeletionPolicy:          CometServerDeletionPolicy(src.Spec.Storage.DeletionPolicy),
+		VolumeSnapshotClassName: src.Spec.Storage.VolumeSnapshotClassName,
+	}
+	dst.Spec.DeletionProtection = src.Spec.DeletionProtection
+	dst.Spec.Suspend = src.Spec.Suspend
+	dst.Spec.LogFiles = src.Spec.LogFiles
+	dst.Spec.Resources = src.Spec.Resources
+
+	// Status
+	dst.Status.ConfigHash = src.Status.ConfigHash
+	dst.Status.Conditions = src.Status.Conditions
+
+	return nil
+}
+
+// toLocalObjectReference converts a v1alpha1 name reference, where empty means unset.
+func toLocalObjectReference(name string) *corev1.LocalObjectReference {
+	if name == "" {
+		return nil
+	}
+	return &corev1.LocalObjectReference{Name: name}
+}
+
+func fromLocalObjectReference(ref *corev1.LocalObjectReference) string {
+	if ref == nil {
+		return ""
+	}
+	return ref.Name
+}
+
+func convertLicenseFeaturesTo(features CometLicenseFeatures) v1beta1.CometLicenseFeatures {
+	out := v1beta1.CometLicenseFeatures{}
+	out.FromMap(features)
+	return out
+}
+
+func convertLicenseFeaturesFrom(features v1beta1.CometLicenseFeatures) CometLicenseFeatures {
+	return features.ToMap()
+}
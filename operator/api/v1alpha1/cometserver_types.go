@@ -19,7 +19,18 @@ package v1alpha1
 import (
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// CometServerContainer is the name of the Comet Server container of a CometServer's pods.
+	CometServerContainer = "cometd"
+	// CometServerLogsContainer is the name of the sidecar which follows the Comet Server's log
+	// files, so that they can be read as container logs. Only run with spec.logFiles.
+	CometServerLogsContainer = "cometd-logs"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -34,6 +45,130 @@ type CometServerIngress struct {
 	Host string `json:"host,omitempty"`
 }
 
+// CometServerAdmin defines the administrator account used by the operator.
+type CometServerAdmin struct {
+	// SecretRef names a Secret with `username` and `password` keys to use as the admin
+	// credentials. If unset, a password is generated for the "admin" user. Changes to the
+	// Secret are applied to the running Comet Server through the admin API.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// CometServerConfig defines the Comet Server configuration (cometd.cfg). When set, the
+// operator owns the configuration file and overwrites it before every start up. Declared
+// settings changed on the running Comet Server are reverted through the admin API.
+type CometServerConfig struct {
+	// ConfigMapKeyRef selects a ConfigMap key containing a cometd.cfg JSON document.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a Secret key containing a cometd.cfg JSON document.
+	// Use this in place of ConfigMapKeyRef when the configuration contains credentials.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+
+	// Inline cometd.cfg settings. These are merged over the top of any referenced configuration.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +optional
+	Inline *runtime.RawExtension `json:"inline,omitempty"`
+}
+
+// CometServerRestore pre-populates the data volume of a new CometServer. Exactly one of
+// BackupRef, VolumeSnapshotRef or S3 must be set.
+//
+// The admin credentials must match an admin account in the restored data - set
+// spec.admin.secretRef, unless restoring a CometServerBackup whose server's admin Secret
+// still exists.
+type CometServerRestore struct {
+	// BackupRef names a CometServerBackup, in the same namespace, to restore.
+	// +optional
+	BackupRef string `json:"backupRef,omitempty"`
+
+	// VolumeSnapshotRef names a VolumeSnapshot of a Comet Server data volume, in the same
+	// namespace, to restore.
+	// +optional
+	VolumeSnapshotRef string `json:"volumeSnapshotRef,omitempty"`
+
+	// S3 downloads a tarball of a Comet Server data directory from object storage.
+	// +optional
+	S3 *CometServerRestoreS3Source `json:"s3,omitempty"`
+
+	// SerialNumber of the restored Comet Server, kept if no other CometServer is using it.
+	// Defaults to the serial number recorded by the CometServerBackup. A new serial number is
+	// issued if unset or in use.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+type CometServerRestoreS3Source struct {
+	// Endpoint of the S3-compatible object storage, e.g. s3.wasabisys.com
+	Endpoint string `json:"endpoint"`
+
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	Bucket string `json:"bucket"`
+
+	// Key of the .tar.gz object to restore.
+	Key string `json:"key"`
+
+	// CredentialsSecretRef is a Secret with accessKeyID and secretAccessKey keys.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// CometServerClone copies the data volume of another CometServer into a new CometServer, through
+// a VolumeSnapshot. The clone is always issued a new serial number.
+type CometServerClone struct {
+	// ServerRef is the name of the CometServer, in the same namespace, to clone.
+	ServerRef string `json:"serverRef"`
+
+	// VolumeSnapshotClassName of the snapshot of the source data volume. Uses the cluster
+	// default if unset.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+
+	// DisableOutbound turns off email, webhooks, PSA integrations, self-backups, the
+	// Constellation role and all scheduled jobs in the clone's configuration, so it doesn't act
+	// on behalf of the source.
+	// +kubebuilder:default=true
+	// +optional
+	DisableOutbound bool `json:"disableOutbound,omitempty"`
+}
+
+// CometServerDeletionPolicy decides what happens to the data volume when the CometServer is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;Snapshot
+type CometServerDeletionPolicy string
+
+const (
+	// CometServerDeletionPolicyDelete deletes the data volume with the CometServer.
+	CometServerDeletionPolicyDelete CometServerDeletionPolicy = "Delete"
+	// CometServerDeletionPolicyRetain keeps the data volume, and the <name>-admin Secret
+	// holding the admin credentials stored on it. A CometServer of the same name reuses both.
+	CometServerDeletionPolicyRetain CometServerDeletionPolicy = "Retain"
+	// CometServerDeletionPolicySnapshot takes a final CometServerBackup, named <name>-final, to
+	// a VolumeSnapshot before the data volume is deleted.
+	CometServerDeletionPolicySnapshot CometServerDeletionPolicy = "Snapshot"
+)
+
+type CometServerStorage struct {
+	// Size of the data volume. Defaults to 8Gi. The volume can be grown, if its storage class
+	// allows expansion, but never shrunk.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// DeletionPolicy for the data volume when the CometServer is deleted.
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy CometServerDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// VolumeSnapshotClassName of the final snapshot taken by the Snapshot deletion policy.
+	// Uses the cluster default if unset.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
 // CometServerSpec defines the desired state of CometServer
 type CometServerSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -42,12 +177,57 @@ type CometServerSpec struct {
 	Version string             `json:"version,omitempty"`
 	License CometServerLicense `json:"license,omitempty"`
 	Ingress CometServerIngress `json:"ingress,omitempty"`
+	Admin   CometServerAdmin   `json:"admin,omitempty"`
+	Config  *CometServerConfig `json:"config,omitempty"`
+
+	// RestoreFrom populates the data volume from a backup before the Comet Server first starts.
+	// Only applied when the CometServer is created.
+	// +optional
+	RestoreFrom *CometServerRestore `json:"restoreFrom,omitempty"`
+
+	// CloneFrom populates the data volume with a copy of another CometServer before the Comet
+	// Server first starts. Only applied when the CometServer is created. Mutually exclusive with
+	// RestoreFrom.
+	// +optional
+	CloneFrom *CometServerClone `json:"cloneFrom,omitempty"`
+
+	// Storage configures the data volume.
+	// +optional
+	Storage CometServerStorage `json:"storage,omitempty"`
+
+	// DeletionProtection rejects deletion of the CometServer until it is cleared.
+	// +optional
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// Suspend scales the Comet Server to zero, keeping its data volume, serial number and
+	// ingress. Clear it to start the Comet Server again.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// LogFiles runs a sidecar following the Comet Server's log files on the data volume, so that
+	// they can be viewed on the frontend alongside the container logs.
+	// +optional
+	LogFiles bool `json:"logFiles,omitempty"`
+
+	// Resources of the Comet Server container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 }
 
 // CometServerStatus defines the observed state of CometServer
 type CometServerStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// ConfigHash is the hash of the configuration last rendered into cometd.cfg.
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Conditions represent the latest available observations of the CometServer's state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 //+kubebuilder:object:root=true
@@ -74,6 +254,32 @@ func (cs *CometServer) FQDN() string {
 	return fmt.Sprintf("%s.%s", cs.Name, cs.Spec.Ingress.Host)
 }
 
+// AdminSecretName is the name of the Secret holding the Comet Server's admin credentials.
+func (cs *CometServer) AdminSecretName() string {
+	return fmt.Sprintf("%s-admin", cs.Name)
+}
+
+// StorageSize is the requested size of the data volume, 8Gi unless set.
+func (cs *CometServer) StorageSize() resource.Quantity {
+	if cs.Spec.Storage.Size != nil {
+		return *cs.Spec.Storage.Size
+	}
+	return resource.MustParse("8Gi")
+}
+
+// LicenseFeatures are the features the serial number is issued with: the CometServer's features
+// merged over the top of the issuer's.
+func (cs *CometServer) LicenseFeatures(issuer *CometLicenseIssuer) CometLicenseFeatures {
+	features := CometLicenseFeatures{}
+	for name, value := range issuer.Spec.Features {
+		features[name] = value
+	}
+	for name, value := range cs.Spec.License.Features {
+		features[name] = value
+	}
+	return features
+}
+
 //+kubebuilder:object:root=true
 
 // CometServerList contains a list of CometServer
@@ -0,0 +1,299 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/cometbackup/comet-server-operator/api/v1beta1"
+)
+
+// log is for logging in this package.
+var cometserverlog = logf.Log.WithName("cometserver-resource")
+
+var (
+	// imageTagRegexp matches a valid container image tag.
+	imageTagRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+)
+
+const (
+	// LatestCometServerVersion is the newest Comet Server release known to the operator. New
+	// CometServers run it unless the CometOperatorConfig sets another version.
+	LatestCometServerVersion = "23.6.3"
+
+	// cometServerMaxNameLength keeps the <name>-service Service name within a DNS-1035 label.
+	cometServerMaxNameLength = validation.DNS1035LabelMaxLength - len("-service")
+)
+
+func (cs *CometServer) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(cs).
+		WithDefaulter(NewCometServerDefaulter(mgr.GetClient())).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-cometd-cometbackup-com-v1alpha1-cometserver,mutating=true,failurePolicy=fail,sideEffects=None,groups=cometd.cometbackup.com,resources=cometservers,verbs=create,versions=v1alpha1,name=mcometserver.kb.io,admissionReviewVersions=v1
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometoperatorconfigs,verbs=get;list;watch
+
+// CometServerDefaulter fills in the unset fields of new CometServers from the CometOperatorConfig,
+// so the values are recorded on the stored object. Existing CometServers are never defaulted, so
+// changes to the CometOperatorConfig don't upgrade or move them.
+// +kubebuilder:object:generate=false
+type CometServerDefaulter struct {
+	client client.Reader
+}
+
+var _ webhook.CustomDefaulter = &CometServerDefaulter{}
+
+// NewCometServerDefaulter returns a CometServerDefaulter reading the CometOperatorConfig through c.
+func NewCometServerDefaulter(c client.Reader) *CometServerDefaulter {
+	return &CometServerDefaulter{client: c}
+}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *CometServerDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	cs, ok := obj.(*CometServer)
+	if !ok {
+		return fmt.Errorf("expected a CometServer but got a %T", obj)
+	}
+	cometserverlog.Info("default", "name", cs.Name)
+
+	config := &CometOperatorConfig{}
+	err := d.client.Get(ctx, types.NamespacedName{Name: CometOperatorConfigName}, config)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get CometOperatorConfig %q: %w", CometOperatorConfigName, err)
+	}
+	cs.applyDefaults(config.Spec.CometServer)
+	return nil
+}
+
+// applyDefaults sets the fields left unset on the CometServer.
+func (cs *CometServer) applyDefaults(defaults CometServerDefaults) {
+	if cs.Spec.Version == "" {
+		cs.Spec.Version = defaults.Version
+		if cs.Spec.Version == "" {
+			cs.Spec.Version = LatestCometServerVersion
+		}
+	}
+	if cs.Spec.License.Issuer == "" {
+		cs.Spec.License.Issuer = defaults.Issuer
+	}
+	if cs.Spec.Ingress.Host == "" {
+		cs.Spec.Ingress.Host = defaults.IngressHost
+	}
+	if cs.Spec.Storage.Size == nil {
+		size := cs.StorageSize()
+		if defaults.StorageSize != nil {
+			size = defaults.StorageSize.DeepCopy()
+		}
+		cs.Spec.Storage.Size = &size
+	}
+	if cs.Spec.Resources.Limits == nil && cs.Spec.Resources.Requests == nil && defaults.Resources != nil {
+		defaults.Resources.DeepCopyInto(&cs.Spec.Resources)
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-cometd-cometbackup-com-v1alpha1-cometserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=cometd.cometbackup.com,resources=cometservers,verbs=create;update;delete,versions=v1alpha1,name=vcometserver.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &CometServer{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (cs *CometServer) ValidateCreate() error {
+	cometserverlog.Info("validate create", "name", cs.Name)
+
+	return cs.toAggregate(cs.validateCometServer(nil))
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (cs *CometServer) ValidateUpdate(old runtime.Object) error {
+	cometserverlog.Info("validate update", "name", cs.Name)
+
+	oldCS, ok := old.(*CometServer)
+	if !ok {
+		return fmt.Errorf("expected a CometServer but got a %T", old)
+	}
+	// The finalizer must always be removable
+	if cs.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	allErrs := cs.validateCometServer(oldCS)
+	allErrs = append(allErrs, cs.validateCometServerUpdate(oldCS)...)
+	return cs.toAggregate(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (cs *CometServer) ValidateDelete() error {
+	cometserverlog.Info("validate delete", "name", cs.Name)
+
+	// Reject the request outright - once the deletion timestamp is set it can't be undone
+	if cs.Spec.DeletionProtection {
+		return apierrors.NewForbidden(GroupVersion.WithResource("cometservers").GroupResource(), cs.Name, fmt.Errorf("spec.deletionProtection is enabled - clear it before deleting the CometServer"))
+	}
+	return nil
+}
+
+// validateCometServer checks the fields of a new CometServer. On update, old is the current
+// object and only the fields which changed are checked - CometServers created before a rule was
+// added must still accept the operator's own updates, such as finalizers and the serial number.
+func (cs *CometServer) validateCometServer(old *CometServer) field.ErrorList {
+	var allErrs field.ErrorList
+	spec := field.NewPath("spec")
+	create := old == nil
+	if create {
+		old = &CometServer{}
+	}
+	changed := func(value, oldValue interface{}) bool {
+		return create || !reflect.DeepEqual(value, oldValue)
+	}
+
+	// Names are immutable, so only checked on create
+	if create {
+		if len(cs.Name) > cometServerMaxNameLength {
+			allErrs = append(allErrs, field.TooLong(field.NewPath("metadata", "name"), cs.Name, cometServerMaxNameLength))
+		} else {
+			for _, msg := range validation.IsDNS1035Label(cs.Name) {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "name"), cs.Name, msg))
+			}
+		}
+	}
+
+	if changed(cs.Spec.Version, old.Spec.Version) {
+		if cs.Spec.Version == "" {
+			allErrs = append(allErrs, field.Required(spec.Child("version"), "the Comet Server version to run, e.g. 23.6.3"))
+		} else if !imageTagRegexp.MatchString(cs.Spec.Version) {
+			allErrs = append(allErrs, field.Invalid(spec.Child("version"), cs.Spec.Version, "must be a tag of the ghcr.io/cometbackup/comet-server image, e.g. 23.6.3"))
+		}
+	}
+
+	if changed(cs.Spec.License.Issuer, old.Spec.License.Issuer) && cs.Spec.License.Issuer == "" {
+		allErrs = append(allErrs, field.Required(spec.Child("license", "issuer"), "a CometLicenseIssuer is required to issue the serial number"))
+	}
+	if changed(cs.Spec.License.Features, old.Spec.License.Features) {
+		allErrs = append(allErrs, validateLicenseFeatures(spec.Child("license", "features"), cs.Spec.License.Features)...)
+	}
+
+	if changed(cs.Spec.Ingress.Host, old.Spec.Ingress.Host) {
+		if cs.Spec.Ingress.Host == "" {
+			allErrs = append(allErrs, field.Required(spec.Child("ingress", "host"), "the domain the Comet Server is served under, as <name>.<host>"))
+		} else {
+			for _, msg := range validation.IsDNS1123Subdomain(cs.FQDN()) {
+				allErrs = append(allErrs, field.Invalid(spec.Child("ingress", "host"), cs.Spec.Ingress.Host, fmt.Sprintf("%s is not a valid DNS name: %s", cs.FQDN(), msg)))
+			}
+		}
+	}
+
+	if size := cs.Spec.Storage.Size; size != nil && size.Sign() <= 0 && changed(size, old.Spec.Storage.Size) {
+		allErrs = append(allErrs, field.Invalid(spec.Child("storage", "size"), size.String(), "must be greater than zero"))
+	}
+
+	if restore := cs.Spec.RestoreFrom; restore != nil && changed(restore, old.Spec.RestoreFrom) {
+		path := spec.Child("restoreFrom")
+		sources := 0
+		for _, set := range []bool{restore.BackupRef != "", restore.VolumeSnapshotRef != "", restore.S3 != nil} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			allErrs = append(allErrs, field.Invalid(path, "", "exactly one of backupRef, volumeSnapshotRef or s3 must be set"))
+		}
+		if s3 := restore.S3; s3 != nil {
+			for name, value := range map[string]string{"endpoint": s3.Endpoint, "bucket": s3.Bucket, "key": s3.Key, "credentialsSecretRef": s3.CredentialsSecretRef.Name} {
+				if value == "" {
+					allErrs = append(allErrs, field.Required(path.Child("s3", name), ""))
+				}
+			}
+		}
+	}
+
+	if clone := cs.Spec.CloneFrom; clone != nil && changed(clone, old.Spec.CloneFrom) {
+		if clone.ServerRef == "" {
+			allErrs = append(allErrs, field.Required(spec.Child("cloneFrom", "serverRef"), "the CometServer to clone"))
+		} else if clone.ServerRef == cs.Name {
+			allErrs = append(allErrs, field.Invalid(spec.Child("cloneFrom", "serverRef"), clone.ServerRef, "a CometServer can't be cloned from itself"))
+		}
+	}
+	if cs.Spec.RestoreFrom != nil && cs.Spec.CloneFrom != nil && (changed(cs.Spec.RestoreFrom, old.Spec.RestoreFrom) || changed(cs.Spec.CloneFrom, old.Spec.CloneFrom)) {
+		allErrs = append(allErrs, field.Forbidden(spec.Child("cloneFrom"), "restoreFrom and cloneFrom are mutually exclusive"))
+	}
+
+	return allErrs
+}
+
+func (cs *CometServer) validateCometServerUpdate(old *CometServer) field.ErrorList {
+	var allErrs field.ErrorList
+	spec := field.NewPath("spec")
+
+	// The license is only used to issue the serial number
+	if old.SerialNumber() != "" {
+		if cs.Spec.License.Issuer != old.Spec.License.Issuer {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("license", "issuer"), "can't be changed once a serial number has been issued"))
+		}
+		if !reflect.DeepEqual(cs.Spec.License.Features, old.Spec.License.Features) {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("license", "features"), "can't be changed once a serial number has been issued"))
+		}
+	}
+
+	newSize, oldSize := cs.StorageSize(), old.StorageSize()
+	if newSize.Cmp(oldSize) < 0 {
+		allErrs = append(allErrs, field.Forbidden(spec.Child("storage", "size"), fmt.Sprintf("can't be shrunk from %s to %s", oldSize.String(), newSize.String())))
+	}
+
+	// Restores and clones only apply when the CometServer is created. They may be removed afterwards.
+	if cs.Spec.RestoreFrom != nil && !reflect.DeepEqual(cs.Spec.RestoreFrom, old.Spec.RestoreFrom) {
+		allErrs = append(allErrs, field.Forbidden(spec.Child("restoreFrom"), "can't be changed after creation, only removed"))
+	}
+	if cs.Spec.CloneFrom != nil && !reflect.DeepEqual(cs.Spec.CloneFrom, old.Spec.CloneFrom) {
+		allErrs = append(allErrs, field.Forbidden(spec.Child("cloneFrom"), "can't be changed after creation, only removed"))
+	}
+
+	return allErrs
+}
+
+func (cs *CometServer) toAggregate(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("CometServer").GroupKind(), cs.Name, allErrs)
+}
+
+// validateLicenseFeatures rejects negative feature values, and flags other than 0 or 1. Unknown
+// feature names are accepted, as v1alpha1 has no other way to set them.
+func validateLicenseFeatures(path *field.Path, features CometLicenseFeatures) field.ErrorList {
+	var allErrs field.ErrorList
+	for name, value := range features {
+		if value < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Key(name), value, "must be zero or greater"))
+		} else if v1beta1.IsLicenseFlag(name) && value > 1 {
+			allErrs = append(allErrs, field.Invalid(path.Key(name), value, "must be 0 (disabled) or 1 (enabled)"))
+		}
+	}
+	return allErrs
+}
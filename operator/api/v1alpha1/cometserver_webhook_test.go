@@ -0,0 +1,257 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+func newCometServer() *cometdv1alpha1.CometServer {
+	return &cometdv1alpha1.CometServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "cometd", Namespace: "default"},
+		Spec: cometdv1alpha1.CometServerSpec{
+			Version: "23.5.0",
+			License: cometdv1alpha1.CometServerLicense{
+				Issuer:   "issuer",
+				Features: cometdv1alpha1.CometLicenseFeatures{"booster": 10},
+			},
+			Ingress: cometdv1alpha1.CometServerIngress{Host: "example.com"},
+		},
+	}
+}
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+var _ = Describe("CometServer webhook", func() {
+	var cs *cometdv1alpha1.CometServer
+
+	BeforeEach(func() {
+		cs = newCometServer()
+	})
+
+	Describe("Default", func() {
+		var scheme *runtime.Scheme
+
+		BeforeEach(func() {
+			scheme = runtime.NewScheme()
+			Expect(cometdv1alpha1.AddToScheme(scheme)).To(Succeed())
+			cs = &cometdv1alpha1.CometServer{ObjectMeta: metav1.ObjectMeta{Name: "cometd", Namespace: "default"}}
+		})
+
+		It("fills in the latest version and storage size without a CometOperatorConfig", func() {
+			d := cometdv1alpha1.NewCometServerDefaulter(fake.NewClientBuilder().WithScheme(scheme).Build())
+			Expect(d.Default(context.Background(), cs)).To(Succeed())
+			Expect(cs.Spec.Version).To(Equal(cometdv1alpha1.LatestCometServerVersion))
+			Expect(cs.Spec.Storage.Size.String()).To(Equal("8Gi"))
+			Expect(cs.Spec.License.Issuer).To(BeEmpty())
+		})
+
+		It("fills in unset fields from the CometOperatorConfig", func() {
+			config := &cometdv1alpha1.CometOperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: cometdv1alpha1.CometOperatorConfigName},
+				Spec: cometdv1alpha1.CometOperatorConfigSpec{
+					CometServer: cometdv1alpha1.CometServerDefaults{
+						Version:     "23.3.0",
+						Issuer:      "issuer",
+						IngressHost: "example.com",
+						StorageSize: quantity("20Gi"),
+						Resources: &corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+						},
+					},
+				},
+			}
+			d := cometdv1alpha1.NewCometServerDefaulter(fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build())
+			Expect(d.Default(context.Background(), cs)).To(Succeed())
+			Expect(cs.Spec.Version).To(Equal("23.3.0"))
+			Expect(cs.Spec.License.Issuer).To(Equal("issuer"))
+			Expect(cs.Spec.Ingress.Host).To(Equal("example.com"))
+			Expect(cs.Spec.Storage.Size.String()).To(Equal("20Gi"))
+			Expect(cs.Spec.Resources.Requests.Memory().String()).To(Equal("256Mi"))
+			Expect(cs.ValidateCreate()).To(Succeed())
+		})
+
+		It("keeps fields which are already set", func() {
+			config := &cometdv1alpha1.CometOperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: cometdv1alpha1.CometOperatorConfigName},
+				Spec: cometdv1alpha1.CometOperatorConfigSpec{
+					CometServer: cometdv1alpha1.CometServerDefaults{Version: "23.3.0", Issuer: "issuer"},
+				},
+			}
+			cs.Spec.Version = "23.5.0"
+			cs.Spec.License.Issuer = "other"
+			d := cometdv1alpha1.NewCometServerDefaulter(fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build())
+			Expect(d.Default(context.Background(), cs)).To(Succeed())
+			Expect(cs.Spec.Version).To(Equal("23.5.0"))
+			Expect(cs.Spec.License.Issuer).To(Equal("other"))
+		})
+
+		It("ignores other CometOperatorConfigs", func() {
+			config := &cometdv1alpha1.CometOperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "other"},
+				Spec: cometdv1alpha1.CometOperatorConfigSpec{
+					CometServer: cometdv1alpha1.CometServerDefaults{Issuer: "issuer"},
+				},
+			}
+			d := cometdv1alpha1.NewCometServerDefaulter(fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build())
+			Expect(d.Default(context.Background(), cs)).To(Succeed())
+			Expect(cs.Spec.License.Issuer).To(BeEmpty())
+		})
+	})
+
+	Describe("ValidateCreate", func() {
+		It("accepts a valid CometServer", func() {
+			Expect(cs.ValidateCreate()).To(Succeed())
+		})
+
+		DescribeTable("rejects an invalid spec",
+			func(mutate func(cs *cometdv1alpha1.CometServer), field string) {
+				mutate(cs)
+				err := cs.ValidateCreate()
+				Expect(apierrors.IsInvalid(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring(field))
+			},
+			Entry("empty version", func(cs *cometdv1alpha1.CometServer) { cs.Spec.Version = "" }, "spec.version"),
+			Entry("version which isn't an image tag", func(cs *cometdv1alpha1.CometServer) { cs.Spec.Version = "23.5.0 beta" }, "spec.version"),
+			Entry("missing license issuer", func(cs *cometdv1alpha1.CometServer) { cs.Spec.License.Issuer = "" }, "spec.license.issuer"),
+			Entry("negative feature count", func(cs *cometdv1alpha1.CometServer) { cs.Spec.License.Features["booster"] = -1 }, "spec.license.features[booster]"),
+			Entry("feature flag other than 0 or 1", func(cs *cometdv1alpha1.CometServer) { cs.Spec.License.Features["LIFT_STORAGE_ROLE"] = 2 }, "spec.license.features[LIFT_STORAGE_ROLE]"),
+			Entry("host which isn't a DNS name", func(cs *cometdv1alpha1.CometServer) { cs.Spec.Ingress.Host = "example_com" }, "spec.ingress.host"),
+			Entry("name too long for the service", func(cs *cometdv1alpha1.CometServer) {
+				cs.Name = "a-very-long-comet-server-name-which-does-not-fit-in-a-service"
+			}, "metadata.name"),
+			Entry("zero storage size", func(cs *cometdv1alpha1.CometServer) { cs.Spec.Storage.Size = quantity("0") }, "spec.storage.size"),
+			Entry("restore without a source", func(cs *cometdv1alpha1.CometServer) {
+				cs.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{}
+			}, "spec.restoreFrom"),
+			Entry("restore with two sources", func(cs *cometdv1alpha1.CometServer) {
+				cs.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{BackupRef: "nightly", VolumeSnapshotRef: "snapshot"}
+			}, "spec.restoreFrom"),
+			Entry("restore and clone", func(cs *cometdv1alpha1.CometServer) {
+				cs.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{BackupRef: "nightly"}
+				cs.Spec.CloneFrom = &cometdv1alpha1.CometServerClone{ServerRef: "production"}
+			}, "spec.cloneFrom"),
+			Entry("clone from itself", func(cs *cometdv1alpha1.CometServer) {
+				cs.Spec.CloneFrom = &cometdv1alpha1.CometServerClone{ServerRef: cs.Name}
+			}, "spec.cloneFrom.serverRef"),
+		)
+	})
+
+	Describe("ValidateUpdate", func() {
+		var old *cometdv1alpha1.CometServer
+
+		BeforeEach(func() {
+			old = cs.DeepCopy()
+		})
+
+		It("allows the issuer to change before a serial number is issued", func() {
+			cs.Spec.License.Issuer = "other"
+			Expect(cs.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("rejects changing the issuer once a serial number is issued", func() {
+			old.SetAnnotations(map[string]string{"cometd.cometbackup.com/serial-number": "SERIAL"})
+			cs.SetAnnotations(old.GetAnnotations())
+			cs.Spec.License.Issuer = "other"
+			err := cs.ValidateUpdate(old)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.license.issuer"))
+		})
+
+		It("allows growing the storage", func() {
+			cs.Spec.Storage.Size = quantity("20Gi")
+			Expect(cs.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("rejects shrinking the storage", func() {
+			old.Spec.Storage.Size = quantity("20Gi")
+			cs.Spec.Storage.Size = quantity("10Gi")
+			err := cs.ValidateUpdate(old)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.storage.size"))
+		})
+
+		It("rejects shrinking below the default size", func() {
+			cs.Spec.Storage.Size = quantity("4Gi")
+			Expect(cs.ValidateUpdate(old)).NotTo(Succeed())
+		})
+
+		It("allows removing restoreFrom, but not changing it", func() {
+			old.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{BackupRef: "nightly"}
+			cs.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{BackupRef: "weekly"}
+			Expect(cs.ValidateUpdate(old)).NotTo(Succeed())
+
+			cs.Spec.RestoreFrom = nil
+			Expect(cs.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("only checks the fields which changed", func() {
+			// Created before the rules existed
+			old.Name = "a-very-long-comet-server-name-which-does-not-fit-in-a-service"
+			old.Spec.Version = ""
+			old.Spec.Ingress.Host = ""
+			cs = old.DeepCopy()
+			cs.SetFinalizers([]string{"cometd.cometbackup.com/finalizer"})
+			cs.SetAnnotations(map[string]string{"cometd.cometbackup.com/serial-number": "SERIAL"})
+			Expect(cs.ValidateUpdate(old)).To(Succeed())
+
+			cs.Spec.Version = "23.5.0 beta"
+			err := cs.ValidateUpdate(old)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.version"))
+			Expect(err.Error()).NotTo(ContainSubstring("spec.ingress.host"))
+			Expect(err.Error()).NotTo(ContainSubstring("metadata.name"))
+		})
+
+		It("allows any update while the CometServer is being deleted", func() {
+			now := metav1.Now()
+			old.DeletionTimestamp = &now
+			old.Spec.Storage.Size = quantity("20Gi")
+			cs = old.DeepCopy()
+			cs.Spec.Storage.Size = quantity("10Gi")
+			cs.SetFinalizers(nil)
+			Expect(cs.ValidateUpdate(old)).To(Succeed())
+		})
+	})
+
+	Describe("ValidateDelete", func() {
+		It("allows deleting an unprotected CometServer", func() {
+			Expect(cs.ValidateDelete()).To(Succeed())
+		})
+
+		It("rejects deleting a protected CometServer", func() {
+			cs.Spec.DeletionProtection = true
+			err := cs.ValidateDelete()
+			Expect(apierrors.IsForbidden(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.deletionProtection"))
+		})
+	})
+})
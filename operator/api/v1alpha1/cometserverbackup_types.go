@@ -0,0 +1,138 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CometServerBackupPhase is the progress of a backup.
+// +kubebuilder:validation:Enum=Pending;Running;Completed;Failed
+type CometServerBackupPhase string
+
+const (
+	CometServerBackupPending   CometServerBackupPhase = "Pending"
+	CometServerBackupRunning   CometServerBackupPhase = "Running"
+	CometServerBackupCompleted CometServerBackupPhase = "Completed"
+	CometServerBackupFailed    CometServerBackupPhase = "Failed"
+)
+
+type CometServerBackupS3Target struct {
+	// Endpoint of the S3-compatible object storage, e.g. s3.wasabisys.com
+	Endpoint string `json:"endpoint"`
+
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	Bucket string `json:"bucket"`
+
+	// Prefix of the object key. Backups are stored as <prefix>/<server>/<backup>.tar.gz
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// CredentialsSecretRef is a Secret with accessKeyID and secretAccessKey keys.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+type CometServerBackupVolumeSnapshotTarget struct {
+	// VolumeSnapshotClassName of the snapshot. Uses the cluster default if unset.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// CometServerBackupTarget is where the backup is stored. Exactly one must be set.
+type CometServerBackupTarget struct {
+	// S3 uploads a tarball of the data volume to S3-compatible object storage.
+	// +optional
+	S3 *CometServerBackupS3Target `json:"s3,omitempty"`
+
+	// VolumeSnapshot takes a CSI snapshot of the data volume.
+	// +optional
+	VolumeSnapshot *CometServerBackupVolumeSnapshotTarget `json:"volumeSnapshot,omitempty"`
+}
+
+// CometServerBackupSpec defines the desired state of CometServerBackup
+type CometServerBackupSpec struct {
+	// ServerRef is the name of the CometServer, in the same namespace, to back up.
+	ServerRef string `json:"serverRef"`
+
+	Target CometServerBackupTarget `json:"target"`
+
+	// Quiesce stops the Comet Server while the backup is taken, so the copy is consistent.
+	// Otherwise the data volume is copied live - volume snapshots are crash-consistent, but
+	// an S3 copy may capture files mid-write.
+	// +optional
+	Quiesce bool `json:"quiesce,omitempty"`
+}
+
+// CometServerBackupStatus defines the observed state of CometServerBackup
+type CometServerBackupStatus struct {
+	Phase CometServerBackupPhase `json:"phase,omitempty"`
+
+	// Location of the backup - an s3:// URL or the name of the VolumeSnapshot.
+	Location string `json:"location,omitempty"`
+
+	// SerialNumber of the Comet Server when it was backed up.
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// Size of the backup.
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	StartTime      *metav1.Time     `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time     `json:"completionTime,omitempty"`
+	Duration       *metav1.Duration `json:"duration,omitempty"`
+
+	// Message describes why the backup failed.
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.serverRef`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.status.size`
+//+kubebuilder:printcolumn:name="Duration",type=string,JSONPath=`.status.duration`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CometServerBackup is the Schema for the cometserverbackups API
+type CometServerBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CometServerBackupSpec   `json:"spec,omitempty"`
+	Status CometServerBackupStatus `json:"status,omitempty"`
+}
+
+// IsFinished reports whether the backup has completed or failed.
+func (b *CometServerBackup) IsFinished() bool {
+	return b.Status.Phase == CometServerBackupCompleted || b.Status.Phase == CometServerBackupFailed
+}
+
+//+kubebuilder:object:root=true
+
+// CometServerBackupList contains a list of CometServerBackup
+type CometServerBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CometServerBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CometServerBackup{}, &CometServerBackupList{})
+}
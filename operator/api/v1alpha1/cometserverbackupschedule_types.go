@@ -0,0 +1,83 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CometServerBackupScheduleSpec defines the desired state of CometServerBackupSchedule
+type CometServerBackupScheduleSpec struct {
+	// Schedule in cron format, e.g. "0 3 * * *"
+	Schedule string `json:"schedule"`
+
+	// Suspend stops new backups from being created. Existing backups are kept.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Template of the CometServerBackups to create.
+	Template CometServerBackupSpec `json:"template"`
+
+	// SuccessfulBackupsToKeep is the number of completed backups to retain. Older backups,
+	// and their stored data, are deleted - unless a CometServer is restoring from them.
+	// +kubebuilder:default=7
+	// +kubebuilder:validation:Minimum=1
+	SuccessfulBackupsToKeep int `json:"successfulBackupsToKeep,omitempty"`
+
+	// FailedBackupsToKeep is the number of failed backups to retain.
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=0
+	FailedBackupsToKeep int `json:"failedBackupsToKeep,omitempty"`
+}
+
+// CometServerBackupScheduleStatus defines the observed state of CometServerBackupSchedule
+type CometServerBackupScheduleStatus struct {
+	// LastScheduleTime is when the last backup was created.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulBackup is the name of the most recent completed backup.
+	LastSuccessfulBackup string `json:"lastSuccessfulBackup,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.template.serverRef`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+
+// CometServerBackupSchedule is the Schema for the cometserverbackupschedules API
+type CometServerBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CometServerBackupScheduleSpec   `json:"spec,omitempty"`
+	Status CometServerBackupScheduleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CometServerBackupScheduleList contains a list of CometServerBackupSchedule
+type CometServerBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CometServerBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CometServerBackupSchedule{}, &CometServerBackupScheduleList{})
+}
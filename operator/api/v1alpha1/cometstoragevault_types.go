@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CometStorageVaultType is the kind of object storage backing a storage template.
+// +kubebuilder:validation:Enum=S3
+type CometStorageVaultType string
+
+const (
+	// CometStorageVaultS3 is any S3-compatible object storage, including Backblaze B2 through
+	// its S3-compatible endpoint.
+	CometStorageVaultS3 CometStorageVaultType = "S3"
+)
+
+type CometStorageVaultS3Options struct {
+	// Endpoint of the S3-compatible server, e.g. s3.us-east-1.amazonaws.com
+	Endpoint string `json:"endpoint"`
+}
+
+// CometStorageVaultSpec defines the desired state of CometStorageVault
+type CometStorageVaultSpec struct {
+	// ServerRef is the name of the CometServer, in the same namespace, to configure. The
+	// CometServer must not declare spec.config, which replaces its storage templates on every
+	// start up.
+	ServerRef string `json:"serverRef"`
+
+	// Description of the storage template, shown when requesting a Storage Vault.
+	// Defaults to the resource name.
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	Type CometStorageVaultType       `json:"type"`
+	S3   *CometStorageVaultS3Options `json:"s3,omitempty"`
+
+	// CredentialsSecretRef names a Secret with `accessKeyID` and `secretAccessKey` keys.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// CometStorageVaultStatus defines the observed state of CometStorageVault
+type CometStorageVaultStatus struct {
+	// Conditions represent the latest available observations of the storage template's state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.serverRef`
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+//+kubebuilder:printcolumn:name="Provisioned",type=string,JSONPath=`.status.conditions[?(@.type=="Provisioned")].status`
+//+kubebuilder:printcolumn:name="Connected",type=string,JSONPath=`.status.conditions[?(@.type=="Connected")].status`
+
+// CometStorageVault is the Schema for the cometstoragevaults API
+type CometStorageVault struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CometStorageVaultSpec   `json:"spec,omitempty"`
+	Status CometStorageVaultStatus `json:"status,omitempty"`
+}
+
+// TemplateDescription is the description identifying the storage template on the Comet Server.
+func (sv *CometStorageVault) TemplateDescription() string {
+	if sv.Spec.Description != "" {
+		return sv.Spec.Description
+	}
+	return sv.Name
+}
+
+//+kubebuilder:object:root=true
+
+// CometStorageVaultList contains a list of CometStorageVault
+type CometStorageVaultList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CometStorageVault `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CometStorageVault{}, &CometStorageVaultList{})
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CometUserType is the kind of Comet Server account.
+// +kubebuilder:validation:Enum=User;Admin
+type CometUserType string
+
+const (
+	// CometUserTypeUser is a customer account, which backs up devices.
+	CometUserTypeUser CometUserType = "User"
+	// CometUserTypeAdmin is an administrator account of the Comet Server web interface.
+	CometUserTypeAdmin CometUserType = "Admin"
+)
+
+// CometUserDeletionPolicy decides what happens to the account when the CometUser is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain
+type CometUserDeletionPolicy string
+
+const (
+	// CometUserDeletionPolicyDelete deletes the account, and for customers all of their data.
+	CometUserDeletionPolicyDelete CometUserDeletionPolicy = "Delete"
+	// CometUserDeletionPolicyRetain leaves the account on the Comet Server.
+	CometUserDeletionPolicyRetain CometUserDeletionPolicy = "Retain"
+)
+
+type CometUserQuota struct {
+	// StorageLimit caps the total size of all protected items. Unlimited if unset.
+	// +optional
+	StorageLimit *resource.Quantity `json:"storageLimit,omitempty"`
+
+	// MaximumDevices caps the number of devices. Unlimited if zero.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaximumDevices int `json:"maximumDevices,omitempty"`
+}
+
+// CometUserSpec defines the desired state of CometUser
+type CometUserSpec struct {
+	// ServerRef is the name of the CometServer, in the same namespace, to create the account on.
+	ServerRef string `json:"serverRef"`
+
+	// Username of the account. Defaults to the resource name. An Admin account can't use the
+	// username of the admin account the operator itself uses on the CometServer.
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// +kubebuilder:default=User
+	Type CometUserType `json:"type,omitempty"`
+
+	// PasswordSecretRef selects the Secret key holding the account password. Changes to the
+	// Secret are applied to the account.
+	PasswordSecretRef corev1.SecretKeySelector `json:"passwordSecretRef"`
+
+	// AccountName is the display name of a customer account.
+	// +optional
+	AccountName string `json:"accountName,omitempty"`
+
+	// PolicyID assigns a customer account to a policy group.
+	// +optional
+	PolicyID string `json:"policyID,omitempty"`
+
+	// Quota limits of a customer account.
+	// +optional
+	Quota CometUserQuota `json:"quota,omitempty"`
+
+	// +kubebuilder:default=Retain
+	DeletionPolicy CometUserDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// CometUserStatus defines the observed state of CometUser
+type CometUserStatus struct {
+	// PasswordSecretVersion is the resource version of the password Secret last applied to the account.
+	PasswordSecretVersion string `json:"passwordSecretVersion,omitempty"`
+
+	// Conditions represent the latest available observations of the account's state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.serverRef`
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// CometUser is the Schema for the cometusers API
+type CometUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CometUserSpec   `json:"spec,omitempty"`
+	Status CometUserStatus `json:"status,omitempty"`
+}
+
+// Username of the account on the Comet Server.
+func (u *CometUser) Username() string {
+	if u.Spec.Username != "" {
+		return u.Spec.Username
+	}
+	return u.Name
+}
+
+//+kubebuilder:object:root=true
+
+// CometUserList contains a list of CometUser
+type CometUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CometUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CometUser{}, &CometUserList{})
+}
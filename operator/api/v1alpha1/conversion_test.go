@@ -0,0 +1,208 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	cometdv1beta1 "github.com/cometbackup/comet-server-operator/api/v1beta1"
+)
+
+var _ = Describe("Conversion", func() {
+	Describe("CometServer", func() {
+		newV1alpha1 := func() *cometdv1alpha1.CometServer {
+			return &cometdv1alpha1.CometServer{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "cometd",
+					Namespace:   "default",
+					Annotations: map[string]string{"cometd.cometbackup.com/serial-number": "SERIAL"},
+				},
+				Spec: cometdv1alpha1.CometServerSpec{
+					Version: "23.5.0",
+					License: cometdv1alpha1.CometServerLicense{
+						Issuer:   "issuer",
+						Features: cometdv1alpha1.CometLicenseFeatures{"LIFT_STORAGE_ROLE": 0, "MAX_DEVICES": 10, "NEW_FEATURE": 1},
+					},
+					Ingress: cometdv1alpha1.CometServerIngress{Host: "example.com"},
+					Admin:   cometdv1alpha1.CometServerAdmin{SecretRef: &corev1.LocalObjectReference{Name: "admin"}},
+					Config: &cometdv1alpha1.CometServerConfig{
+						SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "config"}, Key: "cometd.cfg"},
+						Inline:       &runtime.RawExtension{Raw: []byte(`{"Branding":{"BrandName":"Comet"}}`)},
+					},
+					RestoreFrom: &cometdv1alpha1.CometServerRestore{
+						S3: &cometdv1alpha1.CometServerRestoreS3Source{
+							Endpoint:             "s3.example.com",
+							Bucket:               "backups",
+							Key:                  "cometd.tar.gz",
+							CredentialsSecretRef: corev1.LocalObjectReference{Name: "s3"},
+						},
+						SerialNumber: "SERIAL",
+					},
+					Storage: cometdv1alpha1.CometServerStorage{
+						Size:           quantity("20Gi"),
+						DeletionPolicy: cometdv1alpha1.CometServerDeletionPolicySnapshot,
+					},
+					DeletionProtection: true,
+					Suspend:            true,
+					LogFiles:           true,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+					},
+				},
+				Status: cometdv1alpha1.CometServerStatus{
+					ConfigHash: "hash",
+					Conditions: []metav1.Condition{{Type: "Restored", Status: metav1.ConditionTrue, Reason: "Restored"}},
+				},
+			}
+		}
+
+		It("converts references to structured references", func() {
+			src := newV1alpha1()
+			src.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{BackupRef: "nightly"}
+			dst := &cometdv1beta1.CometServer{}
+			Expect(src.ConvertTo(dst)).To(Succeed())
+			Expect(dst.Spec.License.IssuerRef.Name).To(Equal("issuer"))
+			Expect(*dst.Spec.License.Features.Roles.StorageRole).To(Equal(cometdv1beta1.CometLicenseFlag(0)))
+			Expect(*dst.Spec.License.Features.MaximumDevices).To(Equal(10))
+			Expect(dst.Spec.License.Features.Additional).To(Equal(map[string]int{"NEW_FEATURE": 1}))
+			Expect(dst.Spec.RestoreFrom.BackupRef).To(Equal(&corev1.LocalObjectReference{Name: "nightly"}))
+			Expect(dst.Spec.RestoreFrom.VolumeSnapshotRef).To(BeNil())
+		})
+
+		DescribeTable("round-trips v1alpha1 through v1beta1",
+			func(mutate func(cs *cometdv1alpha1.CometServer)) {
+				src := newV1alpha1()
+				mutate(src)
+				hub := &cometdv1beta1.CometServer{}
+				Expect(src.ConvertTo(hub)).To(Succeed())
+				dst := &cometdv1alpha1.CometServer{}
+				Expect(dst.ConvertFrom(hub)).To(Succeed())
+				Expect(dst).To(Equal(src))
+			},
+			Entry("fully populated", func(cs *cometdv1alpha1.CometServer) {}),
+			Entry("restore from a backup", func(cs *cometdv1alpha1.CometServer) {
+				cs.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{BackupRef: "nightly"}
+			}),
+			Entry("clone", func(cs *cometdv1alpha1.CometServer) {
+				cs.Spec.RestoreFrom = nil
+				cs.Spec.CloneFrom = &cometdv1alpha1.CometServerClone{ServerRef: "production", DisableOutbound: true}
+			}),
+			Entry("empty", func(cs *cometdv1alpha1.CometServer) {
+				*cs = cometdv1alpha1.CometServer{}
+			}),
+		)
+
+		It("round-trips v1beta1 through v1alpha1", func() {
+			src := &cometdv1beta1.CometServer{}
+			Expect(newV1alpha1().ConvertTo(src)).To(Succeed())
+			src.Spec.RestoreFrom = &cometdv1beta1.CometServerRestore{VolumeSnapshotRef: &corev1.LocalObjectReference{Name: "snapshot"}}
+			src.Spec.CloneFrom = &cometdv1beta1.CometServerClone{ServerRef: corev1.LocalObjectReference{Name: "production"}}
+
+			spoke := &cometdv1alpha1.CometServer{}
+			Expect(spoke.ConvertFrom(src)).To(Succeed())
+			dst := &cometdv1beta1.CometServer{}
+			Expect(spoke.ConvertTo(dst)).To(Succeed())
+			Expect(dst).To(Equal(src))
+		})
+	})
+
+	Describe("CometLicenseIssuer", func() {
+		It("round-trips v1alpha1 through v1beta1", func() {
+			src := &cometdv1alpha1.CometLicenseIssuer{
+				ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"},
+				Spec: cometdv1alpha1.CometLicenseIssuerSpec{
+					Auth:     cometdv1alpha1.CometLicenseIssuerAuth{Email: "admin@example.com", Token: "token"},
+					Features: cometdv1alpha1.CometLicenseFeatures{"BOOSTER_MSSQL": 1, "NEW_FEATURE": 3},
+				},
+			}
+			hub := &cometdv1beta1.CometLicenseIssuer{}
+			Expect(src.ConvertTo(hub)).To(Succeed())
+			Expect(*hub.Spec.Features.Boosters.MSSQL).To(Equal(cometdv1beta1.CometLicenseFlag(1)))
+			Expect(hub.Spec.Features.Additional).To(Equal(map[string]int{"NEW_FEATURE": 3}))
+			dst := &cometdv1alpha1.CometLicenseIssuer{}
+			Expect(dst.ConvertFrom(hub)).To(Succeed())
+			Expect(dst).To(Equal(src))
+		})
+
+		It("round-trips the token Secret and server quota", func() {
+			src := &cometdv1alpha1.CometLicenseIssuer{
+				ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"},
+				Spec: cometdv1alpha1.CometLicenseIssuerSpec{
+					Auth: cometdv1alpha1.CometLicenseIssuerAuth{
+						Email: "admin@example.com",
+						TokenSecretRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "issuer-credentials"},
+							Key:                  "token",
+						},
+					},
+					MaxServers: 10,
+				},
+			}
+			hub := &cometdv1beta1.CometLicenseIssuer{}
+			Expect(src.ConvertTo(hub)).To(Succeed())
+			Expect(hub.Spec.Auth.TokenSecretRef.Name).To(Equal("issuer-credentials"))
+			Expect(hub.Spec.MaxServers).To(Equal(10))
+			dst := &cometdv1alpha1.CometLicenseIssuer{}
+			Expect(dst.ConvertFrom(hub)).To(Succeed())
+			Expect(dst).To(Equal(src))
+		})
+	})
+
+	Describe("License features", func() {
+		// ruleFeatures returns the feature names rejected in additional by the CRD's CEL rule
+		ruleFeatures := func() []string {
+			data, err := os.ReadFile(filepath.Join("..", "..", "config", "crd", "bases", "cometd.cometbackup.com_cometservers.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			crd := string(data)
+			start := strings.Index(crd, "rule: self.all(name, !(name in [")
+			Expect(start).NotTo(Equal(-1))
+			end := strings.Index(crd[start:], "]))")
+			Expect(end).NotTo(Equal(-1))
+			var names []string
+			for _, m := range regexp.MustCompile(`'([A-Z0-9_]+)'`).FindAllStringSubmatch(crd[start:start+end], -1) {
+				names = append(names, m[1])
+			}
+			return names
+		}
+
+		It("rejects exactly the known features in additional", func() {
+			flag := cometdv1beta1.CometLicenseFlag(1)
+			devices := 10
+			all := cometdv1beta1.CometLicenseFeatures{
+				Roles:          cometdv1beta1.CometLicenseRoles{StorageRole: &flag, AuthRole: &flag, SoftwareBuildRole: &flag, ConstellationRole: &flag},
+				Boosters:       cometdv1beta1.CometLicenseBoosters{MSSQL: &flag, Exchange: &flag, HyperV: &flag, MySQL: &flag, MongoDB: &flag, DiskImage: &flag, SystemState: &flag, Microsoft365: &flag},
+				MaximumDevices: &devices,
+			}
+			known := []string{}
+			for name := range all.ToMap() {
+				known = append(known, name)
+			}
+			Expect(ruleFeatures()).To(ConsistOf(known))
+		})
+	})
+})
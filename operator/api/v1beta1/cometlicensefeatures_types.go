@@ -0,0 +1,163 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// Names of the license features known to the operator, as used by account.cometbackup.com.
+const (
+	LicenseFeatureStorageRole       = "LIFT_STORAGE_ROLE"
+	LicenseFeatureAuthRole          = "LIFT_AUTH_ROLE"
+	LicenseFeatureSoftwareBuildRole = "LIFT_SOFTWARE_BUILD_ROLE"
+	LicenseFeatureConstellationRole = "LIFT_CONSTELLATION_ROLE"
+
+	LicenseFeatureMSSQL        = "BOOSTER_MSSQL"
+	LicenseFeatureExchange     = "BOOSTER_EXCHANGE"
+	LicenseFeatureHyperV       = "BOOSTER_HYPERV"
+	LicenseFeatureMySQL        = "BOOSTER_MYSQL"
+	LicenseFeatureMongoDB      = "BOOSTER_MONGODB"
+	LicenseFeatureDiskImage    = "BOOSTER_DISK_IMAGE"
+	LicenseFeatureSystemState  = "BOOSTER_SYSTEM_STATE"
+	LicenseFeatureMicrosoft365 = "BOOSTER_MICROSOFT_365"
+
+	LicenseFeatureMaximumDevices = "MAX_DEVICES"
+)
+
+// CometLicenseFlag disables (0) or enables (1) a license feature.
+// +kubebuilder:validation:Enum=0;1
+type CometLicenseFlag int
+
+// CometLicenseRoles are the Comet Server roles enabled by the license.
+type CometLicenseRoles struct {
+	// +optional
+	StorageRole *CometLicenseFlag `json:"storageRole,omitempty"`
+	// +optional
+	AuthRole *CometLicenseFlag `json:"authRole,omitempty"`
+	// +optional
+	SoftwareBuildRole *CometLicenseFlag `json:"softwareBuildRole,omitempty"`
+	// +optional
+	ConstellationRole *CometLicenseFlag `json:"constellationRole,omitempty"`
+}
+
+// CometLicenseBoosters are the backup engines enabled by the license.
+type CometLicenseBoosters struct {
+	// +optional
+	MSSQL *CometLicenseFlag `json:"mssql,omitempty"`
+	// +optional
+	Exchange *CometLicenseFlag `json:"exchange,omitempty"`
+	// +optional
+	HyperV *CometLicenseFlag `json:"hyperV,omitempty"`
+	// +optional
+	MySQL *CometLicenseFlag `json:"mysql,omitempty"`
+	// +optional
+	MongoDB *CometLicenseFlag `json:"mongodb,omitempty"`
+	// +optional
+	DiskImage *CometLicenseFlag `json:"diskImage,omitempty"`
+	// +optional
+	SystemState *CometLicenseFlag `json:"systemState,omitempty"`
+	// +optional
+	Microsoft365 *CometLicenseFlag `json:"microsoft365,omitempty"`
+}
+
+// CometLicenseFeatures are the features of a serial number. Features left unset keep the
+// account.cometbackup.com default, which enables everything.
+type CometLicenseFeatures struct {
+	// +optional
+	Roles CometLicenseRoles `json:"roles,omitempty"`
+
+	// +optional
+	Boosters CometLicenseBoosters `json:"boosters,omitempty"`
+
+	// MaximumDevices caps the number of devices. Unlimited if unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaximumDevices *int `json:"maximumDevices,omitempty"`
+
+	// Additional features the operator doesn't know about yet, by their account.cometbackup.com
+	// name. They are sent as-is, so are not validated. Known features are rejected, and must be
+	// set through their fields above.
+	// +kubebuilder:validation:XValidation:rule="self.all(name, !(name in ['LIFT_STORAGE_ROLE', 'LIFT_AUTH_ROLE', 'LIFT_SOFTWARE_BUILD_ROLE', 'LIFT_CONSTELLATION_ROLE', 'BOOSTER_MSSQL', 'BOOSTER_EXCHANGE', 'BOOSTER_HYPERV', 'BOOSTER_MYSQL', 'BOOSTER_MONGODB', 'BOOSTER_DISK_IMAGE', 'BOOSTER_SYSTEM_STATE', 'BOOSTER_MICROSOFT_365', 'MAX_DEVICES']))",message="known features must be set through their typed fields, not additional"
+	// +optional
+	Additional map[string]int `json:"additional,omitempty"`
+}
+
+// flags maps the name of every known flag to its field.
+func (f *CometLicenseFeatures) flags() map[string]**CometLicenseFlag {
+	return map[string]**CometLicenseFlag{
+		LicenseFeatureStorageRole:       &f.Roles.StorageRole,
+		LicenseFeatureAuthRole:          &f.Roles.AuthRole,
+		LicenseFeatureSoftwareBuildRole: &f.Roles.SoftwareBuildRole,
+		LicenseFeatureConstellationRole: &f.Roles.ConstellationRole,
+		LicenseFeatureMSSQL:             &f.Boosters.MSSQL,
+		LicenseFeatureExchange:          &f.Boosters.Exchange,
+		LicenseFeatureHyperV:            &f.Boosters.HyperV,
+		LicenseFeatureMySQL:             &f.Boosters.MySQL,
+		LicenseFeatureMongoDB:           &f.Boosters.MongoDB,
+		LicenseFeatureDiskImage:         &f.Boosters.DiskImage,
+		LicenseFeatureSystemState:       &f.Boosters.SystemState,
+		LicenseFeatureMicrosoft365:      &f.Boosters.Microsoft365,
+	}
+}
+
+// IsLicenseFlag reports whether name is a known license feature which is either on or off.
+func IsLicenseFlag(name string) bool {
+	_, ok := (&CometLicenseFeatures{}).flags()[name]
+	return ok
+}
+
+// IsKnownLicenseFeature reports whether name is a license feature known to the operator.
+func IsKnownLicenseFeature(name string) bool {
+	return IsLicenseFlag(name) || name == LicenseFeatureMaximumDevices
+}
+
+// ToMap returns the features which are set, by their account.cometbackup.com name.
+func (f *CometLicenseFeatures) ToMap() map[string]int {
+	out := map[string]int{}
+	for name, value := range f.Additional {
+		out[name] = value
+	}
+	for name, flag := range f.flags() {
+		if *flag != nil {
+			out[name] = int(**flag)
+		}
+	}
+	if f.MaximumDevices != nil {
+		out[LicenseFeatureMaximumDevices] = *f.MaximumDevices
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// FromMap replaces the features with those named in features. Unknown names are kept in Additional.
+func (f *CometLicenseFeatures) FromMap(features map[string]int) {
+	*f = CometLicenseFeatures{}
+	flags := f.flags()
+	for name, value := range features {
+		value := value
+		if flag, ok := flags[name]; ok {
+			v := CometLicenseFlag(value)
+			*flag = &v
+		} else if name == LicenseFeatureMaximumDevices {
+			f.MaximumDevices = &value
+		} else {
+			if f.Additional == nil {
+				f.Additional = map[string]int{}
+			}
+			f.Additional[name] = value
+		}
+	}
+}
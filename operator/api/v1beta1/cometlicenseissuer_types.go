@@ -0,0 +1,82 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CometLicenseIssuerAuth defines the API authentication for account.cometbackup.com
+type CometLicenseIssuerAuth struct {
+	// Email address of the account.cometbackup.com account.
+	Email string `json:"email"`
+
+	// Token is an API token of the account.cometbackup.com account. Prefer TokenSecretRef, which
+	// keeps the token out of the resource.
+	// +optional
+	Token string `json:"token,omitempty"`
+
+	// TokenSecretRef selects the Secret key holding the API token, in place of Token.
+	// +optional
+	TokenSecretRef *corev1.SecretKeySelector `json:"tokenSecretRef,omitempty"`
+}
+
+// CometLicenseIssuerSpec defines the desired state of CometLicenseIssuer
+type CometLicenseIssuerSpec struct {
+	Auth CometLicenseIssuerAuth `json:"auth"`
+
+	// Features enabled on every serial number issued, unless the CometServer sets its own.
+	// +optional
+	Features CometLicenseFeatures `json:"features,omitempty"`
+
+	// MaxServers caps the number of CometServers holding a serial number issued by this issuer.
+	// Unlimited if zero.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxServers int `json:"maxServers,omitempty"`
+}
+
+// CometLicenseIssuerStatus defines the observed state of CometLicenseIssuer
+type CometLicenseIssuerStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// CometLicenseIssuer is the Schema for the cometlicenseissuers API
+type CometLicenseIssuer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CometLicenseIssuerSpec   `json:"spec,omitempty"`
+	Status CometLicenseIssuerStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CometLicenseIssuerList contains a list of CometLicenseIssuer
+type CometLicenseIssuerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CometLicenseIssuer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CometLicenseIssuer{}, &CometLicenseIssuerList{})
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CometServerLicense defines how the serial number of the Comet Server is issued.
+type CometServerLicense struct {
+	// IssuerRef is the CometLicenseIssuer, in the same namespace, which issues the serial number.
+	IssuerRef corev1.LocalObjectReference `json:"issuerRef"`
+
+	// Features to enable on the serial number. All features are enabled if unset.
+	// +optional
+	Features CometLicenseFeatures `json:"features,omitempty"`
+}
+
+// CometServerIngress defines how the Comet Server is exposed.
+type CometServerIngress struct {
+	// Host is the domain the Comet Server is served under, as <name>.<host>.
+	Host string `json:"host"`
+}
+
+// CometServerAdmin defines the administrator account used by the operator.
+type CometServerAdmin struct {
+	// SecretRef names a Secret with `username` and `password` keys to use as the admin
+	// credentials. If unset, a password is generated for the "admin" user. Changes to the
+	// Secret are applied to the running Comet Server through the admin API.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// CometServerConfig defines the Comet Server configuration (cometd.cfg). When set, the
+// operator owns the configuration file and overwrites it before every start up. Declared
+// settings changed on the running Comet Server are reverted through the admin API.
+type CometServerConfig struct {
+	// ConfigMapKeyRef selects a ConfigMap key containing a cometd.cfg JSON document.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a Secret key containing a cometd.cfg JSON document.
+	// Use this in place of ConfigMapKeyRef when the configuration contains credentials.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+
+	// Inline cometd.cfg settings. These are merged over the top of any referenced configuration.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +optional
+	Inline *runtime.RawExtension `json:"inline,omitempty"`
+}
+
+// CometServerRestore pre-populates the data volume of a new CometServer. Exactly one of
+// BackupRef, VolumeSnapshotRef or S3 must be set.
+//
+// The admin credentials must match an admin account in the restored data - set
+// spec.admin.secretRef, unless restoring a CometServerBackup whose server's admin Secret
+// still exists.
+type CometServerRestore struct {
+	// BackupRef is a CometServerBackup, in the same namespace, to restore.
+	// +optional
+	BackupRef *corev1.LocalObjectReference `json:"backupRef,omitempty"`
+
+	// VolumeSnapshotRef is a VolumeSnapshot of a Comet Server data volume, in the same
+	// namespace, to restore.
+	// +optional
+	VolumeSnapshotRef *corev1.LocalObjectReference `json:"volumeSnapshotRef,omitempty"`
+
+	// S3 downloads a tarball of a Comet Server data directory from object storage.
+	// +optional
+	S3 *CometServerRestoreS3Source `json:"s3,omitempty"`
+
+	// SerialNumber of the restored Comet Server, kept if no other CometServer is using it.
+	// Defaults to the serial number recorded by the CometServerBackup. A new serial number is
+	// issued if unset or in use.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+type CometServerRestoreS3Source struct {
+	// Endpoint of the S3-compatible object storage, e.g. s3.wasabisys.com
+	Endpoint string `json:"endpoint"`
+
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	Bucket string `json:"bucket"`
+
+	// Key of the .tar.gz object to restore.
+	Key string `json:"key"`
+
+	// CredentialsSecretRef is a Secret with accessKeyID and secretAccessKey keys.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// CometServerClone copies the data volume of another CometServer into a new CometServer, through
+// a VolumeSnapshot. The clone is always issued a new serial number.
+type CometServerClone struct {
+	// ServerRef is the CometServer, in the same namespace, to clone.
+	ServerRef corev1.LocalObjectReference `json:"serverRef"`
+
+	// VolumeSnapshotClassName of the snapshot of the source data volume. Uses the cluster
+	// default if unset.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+
+	// DisableOutbound turns off email, webhooks, PSA integrations, self-backups, the
+	// Constellation role and all scheduled jobs in the clone's configuration, so it doesn't act
+	// on behalf of the source.
+	// +kubebuilder:default=true
+	// +optional
+	DisableOutbound bool `json:"disableOutbound,omitempty"`
+}
+
+// CometServerDeletionPolicy decides what happens to the data volume when the CometServer is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;Snapshot
+type CometServerDeletionPolicy string
+
+const (
+	// CometServerDeletionPolicyDelete deletes the data volume with the CometServer.
+	CometServerDeletionPolicyDelete CometServerDeletionPolicy = "Delete"
+	// CometServerDeletionPolicyRetain keeps the data volume, and the <name>-admin Secret
+	// holding the admin credentials stored on it. A CometServer of the same name reuses both.
+	CometServerDeletionPolicyRetain CometServerDeletionPolicy = "Retain"
+	// CometServerDeletionPolicySnapshot takes a final CometServerBackup, named <name>-final, to
+	// a VolumeSnapshot before the data volume is deleted.
+	CometServerDeletionPolicySnapshot CometServerDeletionPolicy = "Snapshot"
+)
+
+type CometServerStorage struct {
+	// Size of the data volume. Defaults to 8Gi. The volume can be grown, if its storage class
+	// allows expansion, but never shrunk.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// DeletionPolicy for the data volume when the CometServer is deleted.
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy CometServerDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// VolumeSnapshotClassName of the final snapshot taken by the Snapshot deletion policy.
+	// Uses the cluster default if unset.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// CometServerSpec defines the desired state of CometServer
+type CometServerSpec struct {
+	// Version of the Comet Server, a tag of the ghcr.io/cometbackup/comet-server image.
+	Version string `json:"version"`
+
+	License CometServerLicense `json:"license"`
+	Ingress CometServerIngress `json:"ingress"`
+
+	// +optional
+	Admin CometServerAdmin `json:"admin,omitempty"`
+
+	// +optional
+	Config *CometServerConfig `json:"config,omitempty"`
+
+	// RestoreFrom populates the data volume from a backup before the Comet Server first starts.
+	// Only applied when the CometServer is created.
+	// +optional
+	RestoreFrom *CometServerRestore `json:"restoreFrom,omitempty"`
+
+	// CloneFrom populates the data volume with a copy of another CometServer before the Comet
+	// Server first starts. Only applied when the CometServer is created. Mutually exclusive with
+	// RestoreFrom.
+	// +optional
+	CloneFrom *CometServerClone `json:"cloneFrom,omitempty"`
+
+	// Storage configures the data volume.
+	// +optional
+	Storage CometServerStorage `json:"storage,omitempty"`
+
+	// DeletionProtection rejects deletion of the CometServer until it is cleared.
+	// +optional
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// Suspend scales the Comet Server to zero, keeping its data volume, serial number and
+	// ingress. Clear it to start the Comet Server again.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// LogFiles runs a sidecar following the Comet Server's log files on the data volume, so that
+	// they can be viewed on the frontend alongside the container logs.
+	// +optional
+	LogFiles bool `json:"logFiles,omitempty"`
+
+	// Resources of the Comet Server container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// CometServerStatus defines the observed state of CometServer
+type CometServerStatus struct {
+	// ConfigHash is the hash of the configuration last rendered into cometd.cfg.
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Conditions represent the latest available observations of the CometServer's state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// CometServer is the Schema for the cometservers API
+type CometServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CometServerSpec   `json:"spec,omitempty"`
+	Status CometServerStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CometServerList contains a list of CometServer
+type CometServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CometServer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CometServer{}, &CometServerList{})
+}
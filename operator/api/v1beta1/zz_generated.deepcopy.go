@@ -0,0 +1,538 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseBoosters) DeepCopyInto(out *CometLicenseBoosters) {
+	*out = *in
+	if in.MSSQL != nil {
+		in, out := &in.MSSQL, &out.MSSQL
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.Exchange != nil {
+		in, out := &in.Exchange, &out.Exchange
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.HyperV != nil {
+		in, out := &in.HyperV, &out.HyperV
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.MySQL != nil {
+		in, out := &in.MySQL, &out.MySQL
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.MongoDB != nil {
+		in, out := &in.MongoDB, &out.MongoDB
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.DiskImage != nil {
+		in, out := &in.DiskImage, &out.DiskImage
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.SystemState != nil {
+		in, out := &in.SystemState, &out.SystemState
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.Microsoft365 != nil {
+		in, out := &in.Microsoft365, &out.Microsoft365
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseBoosters.
+func (in *CometLicenseBoosters) DeepCopy() *CometLicenseBoosters {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseBoosters)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseFeatures) DeepCopyInto(out *CometLicenseFeatures) {
+	*out = *in
+	in.Roles.DeepCopyInto(&out.Roles)
+	in.Boosters.DeepCopyInto(&out.Boosters)
+	if in.MaximumDevices != nil {
+		in, out := &in.MaximumDevices, &out.MaximumDevices
+		*out = new(int)
+		**out = **in
+	}
+	if in.Additional != nil {
+		in, out := &in.Additional, &out.Additional
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseFeatures.
+func (in *CometLicenseFeatures) DeepCopy() *CometLicenseFeatures {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseFeatures)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseIssuer) DeepCopyInto(out *CometLicenseIssuer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseIssuer.
+func (in *CometLicenseIssuer) DeepCopy() *CometLicenseIssuer {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseIssuer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CometLicenseIssuer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseIssuerAuth) DeepCopyInto(out *CometLicenseIssuerAuth) {
+	*out = *in
+	if in.TokenSecretRef != nil {
+		in, out := &in.TokenSecretRef, &out.TokenSecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseIssuerAuth.
+func (in *CometLicenseIssuerAuth) DeepCopy() *CometLicenseIssuerAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseIssuerAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseIssuerList) DeepCopyInto(out *CometLicenseIssuerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CometLicenseIssuer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseIssuerList.
+func (in *CometLicenseIssuerList) DeepCopy() *CometLicenseIssuerList {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseIssuerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CometLicenseIssuerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseIssuerSpec) DeepCopyInto(out *CometLicenseIssuerSpec) {
+	*out = *in
+	in.Auth.DeepCopyInto(&out.Auth)
+	in.Features.DeepCopyInto(&out.Features)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseIssuerSpec.
+func (in *CometLicenseIssuerSpec) DeepCopy() *CometLicenseIssuerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseIssuerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseIssuerStatus) DeepCopyInto(out *CometLicenseIssuerStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseIssuerStatus.
+func (in *CometLicenseIssuerStatus) DeepCopy() *CometLicenseIssuerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseIssuerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometLicenseRoles) DeepCopyInto(out *CometLicenseRoles) {
+	*out = *in
+	if in.StorageRole != nil {
+		in, out := &in.StorageRole, &out.StorageRole
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.AuthRole != nil {
+		in, out := &in.AuthRole, &out.AuthRole
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.SoftwareBuildRole != nil {
+		in, out := &in.SoftwareBuildRole, &out.SoftwareBuildRole
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+	if in.ConstellationRole != nil {
+		in, out := &in.ConstellationRole, &out.ConstellationRole
+		*out = new(CometLicenseFlag)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometLicenseRoles.
+func (in *CometLicenseRoles) DeepCopy() *CometLicenseRoles {
+	if in == nil {
+		return nil
+	}
+	out := new(CometLicenseRoles)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServer) DeepCopyInto(out *CometServer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServer.
+func (in *CometServer) DeepCopy() *CometServer {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CometServer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerAdmin) DeepCopyInto(out *CometServerAdmin) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerAdmin.
+func (in *CometServerAdmin) DeepCopy() *CometServerAdmin {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerAdmin)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerClone) DeepCopyInto(out *CometServerClone) {
+	*out = *in
+	out.ServerRef = in.ServerRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerClone.
+func (in *CometServerClone) DeepCopy() *CometServerClone {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerClone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerConfig) DeepCopyInto(out *CometServerConfig) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Inline != nil {
+		in, out := &in.Inline, &out.Inline
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerConfig.
+func (in *CometServerConfig) DeepCopy() *CometServerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerIngress) DeepCopyInto(out *CometServerIngress) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerIngress.
+func (in *CometServerIngress) DeepCopy() *CometServerIngress {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerIngress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerLicense) DeepCopyInto(out *CometServerLicense) {
+	*out = *in
+	out.IssuerRef = in.IssuerRef
+	in.Features.DeepCopyInto(&out.Features)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerLicense.
+func (in *CometServerLicense) DeepCopy() *CometServerLicense {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerLicense)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerList) DeepCopyInto(out *CometServerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CometServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerList.
+func (in *CometServerList) DeepCopy() *CometServerList {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CometServerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerRestore) DeepCopyInto(out *CometServerRestore) {
+	*out = *in
+	if in.BackupRef != nil {
+		in, out := &in.BackupRef, &out.BackupRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.VolumeSnapshotRef != nil {
+		in, out := &in.VolumeSnapshotRef, &out.VolumeSnapshotRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(CometServerRestoreS3Source)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerRestore.
+func (in *CometServerRestore) DeepCopy() *CometServerRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerRestoreS3Source) DeepCopyInto(out *CometServerRestoreS3Source) {
+	*out = *in
+	out.CredentialsSecretRef = in.CredentialsSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerRestoreS3Source.
+func (in *CometServerRestoreS3Source) DeepCopy() *CometServerRestoreS3Source {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerRestoreS3Source)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerSpec) DeepCopyInto(out *CometServerSpec) {
+	*out = *in
+	in.License.DeepCopyInto(&out.License)
+	out.Ingress = in.Ingress
+	in.Admin.DeepCopyInto(&out.Admin)
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(CometServerConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RestoreFrom != nil {
+		in, out := &in.RestoreFrom, &out.RestoreFrom
+		*out = new(CometServerRestore)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CloneFrom != nil {
+		in, out := &in.CloneFrom, &out.CloneFrom
+		*out = new(CometServerClone)
+		**out = **in
+	}
+	in.Storage.DeepCopyInto(&out.Storage)
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerSpec.
+func (in *CometServerSpec) DeepCopy() *CometServerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerStatus) DeepCopyInto(out *CometServerStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerStatus.
+func (in *CometServerStatus) DeepCopy() *CometServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CometServerStorage) DeepCopyInto(out *CometServerStorage) {
+	*out = *in
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CometServerStorage.
+func (in *CometServerStorage) DeepCopy() *CometServerStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(CometServerStorage)
+	in.DeepCopyInto(out)
+	return out
+}
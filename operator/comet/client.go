@@ -0,0 +1,255 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package comet is a client for the Comet Server admin API.
+package comet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// Client calls the admin API of a single Comet Server, authenticating as an admin user.
+type Client struct {
+	BaseURL    string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the Comet Server at baseURL (e.g. http://cometd:8060).
+func NewClient(baseURL, username, password string) *Client {
+	return &Client{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		Username: username,
+		Password: password,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// ForServer returns a Client for the CometServer, addressed through its <name>-service and
+// authenticated with the credentials in its <name>-admin secret.
+func ForServer(ctx context.Context, c client.Reader, cs *cometdv1alpha1.CometServer) (*Client, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: cs.AdminSecretName(), Namespace: cs.Namespace}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin credentials: %w", err)
+	}
+	return NewClient(ServerURL(cs), string(secret.Data["username"]), string(secret.Data["password"])), nil
+}
+
+// ServerURL is the in-cluster address of the CometServer's admin API. Tests replace it to reach
+// a comettest server.
+var ServerURL = func(cs *cometdv1alpha1.CometServer) string {
+	return fmt.Sprintf("http://%s-service.%s.svc:8060", cs.Name, cs.Namespace)
+}
+
+// Error is returned for any non-successful admin API response.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("comet: HTTP-%d: %s", e.StatusCode, e.Message)
+}
+
+// IsUnauthorized reports whether err, or any error it wraps, is an authentication failure.
+func IsUnauthorized(err error) bool {
+	e := &Error{}
+	return errors.As(err, &e) && (e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden)
+}
+
+// IsNotFound reports whether err, or any error it wraps, is a missing user or resource.
+func IsNotFound(err error) bool {
+	e := &Error{}
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// Health returns nil if the Comet Server is up and accepting the admin credentials.
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.Version(ctx)
+	return err
+}
+
+// Version returns the version and license information of the Comet Server.
+func (c *Client) Version(ctx context.Context) (*ServerMetaVersionInfo, error) {
+	out := &ServerMetaVersionInfo{}
+	if err := c.call(ctx, "/api/v1/admin/meta/version", nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListUsers returns the usernames of all customer accounts.
+func (c *Client) ListUsers(ctx context.Context) ([]string, error) {
+	var out []string
+	if err := c.call(ctx, "/api/v1/admin/list-users", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UserCount returns the number of customer accounts.
+func (c *Client) UserCount(ctx context.Context) (int, error) {
+	users, err := c.ListUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(users), nil
+}
+
+// AddUser creates a customer account. A recovery code is stored for the account, so that its
+// password can later be reset by an admin.
+func (c *Client) AddUser(ctx context.Context, username, password string) error {
+	params := url.Values{
+		"TargetUser":        []string{username},
+		"TargetPassword":    []string{password},
+		"StoreRecoveryCode": []string{"1"},
+	}
+	return c.call(ctx, "/api/v1/admin/add-user", params, nil)
+}
+
+// DeleteUser deletes a customer account, and all its data.
+func (c *Client) DeleteUser(ctx context.Context, username string) error {
+	params := url.Values{"TargetUser": []string{username}}
+	return c.call(ctx, "/api/v1/admin/delete-user", params, nil)
+}
+
+// ResetUserPassword replaces the password of a customer account.
+func (c *Client) ResetUserPassword(ctx context.Context, username, password string) error {
+	params := url.Values{
+		"TargetUser":  []string{username},
+		"NewPassword": []string{password},
+		"OldPassword": []string{""},
+	}
+	return c.call(ctx, "/api/v1/admin/reset-user-password", params, nil)
+}
+
+// UserProfile returns the profile of a customer account.
+func (c *Client) UserProfile(ctx context.Context, username string) (map[string]interface{}, error) {
+	params := url.Values{"TargetUser": []string{username}}
+	out := map[string]interface{}{}
+	if err := c.call(ctx, "/api/v1/admin/get-user-profile", params, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetUserProfile replaces the profile of a customer account.
+func (c *Client) SetUserProfile(ctx context.Context, username string, profile map[string]interface{}) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	params := url.Values{
+		"TargetUser":  []string{username},
+		"ProfileData": []string{string(data)},
+	}
+	return c.call(ctx, "/api/v1/admin/set-user-profile", params, nil)
+}
+
+// ServerConfig returns the Comet Server's settings (the contents of cometd.cfg).
+func (c *Client) ServerConfig(ctx context.Context) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	if err := c.call(ctx, "/api/v1/admin/meta/server-config/get", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetServerConfig replaces the Comet Server's settings.
+func (c *Client) SetServerConfig(ctx context.Context, cfg map[string]interface{}) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	params := url.Values{"Config": []string{string(data)}}
+	return c.call(ctx, "/api/v1/admin/meta/server-config/set", params, nil)
+}
+
+// TestRemoteStorage asks the Comet Server to connect to the storage template's object storage.
+// Returns nil if the connection succeeded.
+func (c *Client) TestRemoteStorage(ctx context.Context, opt RemoteStorageOption) error {
+	data, err := json.Marshal(opt)
+	if err != nil {
+		return err
+	}
+	params := url.Values{"TemplateOptions": []string{string(data)}}
+	return c.call(ctx, "/api/v1/admin/meta/remote-storage-vault/test", params, nil)
+}
+
+// call POSTs the params to the admin API endpoint and decodes the response into out. If out is
+// nil, the response must be a successful APIResponseMessage.
+func (c *Client) call(ctx context.Context, endpoint string, params url.Values, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("Username", c.Username)
+	params.Set("AuthType", "Password")
+	params.Set("Password", c.Password)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := APIResponseMessage{}
+		if err := json.Unmarshal(body, &msg); err != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(body))
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: msg.Message}
+	}
+
+	if out == nil {
+		msg := APIResponseMessage{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return err
+		}
+		if msg.Status >= 400 {
+			return &Error{StatusCode: msg.Status, Message: msg.Message}
+		}
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comet_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/cometbackup/comet-server-operator/comet/comettest"
+)
+
+var _ = Describe("Client", func() {
+	var srv *comettest.Server
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		srv = comettest.NewServer("admin", "s3cret")
+		DeferCleanup(srv.Close)
+	})
+
+	It("reports the server version", func() {
+		srv.SetVersion("23.6.0")
+		info, err := srv.AdminClient().Version(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Version).To(Equal("23.6.0"))
+		Expect(srv.AdminClient().Health(ctx)).To(Succeed())
+	})
+
+	It("counts customer accounts", func() {
+		srv.AddUser("alice")
+		srv.AddUser("bob")
+		count, err := srv.AdminClient().UserCount(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(2))
+	})
+
+	It("manages customer accounts", func() {
+		c := srv.AdminClient()
+		Expect(c.AddUser(ctx, "alice", "pa55")).To(Succeed())
+		Expect(c.AddUser(ctx, "alice", "pa55")).NotTo(Succeed())
+
+		Expect(c.ResetUserPassword(ctx, "alice", "n3w")).To(Succeed())
+		password, _ := srv.UserPassword("alice")
+		Expect(password).To(Equal("n3w"))
+
+		profile, err := c.UserProfile(ctx, "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(profile).NotTo(HaveKey("Password"))
+		profile["AccountName"] = "Alice"
+		Expect(c.SetUserProfile(ctx, "alice", profile)).To(Succeed())
+		profile, err = c.UserProfile(ctx, "alice")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(profile).To(HaveKeyWithValue("AccountName", "Alice"))
+
+		Expect(c.DeleteUser(ctx, "alice")).To(Succeed())
+		_, exists := srv.UserPassword("alice")
+		Expect(exists).To(BeFalse())
+		Expect(comet.IsNotFound(c.DeleteUser(ctx, "alice"))).To(BeTrue())
+	})
+
+	It("reads and writes the server settings", func() {
+		c := srv.AdminClient()
+		Expect(c.SetServerConfig(ctx, map[string]interface{}{"LogLevel": "debug"})).To(Succeed())
+		cfg, err := c.ServerConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg).To(HaveKeyWithValue("LogLevel", "debug"))
+	})
+
+	It("rejects invalid credentials", func() {
+		err := comet.NewClient(srv.URL, "admin", "wrong").Health(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(comet.IsUnauthorized(err)).To(BeTrue())
+		Expect(comet.IsUnauthorized(fmt.Errorf("failed to connect: %w", err))).To(BeTrue())
+		Expect(comet.IsNotFound(fmt.Errorf("failed to connect: %w", err))).To(BeFalse())
+	})
+})
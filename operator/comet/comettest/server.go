@@ -0,0 +1,252 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package comettest provides an in-memory fake of the Comet Server admin API for tests.
+package comettest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cometbackup/comet-server-operator/comet"
+)
+
+// Server is a fake Comet Server, accepting a single admin account.
+type Server struct {
+	*httptest.Server
+
+	Username string
+	Password string
+
+	mu      sync.Mutex
+	version string
+	users   map[string]map[string]interface{}
+	config  map[string]interface{}
+}
+
+// NewServer starts a fake Comet Server. Call Close when finished.
+func NewServer(username, password string) *Server {
+	s := &Server{
+		Username: username,
+		Password: password,
+		version:  "23.5.0",
+		users:    map[string]map[string]interface{}{},
+		config:   map[string]interface{}{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/admin/meta/version", s.admin(s.metaVersion))
+	mux.HandleFunc("/api/v1/admin/list-users", s.admin(s.listUsers))
+	mux.HandleFunc("/api/v1/admin/add-user", s.admin(s.addUser))
+	mux.HandleFunc("/api/v1/admin/delete-user", s.admin(s.deleteUser))
+	mux.HandleFunc("/api/v1/admin/reset-user-password", s.admin(s.resetUserPassword))
+	mux.HandleFunc("/api/v1/admin/get-user-profile", s.admin(s.getUserProfile))
+	mux.HandleFunc("/api/v1/admin/set-user-profile", s.admin(s.setUserProfile))
+	mux.HandleFunc("/api/v1/admin/meta/server-config/get", s.admin(s.serverConfigGet))
+	mux.HandleFunc("/api/v1/admin/meta/server-config/set", s.admin(s.serverConfigSet))
+	mux.HandleFunc("/api/v1/admin/meta/remote-storage-vault/test", s.admin(s.remoteStorageVaultTest))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AdminClient returns a comet.Client authenticated as the fake server's admin.
+func (s *Server) AdminClient() *comet.Client {
+	return comet.NewClient(s.URL, s.Username, s.Password)
+}
+
+// SetVersion sets the version reported by the fake server.
+func (s *Server) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// AddUser adds a customer account to the fake server.
+func (s *Server) AddUser(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = map[string]interface{}{"Username": username}
+}
+
+// UserPassword returns the password of a customer account, and whether the account exists.
+func (s *Server) UserPassword(username string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile, ok := s.users[username]
+	if !ok {
+		return "", false
+	}
+	password, _ := profile["Password"].(string)
+	return password, true
+}
+
+// Config returns a copy of the fake server's settings.
+func (s *Server) Config() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyConfig(s.config)
+}
+
+// --
+
+func (s *Server) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, &comet.APIResponseMessage{Status: 405, Message: "Method not allowed"})
+			return
+		}
+		if r.FormValue("Username") != s.Username || r.FormValue("Password") != s.Password {
+			writeJSON(w, http.StatusForbidden, &comet.APIResponseMessage{Status: 403, Message: "Invalid user account"})
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		h(w, r)
+	}
+}
+
+func (s *Server) metaVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &comet.ServerMetaVersionInfo{
+		Version:                  s.version,
+		ServerLicenseFeaturesAll: true,
+	})
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	users := make([]string, 0, len(s.users))
+	for u := range s.users {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) addUser(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("TargetUser")
+	if _, ok := s.users[username]; ok || username == "" {
+		writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 400, Message: "User already exists"})
+		return
+	}
+	s.users[username] = map[string]interface{}{"Username": username, "Password": r.FormValue("TargetPassword")}
+	writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 200, Message: "OK"})
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	if !s.userExists(w, r) {
+		return
+	}
+	delete(s.users, r.FormValue("TargetUser"))
+	writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 200, Message: "OK"})
+}
+
+func (s *Server) resetUserPassword(w http.ResponseWriter, r *http.Request) {
+	if !s.userExists(w, r) {
+		return
+	}
+	s.users[r.FormValue("TargetUser")]["Password"] = r.FormValue("NewPassword")
+	writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 200, Message: "OK"})
+}
+
+func (s *Server) getUserProfile(w http.ResponseWriter, r *http.Request) {
+	if !s.userExists(w, r) {
+		return
+	}
+	profile := copyConfig(s.users[r.FormValue("TargetUser")])
+	delete(profile, "Password")
+	writeJSON(w, http.StatusOK, profile)
+}
+
+func (s *Server) setUserProfile(w http.ResponseWriter, r *http.Request) {
+	if !s.userExists(w, r) {
+		return
+	}
+	profile := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(r.FormValue("ProfileData")), &profile); err != nil {
+		writeJSON(w, http.StatusBadRequest, &comet.APIResponseMessage{Status: 400, Message: err.Error()})
+		return
+	}
+	username := r.FormValue("TargetUser")
+	profile["Password"] = s.users[username]["Password"]
+	s.users[username] = profile
+	writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 200, Message: "OK"})
+}
+
+func (s *Server) userExists(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := s.users[r.FormValue("TargetUser")]; !ok {
+		writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 404, Message: "User not found"})
+		return false
+	}
+	return true
+}
+
+func (s *Server) serverConfigGet(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.config)
+}
+
+func (s *Server) serverConfigSet(w http.ResponseWriter, r *http.Request) {
+	cfg := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(r.FormValue("Config")), &cfg); err != nil {
+		writeJSON(w, http.StatusBadRequest, &comet.APIResponseMessage{Status: 400, Message: err.Error()})
+		return
+	}
+	s.config = cfg
+	writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 200, Message: "OK"})
+}
+
+// remoteStorageVaultTest connects to the S3 endpoint of the storage template, so tests can
+// point templates at a local S3-compatible stand-in.
+func (s *Server) remoteStorageVaultTest(w http.ResponseWriter, r *http.Request) {
+	opt := comet.RemoteStorageOption{}
+	if err := json.Unmarshal([]byte(r.FormValue("TemplateOptions")), &opt); err != nil {
+		writeJSON(w, http.StatusBadRequest, &comet.APIResponseMessage{Status: 400, Message: err.Error()})
+		return
+	}
+	if opt.Type == comet.RemoteStorageTypeS3 {
+		endpoint := opt.RemoteAddress
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get(endpoint)
+		if err != nil {
+			writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 500, Message: err.Error()})
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 500, Message: resp.Status})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, &comet.APIResponseMessage{Status: 200, Message: "OK"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func copyConfig(cfg map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(cfg)
+	out := map[string]interface{}{}
+	_ = json.Unmarshal(data, &out)
+	return out
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comet
+
+import (
+	"encoding/json"
+)
+
+// SetAdminUser adds the admin account to the server settings, or replaces the password of
+// the existing account with the same username. Returns true if the settings were changed.
+func SetAdminUser(cfg map[string]interface{}, username, password string) bool {
+	users, _ := cfg["AdminUsers"].([]interface{})
+	for _, u := range users {
+		user, ok := u.(map[string]interface{})
+		if !ok || user["Username"] != username {
+			continue
+		}
+		if user["Password"] == password && user["AllowPasswordLogin"] == true {
+			return false
+		}
+		user["PasswordFormat"] = PasswordFormatPlaintext
+		user["Password"] = password
+		user["AllowPasswordLogin"] = true
+		return true
+	}
+	cfg["AdminUsers"] = append(users, map[string]interface{}{
+		"Username":           username,
+		"PasswordFormat":     PasswordFormatPlaintext,
+		"Password":           password,
+		"AllowPasswordLogin": true,
+	})
+	return true
+}
+
+// HasAdminUser reports whether the server settings contain the admin account.
+func HasAdminUser(cfg map[string]interface{}, username string) bool {
+	users, _ := cfg["AdminUsers"].([]interface{})
+	for _, u := range users {
+		if user, ok := u.(map[string]interface{}); ok && user["Username"] == username {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveAdminUser removes the admin account from the server settings. Returns true if the
+// settings were changed.
+func RemoveAdminUser(cfg map[string]interface{}, username string) bool {
+	users, _ := cfg["AdminUsers"].([]interface{})
+	kept := make([]interface{}, 0, len(users))
+	for _, u := range users {
+		if user, ok := u.(map[string]interface{}); ok && user["Username"] == username {
+			continue
+		}
+		kept = append(kept, u)
+	}
+	if len(kept) == len(users) {
+		return false
+	}
+	cfg["AdminUsers"] = kept
+	return true
+}
+
+// DisableOutbound turns off the server settings which contact the outside world - email,
+// webhooks, PSA integrations, self-backups and the Constellation role - and clears every
+// schedule, so no scheduled job runs. Returns true if the settings were changed.
+func DisableOutbound(cfg map[string]interface{}) bool {
+	changed := false
+	set := func(section map[string]interface{}, key string, value interface{}) {
+		have, _ := json.Marshal(section[key])
+		want, _ := json.Marshal(value)
+		if string(have) != string(want) {
+			section[key] = value
+			changed = true
+		}
+	}
+	for _, key := range []string{"Email", "SelfBackup", "ConstellationRole"} {
+		if _, ok := cfg[key].(map[string]interface{}); !ok {
+			cfg[key] = map[string]interface{}{}
+		}
+	}
+	set(cfg["Email"].(map[string]interface{}), "Mode", "")
+	set(cfg["SelfBackup"].(map[string]interface{}), "Targets", []interface{}{})
+	set(cfg["ConstellationRole"].(map[string]interface{}), "RoleEnabled", false)
+	set(cfg, "WebhookOptions", map[string]interface{}{})
+	set(cfg, "PSAConfigs", []interface{}{})
+	return clearSchedules(cfg) || changed
+}
+
+// clearSchedules empties every Schedule and Schedules list nested in v, which is how the
+// server settings describe when a job runs. Returns true if any list was emptied.
+func clearSchedules(v interface{}) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if list, ok := child.([]interface{}); ok && (k == "Schedule" || k == "Schedules") {
+				if len(list) > 0 {
+					v[k] = []interface{}{}
+					changed = true
+				}
+				continue
+			}
+			changed = clearSchedules(child) || changed
+		}
+	case []interface{}:
+		for _, child := range v {
+			changed = clearSchedules(child) || changed
+		}
+	}
+	return changed
+}
+
+// SetRemoteStorage adds the storage template to the server settings, or updates the template
+// with the same description. Settings of an existing template not described by
+// RemoteStorageOption are kept. Returns true if the settings were changed.
+func SetRemoteStorage(cfg map[string]interface{}, opt RemoteStorageOption) bool {
+	want := map[string]interface{}{}
+	data, _ := json.Marshal(opt)
+	_ = json.Unmarshal(data, &want)
+
+	templates, _ := cfg["RemoteStorage"].([]interface{})
+	for _, t := range templates {
+		template, ok := t.(map[string]interface{})
+		if !ok || template["Description"] != opt.Description {
+			continue
+		}
+		changed := false
+		for k, v := range want {
+			if template[k] != v {
+				template[k] = v
+				changed = true
+			}
+		}
+		return changed
+	}
+	cfg["RemoteStorage"] = append(templates, want)
+	return true
+}
+
+// HasRemoteStorage reports whether the server settings contain a storage template with the
+// description.
+func HasRemoteStorage(cfg map[string]interface{}, description string) bool {
+	templates, _ := cfg["RemoteStorage"].([]interface{})
+	for _, t := range templates {
+		if template, ok := t.(map[string]interface{}); ok && template["Description"] == description {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveRemoteStorage removes the storage template with the description from the server
+// settings. Returns true if the settings were changed.
+func RemoveRemoteStorage(cfg map[string]interface{}, description string) bool {
+	templates, _ := cfg["RemoteStorage"].([]interface{})
+	kept := make([]interface{}, 0, len(templates))
+	for _, t := range templates {
+		if template, ok := t.(map[string]interface{}); ok && template["Description"] == description {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	if len(kept) == len(templates) {
+		return false
+	}
+	cfg["RemoteStorage"] = kept
+	return true
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comet_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/cometbackup/comet-server-operator/comet/comettest"
+)
+
+var _ = Describe("Storage templates", func() {
+	var srv *comettest.Server
+	var s3 *httptest.Server
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		srv = comettest.NewServer("admin", "s3cret")
+		DeferCleanup(srv.Close)
+		// A local stand-in for an S3-compatible server
+		s3 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(s3.Close)
+	})
+
+	It("adds, updates and removes a template in the server settings", func() {
+		cfg := map[string]interface{}{}
+		opt := comet.RemoteStorageOption{Type: comet.RemoteStorageTypeS3, Description: "Local", RemoteAddress: s3.URL}
+		Expect(comet.SetRemoteStorage(cfg, opt)).To(BeTrue())
+		Expect(comet.SetRemoteStorage(cfg, opt)).To(BeFalse())
+		Expect(comet.HasRemoteStorage(cfg, "Local")).To(BeTrue())
+
+		opt.Username = "key-id"
+		Expect(comet.SetRemoteStorage(cfg, opt)).To(BeTrue())
+		Expect(cfg["RemoteStorage"]).To(HaveLen(1))
+
+		Expect(comet.RemoveRemoteStorage(cfg, "Local")).To(BeTrue())
+		Expect(comet.HasRemoteStorage(cfg, "Local")).To(BeFalse())
+	})
+
+	It("tests connectivity to the object storage", func() {
+		opt := comet.RemoteStorageOption{Type: comet.RemoteStorageTypeS3, Description: "Local", RemoteAddress: s3.URL}
+		Expect(srv.AdminClient().TestRemoteStorage(ctx, opt)).To(Succeed())
+
+		s3.Close()
+		Expect(srv.AdminClient().TestRemoteStorage(ctx, opt)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Admin accounts", func() {
+	It("adds, updates and removes an admin in the server settings", func() {
+		cfg := map[string]interface{}{}
+		Expect(comet.SetAdminUser(cfg, "ops", "pa55")).To(BeTrue())
+		Expect(comet.HasAdminUser(cfg, "ops")).To(BeTrue())
+		Expect(comet.SetAdminUser(cfg, "ops", "pa55")).To(BeFalse())
+		Expect(comet.SetAdminUser(cfg, "ops", "n3w")).To(BeTrue())
+		Expect(cfg["AdminUsers"]).To(HaveLen(1))
+
+		Expect(comet.RemoveAdminUser(cfg, "ops")).To(BeTrue())
+		Expect(comet.HasAdminUser(cfg, "ops")).To(BeFalse())
+		Expect(comet.RemoveAdminUser(cfg, "ops")).To(BeFalse())
+	})
+})
+
+var _ = Describe("Outbound actions", func() {
+	It("disables email, webhooks, PSA, self-backups and Constellation", func() {
+		cfg := map[string]interface{}{
+			"Email":             map[string]interface{}{"Mode": "smtp", "FromEmail": "noreply@example.com"},
+			"WebhookOptions":    map[string]interface{}{"audit": map[string]interface{}{"URL": "https://example.com"}},
+			"PSAConfigs":        []interface{}{map[string]interface{}{"PartnerKey": "x"}},
+			"SelfBackup":        map[string]interface{}{"Targets": []interface{}{map[string]interface{}{}}},
+			"ConstellationRole": map[string]interface{}{"RoleEnabled": true},
+		}
+		Expect(comet.DisableOutbound(cfg)).To(BeTrue())
+		Expect(cfg["Email"]).To(HaveKeyWithValue("Mode", ""))
+		Expect(cfg["Email"]).To(HaveKeyWithValue("FromEmail", "noreply@example.com"))
+		Expect(cfg["WebhookOptions"]).To(BeEmpty())
+		Expect(cfg["PSAConfigs"]).To(BeEmpty())
+		Expect(cfg["SelfBackup"]).To(HaveKeyWithValue("Targets", BeEmpty()))
+		Expect(cfg["ConstellationRole"]).To(HaveKeyWithValue("RoleEnabled", false))
+
+		Expect(comet.DisableOutbound(cfg)).To(BeFalse())
+	})
+
+	It("clears the schedules of scheduled jobs", func() {
+		schedule := func() []interface{} {
+			return []interface{}{map[string]interface{}{"FrequencyType": 8001, "SecondsPast": 3600}}
+		}
+		cfg := map[string]interface{}{
+			"SelfBackup": map[string]interface{}{"Targets": []interface{}{map[string]interface{}{"Schedule": schedule()}}},
+			"ConstellationRole": map[string]interface{}{
+				"Reports": []interface{}{map[string]interface{}{"Schedules": schedule(), "Recipients": []interface{}{"ops@example.com"}}},
+			},
+		}
+		Expect(comet.DisableOutbound(cfg)).To(BeTrue())
+		reports := cfg["ConstellationRole"].(map[string]interface{})["Reports"].([]interface{})
+		Expect(reports[0]).To(HaveKeyWithValue("Schedules", BeEmpty()))
+		Expect(reports[0]).To(HaveKeyWithValue("Recipients", HaveLen(1)))
+
+		Expect(comet.DisableOutbound(cfg)).To(BeFalse())
+	})
+})
@@ -0,0 +1,50 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comet
+
+// APIResponseMessage is the generic response of admin API calls which return no data.
+type APIResponseMessage struct {
+	Status  int    `json:"Status"`
+	Message string `json:"Message"`
+}
+
+// ServerMetaVersionInfo describes the running Comet Server.
+type ServerMetaVersionInfo struct {
+	Version                  string `json:"Version"`
+	VersionCodename          string `json:"VersionCodename"`
+	ServerStartTime          int64  `json:"ServerStartTime"`
+	CurrentTime              int64  `json:"CurrentTime"`
+	ServerLicenseHash        string `json:"ServerLicenseHash"`
+	ServerLicenseFeaturesAll bool   `json:"ServerLicenseFeaturesAll"`
+	ServerLicenseFeatures    int    `json:"ServerLicenseFeatures"`
+	LicenseValidUntil        int64  `json:"LicenseValidUntil"`
+}
+
+// PasswordFormatPlaintext marks a password in the server settings as unhashed.
+const PasswordFormatPlaintext = 0
+
+// RemoteStorageTypeS3 is a generic S3-compatible storage template.
+const RemoteStorageTypeS3 = "s3"
+
+// RemoteStorageOption is a storage template, listed under RemoteStorage in the server settings.
+type RemoteStorageOption struct {
+	Type          string `json:"Type"`
+	Description   string `json:"Description"`
+	RemoteAddress string `json:"RemoteAddress"`
+	Username      string `json:"Username"`
+	Password      string `json:"Password"`
+}
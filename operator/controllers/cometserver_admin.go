@@ -0,0 +1,228 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/go-logr/logr"
+)
+
+const (
+	cometAdminUsernameKey = "username"
+	cometAdminPasswordKey = "password"
+	cometAdminURLKey      = "url"
+	cometAdminDefaultUser = "admin"
+	// cometAdminBootstrapUser is the account the Comet Server starts with, which the operator
+	// signs in with to apply the admin credentials
+	cometAdminBootstrapUser = "operator-bootstrap"
+	cometAdminPasswordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+type cometAdminCredentials struct {
+	Username string
+	Password string
+}
+
+// reconcileCometServerAdmin publishes the admin credentials into the owned <name>-admin secret.
+// Credentials are copied from spec.admin.secretRef when set, otherwise they are taken from the
+// restored server or generated once, and kept for the lifetime of the secret.
+//
+// The credentials are only ever set through the admin API, by applyAdminCredentials. A change is
+// applied to the Comet Server before it is published, so once applied the secret always holds
+// credentials the Comet Server accepts.
+func (r *CometServerReconciler) reconcileCometServerAdmin(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, restore *cometServerRestoreSource, bootstrap *cometAdminCredentials) (*cometAdminCredentials, error) {
+	secretActual := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: cs.AdminSecretName(), Namespace: cs.Namespace}, secretActual)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+
+	creds := &cometAdminCredentials{}
+	if ref := cs.Spec.Admin.SecretRef; ref != nil {
+		source := &corev1.Secret{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cs.Namespace}, source)
+		if err != nil {
+			reqLogger.Error(err, fmt.Sprintf("Failed to get secret/%s - It must be defined before CometServer resource creation.", ref.Name))
+			return nil, err
+		}
+		creds.Username = string(source.Data[cometAdminUsernameKey])
+		creds.Password = string(source.Data[cometAdminPasswordKey])
+		if creds.Username == "" || creds.Password == "" {
+			return nil, fmt.Errorf("secret/%s must contain both %q and %q keys", ref.Name, cometAdminUsernameKey, cometAdminPasswordKey)
+		}
+	} else if exists && len(secretActual.Data[cometAdminPasswordKey]) > 0 {
+		creds.Username = string(secretActual.Data[cometAdminUsernameKey])
+		creds.Password = string(secretActual.Data[cometAdminPasswordKey])
+	} else if restored, err := r.restoredAdminCredentials(ctx, cs, restore); err != nil {
+		return nil, err
+	} else if restored != nil {
+		creds = restored
+		reqLogger.Info("Copied admin credentials of the restored CometServer.")
+	} else {
+		password, err := newAdminPassword(32)
+		if err != nil {
+			return nil, err
+		}
+		creds.Username = cometAdminDefaultUser
+		creds.Password = password
+		reqLogger.Info("Generated new CometServer admin credentials.")
+	}
+
+	if exists {
+		current := &cometAdminCredentials{
+			Username: string(secretActual.Data[cometAdminUsernameKey]),
+			Password: string(secretActual.Data[cometAdminPasswordKey]),
+		}
+		if current.Password != "" && *current != *creds {
+			applied, err := r.applyAdminCredentials(ctx, reqLogger, cs, creds, current, bootstrap)
+			if err != nil {
+				return nil, err
+			}
+			if !applied {
+				reqLogger.Info("Admin credentials will be changed once the Comet Server is running.")
+				creds = current
+			}
+		}
+	}
+
+	secretExpected := getCometServerAdminSecret(cs, creds)
+	if !exists {
+		controllerutil.SetControllerReference(cs, secretExpected, r.Scheme)
+		err = r.Client.Create(ctx, secretExpected)
+		if err != nil {
+			return nil, err
+		}
+	} else if !reflect.DeepEqual(secretExpected.Data, secretActual.Data) || metav1.GetControllerOf(secretActual) == nil {
+		// A secret retained from a previous CometServer of the same name is adopted
+		secretExpected.ObjectMeta = secretActual.ObjectMeta
+		controllerutil.SetControllerReference(cs, secretExpected, r.Scheme)
+		err = r.Client.Update(ctx, secretExpected)
+		if err != nil {
+			return nil, err
+		}
+		reqLogger.Info("Successfully updated admin Secret")
+	}
+
+	return creds, nil
+}
+
+// applyAdminCredentials sets the admin account on the running Comet Server, signing in with the
+// first of the accounts it accepts - the current credentials, or the bootstrap account of the
+// rendered cometd.cfg - and removes those accounts. Unless spec.config is declared, cometd.cfg
+// is only copied onto the data volume on first start up, so new credentials would otherwise never
+// reach the Comet Server. Returns false if the change must wait for the Comet Server to be
+// running.
+func (r *CometServerReconciler) applyAdminCredentials(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, creds *cometAdminCredentials, accounts ...*cometAdminCredentials) (bool, error) {
+	available, err := r.isCometServerAvailable(ctx, cs)
+	if err != nil {
+		return false, err
+	}
+	if !available {
+		// A declared configuration replaces cometd.cfg on start up, so the credentials are
+		// applied with the bootstrap account once the Comet Server is running again
+		return cs.Spec.Config != nil, nil
+	}
+	if comet.NewClient(comet.ServerURL(cs), creds.Username, creds.Password).Health(ctx) == nil {
+		// Already applied, by an earlier attempt
+		return true, nil
+	}
+
+	for _, account := range accounts {
+		if account == nil {
+			continue
+		}
+		api := comet.NewClient(comet.ServerURL(cs), account.Username, account.Password)
+		cfg, err := api.ServerConfig(ctx)
+		if comet.IsUnauthorized(err) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to change the admin credentials: %w", err)
+		}
+		comet.SetAdminUser(cfg, creds.Username, creds.Password)
+		for _, other := range accounts {
+			if other != nil && other.Username != creds.Username {
+				comet.RemoveAdminUser(cfg, other.Username)
+			}
+		}
+		if err := api.SetServerConfig(ctx, cfg); err != nil {
+			return false, fmt.Errorf("failed to change the admin credentials: %w", err)
+		}
+		reqLogger.Info("Changed the admin credentials on the Comet Server.")
+		r.Recorder.Event(cs, corev1.EventTypeNormal, "AdminCredentialsChanged", fmt.Sprintf("Admin credentials of %q applied to the Comet Server.", creds.Username))
+		return true, nil
+	}
+	return false, fmt.Errorf("failed to change the admin credentials: the Comet Server accepts neither the current nor the bootstrap credentials")
+}
+
+// cometClientForServer returns an admin API client for the named CometServer.
+func cometClientForServer(ctx context.Context, c client.Reader, namespace, name string) (*comet.Client, error) {
+	cs := &cometdv1alpha1.CometServer{}
+	err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, cs)
+	if err != nil {
+		return nil, err
+	}
+	return comet.ForServer(ctx, c, cs)
+}
+
+func newAdminPassword(length int) (string, error) {
+	max := big.NewInt(int64(len(cometAdminPasswordChars)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = cometAdminPasswordChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+func getCometServerAdminSecret(cs *cometdv1alpha1.CometServer, creds *cometAdminCredentials) *corev1.Secret {
+	labels := map[string]string{"app": cs.Name}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cs.AdminSecretName(),
+			Namespace: cs.Namespace,
+			Labels:    labels,
+		},
+		Data: map[string][]byte{
+			cometAdminUsernameKey: []byte(creds.Username),
+			cometAdminPasswordKey: []byte(creds.Password),
+			cometAdminURLKey:      []byte(fmt.Sprintf("https://%s", cs.FQDN())),
+		},
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+)
+
+// resolveCloneSource snapshots the data volume of the source CometServer, through an owned
+// <name>-clone CometServerBackup, and returns it as the data to restore. Returns nil while the
+// snapshot is not yet ready.
+func (r *CometServerReconciler) resolveCloneSource(ctx context.Context, cs *cometdv1alpha1.CometServer) (*cometServerRestoreSource, error) {
+	clone := cs.Spec.CloneFrom
+	if clone.ServerRef == cs.Name {
+		err := fmt.Errorf("a CometServer can't be cloned from itself")
+		setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "InvalidSource", err.Error())
+		return nil, err
+	}
+
+	b := &cometdv1alpha1.CometServerBackup{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-clone", cs.Name), Namespace: cs.Namespace}, b)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		source := &cometdv1alpha1.CometServer{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: clone.ServerRef, Namespace: cs.Namespace}, source)
+		if err != nil {
+			setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "SourceNotFound", err.Error())
+			return nil, err
+		}
+		b = getCometServerCloneBackup(cs)
+		controllerutil.SetControllerReference(cs, b, r.Scheme)
+		if err := r.Client.Create(ctx, b); err != nil {
+			return nil, err
+		}
+		r.Recorder.Event(cs, corev1.EventTypeNormal, "Cloning", fmt.Sprintf("Taking a snapshot of cometserver/%s.", clone.ServerRef))
+		setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "BackupNotReady", fmt.Sprintf("Waiting for cometserverbackup/%s to complete.", b.Name))
+		return nil, nil
+	}
+	if !isBackupCompleted(cs, b) {
+		return nil, nil
+	}
+
+	src := getRestoreSourceFromBackup(cs, b)
+	// Two Comet Servers must never run with the same license
+	src.SerialNumber = ""
+	if clone.DisableOutbound {
+		src.ConfigSecret, err = r.reconcileCloneConfig(ctx, cs)
+		if err != nil {
+			setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "SourceUnavailable", err.Error())
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+// reconcileCloneConfig saves the source's configuration, with outbound actions disabled, into
+// the owned <name>-clone-config secret. The restore job copies it over the cloned cometd.cfg.
+func (r *CometServerReconciler) reconcileCloneConfig(ctx context.Context, cs *cometdv1alpha1.CometServer) (string, error) {
+	name := fmt.Sprintf("%s-clone-config", cs.Name)
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: cs.Namespace}, secret)
+	if err == nil {
+		return name, nil
+	} else if !errors.IsNotFound(err) {
+		return "", err
+	}
+
+	api, err := cometClientForServer(ctx, r.Client, cs.Namespace, cs.Spec.CloneFrom.ServerRef)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := api.ServerConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	comet.DisableOutbound(cfg)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cs.Namespace,
+			Labels:    map[string]string{"app": cs.Name},
+		},
+		Data: map[string][]byte{
+			cometServerConfigKey: data,
+		},
+	}
+	controllerutil.SetControllerReference(cs, secret, r.Scheme)
+	if err := r.Client.Create(ctx, secret); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func getCometServerCloneBackup(cs *cometdv1alpha1.CometServer) *cometdv1alpha1.CometServerBackup {
+	return &cometdv1alpha1.CometServerBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-clone", cs.Name),
+			Namespace: cs.Namespace,
+			Labels:    map[string]string{"app": cs.Name},
+		},
+		Spec: cometdv1alpha1.CometServerBackupSpec{
+			ServerRef: cs.Spec.CloneFrom.ServerRef,
+			Target: cometdv1alpha1.CometServerBackupTarget{
+				VolumeSnapshot: &cometdv1alpha1.CometServerBackupVolumeSnapshotTarget{
+					VolumeSnapshotClassName: cs.Spec.CloneFrom.VolumeSnapshotClassName,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet/comettest"
+)
+
+var _ = Describe("CometServer clone", func() {
+	var (
+		ctx    = context.Background()
+		srv    *comettest.Server
+		c      client.Client
+		r      *CometServerReconciler
+		source *cometdv1alpha1.CometServer
+		cs     *cometdv1alpha1.CometServer
+	)
+
+	BeforeEach(func() {
+		var admin *corev1.Secret
+		srv, source, admin = newCometServerFake("source")
+		source.Annotations = map[string]string{cometServerSerialNumber: "SERIAL"}
+		cs = &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "clone", Namespace: "default", UID: "clone"},
+			Spec: cometdv1alpha1.CometServerSpec{
+				Version:   "23.5.0",
+				CloneFrom: &cometdv1alpha1.CometServerClone{ServerRef: source.Name},
+			},
+		}
+		c = newFakeClient(source, admin, cs)
+		r = &CometServerReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	restoredCondition := func() *metav1.Condition {
+		cond := meta.FindStatusCondition(cs.Status.Conditions, conditionRestored)
+		Expect(cond).NotTo(BeNil())
+		return cond
+	}
+
+	// completeSnapshot completes the snapshot of the source taken for the clone
+	completeSnapshot := func() {
+		b := &cometdv1alpha1.CometServerBackup{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "clone-clone", Namespace: "default"}, b)).To(Succeed())
+		b.Status.Phase = cometdv1alpha1.CometServerBackupCompleted
+		b.Status.Location = "clone-clone"
+		b.Status.SerialNumber = "SERIAL"
+		Expect(c.Status().Update(ctx, b)).To(Succeed())
+	}
+
+	It("snapshots the source through an owned backup", func() {
+		src, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).To(BeNil())
+		Expect(restoredCondition().Reason).To(Equal("BackupNotReady"))
+
+		b := &cometdv1alpha1.CometServerBackup{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "clone-clone", Namespace: "default"}, b)).To(Succeed())
+		Expect(b.Spec.ServerRef).To(Equal("source"))
+		Expect(b.Spec.Target.VolumeSnapshot).NotTo(BeNil())
+		Expect(metav1.IsControlledBy(b, cs)).To(BeTrue())
+	})
+
+	It("provisions the data volume from the snapshot, without the source's serial number", func() {
+		_, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).NotTo(HaveOccurred())
+		completeSnapshot()
+
+		src, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src.VolumeSnapshot).To(Equal("clone-clone"))
+		Expect(src.SerialNumber).To(BeEmpty())
+		Expect(src.AdminSecret).To(Equal("source-admin"))
+
+		pvc := getCometServerPVC(cs, src)
+		Expect(pvc.Spec.DataSource).NotTo(BeNil())
+		Expect(pvc.Spec.DataSource.Kind).To(Equal("VolumeSnapshot"))
+		Expect(pvc.Spec.DataSource.Name).To(Equal("clone-clone"))
+	})
+
+	It("replaces the cloned configuration with outbound actions disabled", func() {
+		cfg := srv.Config()
+		cfg["Email"] = map[string]interface{}{"Mode": "smtp"}
+		Expect(srv.AdminClient().SetServerConfig(ctx, cfg)).To(Succeed())
+		cs.Spec.CloneFrom.DisableOutbound = true
+
+		_, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).NotTo(HaveOccurred())
+		completeSnapshot()
+		src, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src.ConfigSecret).To(Equal("clone-clone-config"))
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: src.ConfigSecret, Namespace: "default"}, secret)).To(Succeed())
+		Expect(metav1.IsControlledBy(secret, cs)).To(BeTrue())
+		cloned := map[string]interface{}{}
+		Expect(json.Unmarshal(secret.Data[cometServerConfigKey], &cloned)).To(Succeed())
+		Expect(cloned).To(HaveKeyWithValue("Email", HaveKeyWithValue("Mode", "")))
+
+		job := getCometServerRestoreJob(cs, src)
+		Expect(containerNames(job.Spec.Template.Spec.InitContainers)).To(Equal([]string{"verify"}))
+		Expect(containerNames(job.Spec.Template.Spec.Containers)).To(Equal([]string{"configure"}))
+	})
+
+	It("fails when the source CometServer doesn't exist", func() {
+		cs.Spec.CloneFrom.ServerRef = "missing"
+		_, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).To(HaveOccurred())
+		Expect(restoredCondition().Reason).To(Equal("SourceNotFound"))
+	})
+
+	It("refuses to clone itself", func() {
+		cs.Spec.CloneFrom.ServerRef = cs.Name
+		_, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).To(MatchError(ContainSubstring("cloned from itself")))
+		Expect(restoredCondition().Reason).To(Equal("InvalidSource"))
+	})
+
+	It("refuses to also restore from a backup", func() {
+		cs.Spec.RestoreFrom = &cometdv1alpha1.CometServerRestore{BackupRef: "nightly"}
+		_, err := r.resolveRestoreSource(ctx, cs)
+		Expect(err).To(MatchError(ContainSubstring("mutually exclusive")))
+	})
+})
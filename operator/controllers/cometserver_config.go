@@ -0,0 +1,329 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/go-logr/logr"
+)
+
+const (
+	cometServerConfigKey = "cometd.cfg"
+	// cometServerBootstrapPasswordKey holds the password of the bootstrap admin account
+	cometServerBootstrapPasswordKey = "bootstrap-password"
+	cometServerConfigHash           = "cometd.cometbackup.com/config-hash"
+	conditionConfigReady            = "ConfigReady"
+	configMapRefIndexField          = ".spec.config.configMapKeyRef.name"
+	secretRefIndexField             = ".spec.secretRefs"
+)
+
+// reconcileCometServerConfig renders the configuration into the <name>-config secret, which is
+// copied onto the data volume by the cometd-config init container.
+//
+// When spec.config is declared the file is replaced on every start up, and its hash is recorded
+// in the status. The hash is copied onto the pod template, so any change to the rendered
+// configuration restarts the Comet Server. Otherwise the file only holds the bootstrap admin
+// account, and is written on first start up only.
+//
+// The admin credentials are never rendered. The bootstrap account, with a password generated
+// once and kept in the secret, is returned so the credentials can be applied through the admin
+// API instead.
+func (r *CometServerReconciler) reconcileCometServerConfig(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer) (*cometAdminCredentials, error) {
+	secretActual := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-config", cs.Name), Namespace: cs.Namespace}, secretActual)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+
+	bootstrap := &cometAdminCredentials{
+		Username: cometAdminBootstrapUser,
+		Password: string(secretActual.Data[cometServerBootstrapPasswordKey]),
+	}
+	if bootstrap.Password == "" {
+		bootstrap.Password, err = newAdminPassword(32)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg, err := r.renderCometServerConfig(ctx, cs)
+	if err != nil {
+		meta.SetStatusCondition(&cs.Status.Conditions, metav1.Condition{
+			Type:               conditionConfigReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             "RenderFailed",
+			Message:            err.Error(),
+			ObservedGeneration: cs.Generation,
+		})
+		r.Recorder.Event(cs, corev1.EventTypeWarning, "ConfigRenderFailed", err.Error())
+		return nil, err
+	}
+
+	comet.SetAdminUser(cfg, bootstrap.Username, bootstrap.Password)
+	data, err := json.Marshal(cfg) // Maps are marshalled with sorted keys, so the hash is stable
+	if err != nil {
+		return nil, err
+	}
+
+	secretExpected := getCometServerConfigSecret(cs, data, bootstrap)
+	if !exists {
+		controllerutil.SetControllerReference(cs, secretExpected, r.Scheme)
+		err = r.Client.Create(ctx, secretExpected)
+		if err != nil {
+			return nil, err
+		}
+	} else if !reflect.DeepEqual(secretExpected.Data, secretActual.Data) {
+		secretExpected.ObjectMeta = secretActual.ObjectMeta
+		controllerutil.SetControllerReference(cs, secretExpected, r.Scheme)
+		err = r.Client.Update(ctx, secretExpected)
+		if err != nil {
+			return nil, err
+		}
+		reqLogger.Info("Successfully updated config Secret")
+	}
+
+	if cs.Spec.Config == nil {
+		// No configuration declared - cometd manages its own configuration file.
+		cs.Status.ConfigHash = ""
+		meta.RemoveStatusCondition(&cs.Status.Conditions, conditionConfigReady)
+		return bootstrap, nil
+	}
+
+	hash := configHash(data)
+	if cs.Status.ConfigHash != "" && cs.Status.ConfigHash != hash {
+		r.Recorder.Event(cs, corev1.EventTypeNormal, "ConfigChanged", "Configuration changed, restarting Comet Server.")
+	}
+	cs.Status.ConfigHash = hash
+	meta.SetStatusCondition(&cs.Status.Conditions, metav1.Condition{
+		Type:               conditionConfigReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Rendered",
+		Message:            "Configuration rendered into cometd.cfg.",
+		ObservedGeneration: cs.Generation,
+	})
+	return bootstrap, nil
+}
+
+// reconcileCometServerConfigDrift compares the declared configuration with the settings of the
+// running Comet Server. Settings changed on the Comet Server itself would only be overwritten on
+// its next start up, so any drift is reverted straight away through the admin API.
+func (r *CometServerReconciler) reconcileCometServerConfigDrift(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer) error {
+	if cs.Spec.Config == nil || cs.Spec.Suspend {
+		return nil
+	}
+	// Only compare against a pod started with the current configuration
+	depl := &appsv1.Deployment{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: cs.Name, Namespace: cs.Namespace}, depl)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if depl.Spec.Template.Annotations[cometServerConfigHash] != cs.Status.ConfigHash ||
+		depl.Status.AvailableReplicas == 0 || depl.Status.UpdatedReplicas != depl.Status.Replicas {
+		return nil
+	}
+
+	declared, err := r.renderCometServerConfig(ctx, cs)
+	if err != nil {
+		return err
+	}
+	// The admin accounts are kept in sync by applyAdminCredentials
+	delete(declared, "AdminUsers")
+
+	api, err := comet.ForServer(ctx, r.Client, cs)
+	if err != nil {
+		return err
+	}
+	live, err := api.ServerConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the Comet Server settings: %w", err)
+	}
+	drifted := configDrift(declared, live)
+	if len(drifted) == 0 {
+		return nil
+	}
+	mergeConfig(live, declared)
+	if err := api.SetServerConfig(ctx, live); err != nil {
+		return fmt.Errorf("failed to revert the Comet Server settings: %w", err)
+	}
+	reqLogger.Info("Reverted Comet Server settings which drifted from the declared configuration.", "settings", drifted)
+	r.Recorder.Event(cs, corev1.EventTypeWarning, "ConfigDrifted", fmt.Sprintf("Reverted settings changed on the Comet Server: %s.", strings.Join(drifted, ", ")))
+	return nil
+}
+
+// renderCometServerConfig builds the cometd.cfg document from the referenced ConfigMap or
+// Secret, with the inline settings merged over the top.
+func (r *CometServerReconciler) renderCometServerConfig(ctx context.Context, cs *cometdv1alpha1.CometServer) (map[string]interface{}, error) {
+	cfg := map[string]interface{}{}
+	if cs.Spec.Config == nil {
+		return cfg, nil
+	}
+
+	if ref := cs.Spec.Config.ConfigMapKeyRef; ref != nil {
+		cm := &corev1.ConfigMap{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cs.Namespace}, cm)
+		if err != nil && !(errors.IsNotFound(err) && ref.Optional != nil && *ref.Optional) {
+			return nil, fmt.Errorf("failed to get configmap/%s: %w", ref.Name, err)
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			if err := mergeConfigDocument(cfg, []byte(data)); err != nil {
+				return nil, fmt.Errorf("configmap/%s key %s: %w", ref.Name, ref.Key, err)
+			}
+		} else if ref.Optional == nil || !*ref.Optional {
+			return nil, fmt.Errorf("configmap/%s has no key %s", ref.Name, ref.Key)
+		}
+	}
+
+	if ref := cs.Spec.Config.SecretKeyRef; ref != nil {
+		secret := &corev1.Secret{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cs.Namespace}, secret)
+		if err != nil && !(errors.IsNotFound(err) && ref.Optional != nil && *ref.Optional) {
+			return nil, fmt.Errorf("failed to get secret/%s: %w", ref.Name, err)
+		}
+		if data, ok := secret.Data[ref.Key]; ok {
+			if err := mergeConfigDocument(cfg, data); err != nil {
+				return nil, fmt.Errorf("secret/%s key %s: %w", ref.Name, ref.Key, err)
+			}
+		} else if ref.Optional == nil || !*ref.Optional {
+			return nil, fmt.Errorf("secret/%s has no key %s", ref.Name, ref.Key)
+		}
+	}
+
+	if inline := cs.Spec.Config.Inline; inline != nil && len(inline.Raw) > 0 {
+		if err := mergeConfigDocument(cfg, inline.Raw); err != nil {
+			return nil, fmt.Errorf("inline config: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// mergeConfigDocument decodes a JSON object and merges it into dst. Nested objects are
+// merged recursively, all other values (including arrays) replace the existing value.
+func mergeConfigDocument(dst map[string]interface{}, doc []byte) error {
+	src := map[string]interface{}{}
+	if err := json.Unmarshal(doc, &src); err != nil {
+		return fmt.Errorf("expected a JSON object: %w", err)
+	}
+	mergeConfig(dst, src)
+	return nil
+}
+
+func mergeConfig(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeConfig(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// configDrift returns the paths of the settings in declared which have a different value in
+// live, the settings of the running Comet Server. Settings only in live are not drift.
+func configDrift(declared, live map[string]interface{}) []string {
+	drifted := []string{}
+	for k, v := range declared {
+		declaredMap, declaredIsMap := v.(map[string]interface{})
+		liveMap, liveIsMap := live[k].(map[string]interface{})
+		if declaredIsMap && liveIsMap {
+			for _, path := range configDrift(declaredMap, liveMap) {
+				drifted = append(drifted, k+"."+path)
+			}
+			continue
+		}
+		// Compare through JSON, so numbers match whichever way they were decoded
+		want, _ := json.Marshal(v)
+		have, _ := json.Marshal(live[k])
+		if string(want) != string(have) {
+			drifted = append(drifted, k)
+		}
+	}
+	sort.Strings(drifted)
+	return drifted
+}
+
+func configHash(cfg []byte) string {
+	sum := sha256.Sum256(cfg)
+	return hex.EncodeToString(sum[:])
+}
+
+func getCometServerConfigSecret(cs *cometdv1alpha1.CometServer, cfg []byte, bootstrap *cometAdminCredentials) *corev1.Secret {
+	labels := map[string]string{"app": cs.Name}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-config", cs.Name),
+			Namespace: cs.Namespace,
+			Labels:    labels,
+		},
+		Data: map[string][]byte{
+			cometServerConfigKey:            cfg,
+			cometServerBootstrapPasswordKey: []byte(bootstrap.Password),
+		},
+	}
+}
+
+// findServersForConfigMap maps a ConfigMap to the CometServers referencing it, so that
+// configuration changes are picked up without waiting for a resync.
+func (r *CometServerReconciler) findServersForConfigMap(obj client.Object) []reconcile.Request {
+	return r.findServersByIndex(obj, configMapRefIndexField)
+}
+
+// findServersForSecret maps a Secret to the CometServers referencing it, either for
+// configuration or admin credentials.
+func (r *CometServerReconciler) findServersForSecret(obj client.Object) []reconcile.Request {
+	return r.findServersByIndex(obj, secretRefIndexField)
+}
+
+func (r *CometServerReconciler) findServersByIndex(obj client.Object, field string) []reconcile.Request {
+	list := &cometdv1alpha1.CometServerList{}
+	err := r.Client.List(context.TODO(), list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{field: obj.GetName()})
+	if err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, len(list.Items))
+	for i, cs := range list.Items {
+		requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Name: cs.Name, Namespace: cs.Namespace}}
+	}
+	return requests
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// These are plain unit tests of pure functions, which don't need the envtest environment of
+// the Ginkgo suite.
+
+func decodeConfig(t *testing.T, doc string) map[string]interface{} {
+	t.Helper()
+	cfg := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(doc), &cfg); err != nil {
+		t.Fatalf("invalid test document %s: %v", doc, err)
+	}
+	return cfg
+}
+
+func TestMergeConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  string
+		src  string
+		want string
+	}{
+		{
+			name: "adds new keys",
+			dst:  `{"A": 1}`,
+			src:  `{"B": 2}`,
+			want: `{"A": 1, "B": 2}`,
+		},
+		{
+			name: "replaces scalars",
+			dst:  `{"A": 1, "B": "x"}`,
+			src:  `{"A": 2}`,
+			want: `{"A": 2, "B": "x"}`,
+		},
+		{
+			name: "merges nested objects",
+			dst:  `{"Email": {"Mode": "smtp", "FromName": "Comet"}}`,
+			src:  `{"Email": {"Mode": ""}}`,
+			want: `{"Email": {"Mode": "", "FromName": "Comet"}}`,
+		},
+		{
+			name: "replaces arrays",
+			dst:  `{"ListenAddresses": [{"ListenAddress": ":80"}, {"ListenAddress": ":443"}]}`,
+			src:  `{"ListenAddresses": [{"ListenAddress": ":8060"}]}`,
+			want: `{"ListenAddresses": [{"ListenAddress": ":8060"}]}`,
+		},
+		{
+			name: "replaces an object with a scalar",
+			dst:  `{"Branding": {"BrandName": "Comet"}}`,
+			src:  `{"Branding": null}`,
+			want: `{"Branding": null}`,
+		},
+		{
+			name: "replaces a scalar with an object",
+			dst:  `{"Branding": null}`,
+			src:  `{"Branding": {"BrandName": "Comet"}}`,
+			want: `{"Branding": {"BrandName": "Comet"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := decodeConfig(t, tt.dst)
+			mergeConfig(dst, decodeConfig(t, tt.src))
+			if want := decodeConfig(t, tt.want); !reflect.DeepEqual(dst, want) {
+				t.Errorf("mergeConfig() = %v, want %v", dst, want)
+			}
+		})
+	}
+}
+
+func TestMergeConfigDocument(t *testing.T) {
+	cfg := map[string]interface{}{}
+	if err := mergeConfigDocument(cfg, []byte(`["not", "an", "object"]`)); err == nil {
+		t.Error("mergeConfigDocument() accepted a JSON array")
+	}
+	if err := mergeConfigDocument(cfg, []byte(`{"A": 1}`)); err != nil {
+		t.Errorf("mergeConfigDocument() = %v", err)
+	}
+	if cfg["A"] != float64(1) {
+		t.Errorf("mergeConfigDocument() = %v, want A set", cfg)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	a, _ := json.Marshal(decodeConfig(t, `{"A": 1, "B": {"C": true, "D": "x"}}`))
+	b, _ := json.Marshal(decodeConfig(t, `{"B": {"D": "x", "C": true}, "A": 1}`))
+	c, _ := json.Marshal(decodeConfig(t, `{"A": 2, "B": {"C": true, "D": "x"}}`))
+
+	if configHash(a) != configHash(b) {
+		t.Error("configHash() differs for the same settings in a different order")
+	}
+	if configHash(a) == configHash(c) {
+		t.Error("configHash() is the same for different settings")
+	}
+	if len(configHash(a)) != 64 {
+		t.Errorf("configHash() = %q, want a hex encoded SHA-256", configHash(a))
+	}
+}
+
+func TestConfigDrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		live     string
+		want     []string
+	}{
+		{
+			name:     "in sync",
+			declared: `{"Email": {"Mode": "smtp"}, "ListenAddresses": [{"ListenAddress": ":8060"}]}`,
+			live:     `{"Email": {"Mode": "smtp", "FromName": "Comet"}, "ListenAddresses": [{"ListenAddress": ":8060"}], "Other": 1}`,
+			want:     []string{},
+		},
+		{
+			name:     "changed scalar",
+			declared: `{"ExperienceMode": "Service Provider"}`,
+			live:     `{"ExperienceMode": "Business"}`,
+			want:     []string{"ExperienceMode"},
+		},
+		{
+			name:     "changed nested value",
+			declared: `{"Email": {"Mode": "smtp", "FromName": "Comet"}}`,
+			live:     `{"Email": {"Mode": "", "FromName": "Comet"}}`,
+			want:     []string{"Email.Mode"},
+		},
+		{
+			name:     "missing keys",
+			declared: `{"B": 1, "A": {"C": 2}}`,
+			live:     `{}`,
+			want:     []string{"A", "B"},
+		},
+		{
+			name:     "changed array",
+			declared: `{"ListenAddresses": [{"ListenAddress": ":8060"}]}`,
+			live:     `{"ListenAddresses": [{"ListenAddress": ":8060"}, {"ListenAddress": ":443"}]}`,
+			want:     []string{"ListenAddresses"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := configDrift(decodeConfig(t, tt.declared), decodeConfig(t, tt.live))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configDrift() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigDriftReverted(t *testing.T) {
+	declared := decodeConfig(t, `{"Email": {"Mode": "smtp"}, "ExperienceMode": "Service Provider"}`)
+	live := decodeConfig(t, `{"Email": {"Mode": "", "FromName": "Comet"}, "ExperienceMode": "Business", "Other": 1}`)
+
+	mergeConfig(live, declared)
+	if drifted := configDrift(declared, live); len(drifted) != 0 {
+		t.Errorf("configDrift() = %v after merging the declared settings", drifted)
+	}
+	if live["Other"] != float64(1) || live["Email"].(map[string]interface{})["FromName"] != "Comet" {
+		t.Errorf("mergeConfig() dropped undeclared settings: %v", live)
+	}
+}
@@ -25,19 +25,26 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
 	"github.com/go-logr/logr"
@@ -47,12 +54,36 @@ const (
 	cometServerFinalizer    = "cometd.cometbackup.com/finalizer"
 	cometServerLabel        = "cometd.cometbackup.com/pod-name"
 	cometServerSerialNumber = "cometd.cometbackup.com/serial-number"
+	// cometServerQuiescedBy names the CometServerBackup which has stopped the Comet Server
+	cometServerQuiescedBy = "cometd.cometbackup.com/quiesced-by"
+	// cometServerReconcilePaused stops the operator from making any change to the CometServer
+	cometServerReconcilePaused = "cometd.cometbackup.com/reconcile-paused"
+
+	conditionDeletionProtected = "DeletionProtected"
+	conditionLicenseIssued     = "LicenseIssued"
+	conditionReconcilePaused   = "ReconcilePaused"
+	conditionSuspended         = "Suspended"
+
+	// issuerQuotaRetryInterval is how often a CometServer waiting for its issuer's quota checks
+	// whether a serial number has been freed, by another CometServer being deleted.
+	issuerQuotaRetryInterval = time.Minute
 )
 
+// errIssuerQuotaReached is returned when an issuer has issued serial numbers to its MaxServers.
+var errIssuerQuotaReached = stderrors.New("license issuer quota reached")
+
 // CometServerReconciler reconciles a CometServer object
 type CometServerReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// APIReader reads uncached, for the serial numbers counted against an issuer's quota.
+	APIReader client.Reader
+
+	// MaintenanceBackend is the host name of the Service serving the operator frontend. Ingresses
+	// are pointed at its plain HTTP maintenance port, through an ExternalName Service, while the
+	// Comet Server is unavailable. The maintenance page is disabled if empty.
+	MaintenanceBackend string
 }
 
 //+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometservers,verbs=get;list;watch;create;update;patch;delete
@@ -64,6 +95,11 @@ type CometServerReconciler struct {
 //+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometlicenseissuers/finalizers,verbs=update
 
 //+kubebuilder:rbac:groups=*,resources=services;ingresses;persistentvolumeclaims;deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometserverbackups,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -94,22 +130,48 @@ func (r *CometServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
+	// Paused CometServers are left untouched, even while being deleted
+	if isReconcilePaused(cs) {
+		reqLogger.Info("CometServer reconciliation is paused.")
+		if meta.IsStatusConditionTrue(cs.Status.Conditions, conditionReconcilePaused) {
+			return ctrl.Result{}, nil
+		}
+		setCometServerCondition(cs, conditionReconcilePaused, metav1.ConditionTrue, "Paused", fmt.Sprintf("Reconciliation is paused by the %s annotation.", cometServerReconcilePaused))
+		return ctrl.Result{}, r.Client.Status().Update(ctx, cs)
+	}
+	setCometServerCondition(cs, conditionReconcilePaused, metav1.ConditionFalse, "Reconciling", "Reconciliation is not paused.")
+
 	// Check if the CometServer instance is marked to be deleted, which is
 	// indicated by the deletion timestamp being set.
 	isMarkedToBeDeleted := cs.GetDeletionTimestamp() != nil
 	if isMarkedToBeDeleted {
+		if cs.Spec.DeletionProtection {
+			// Only reachable if deleted while the validating webhook was unavailable. Clearing
+			// spec.deletionProtection triggers another reconcile.
+			if meta.IsStatusConditionTrue(cs.Status.Conditions, conditionDeletionProtected) {
+				return ctrl.Result{}, nil
+			}
+			reqLogger.Info("CometServer has deletion protection enabled.")
+			r.Recorder.Event(cs, corev1.EventTypeWarning, "DeletionProtected", "Deletion is blocked until spec.deletionProtection is cleared, which completes the deletion.")
+			setCometServerCondition(cs, conditionDeletionProtected, metav1.ConditionTrue, "DeletionProtected", "Deletion is blocked until spec.deletionProtection is cleared, which completes the deletion.")
+			return ctrl.Result{}, r.Client.Status().Update(ctx, cs)
+		}
 		if controllerutil.ContainsFinalizer(cs, cometServerFinalizer) {
-			// Run finalization logic for memcachedFinalizer. If the
+			// Run finalization logic for cometServerFinalizer. If the
 			// finalization logic fails, don't remove the finalizer so
 			// that we can retry during the next reconciliation.
-			if err := r.finalizeCometServer(reqLogger, cs); err != nil {
+			done, err := r.finalizeCometServer(ctx, reqLogger, cs)
+			if err != nil {
 				return ctrl.Result{}, err
 			}
+			if !done {
+				return ctrl.Result{RequeueAfter: cometBackupPollInterval}, nil
+			}
 
-			// Remove memcachedFinalizer. Once all finalizers have been
+			// Remove cometServerFinalizer. Once all finalizers have been
 			// removed, the object will be deleted.
 			controllerutil.RemoveFinalizer(cs, cometServerFinalizer)
-			err := r.Update(ctx, cs)
+			err = r.Update(ctx, cs)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
@@ -117,33 +179,90 @@ func (r *CometServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	// Add finalizer for this CR
+	if !controllerutil.ContainsFinalizer(cs, cometServerFinalizer) {
+		controllerutil.AddFinalizer(cs, cometServerFinalizer)
+		if err := r.Update(ctx, cs); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	// --
 
-	err = r.reconcileCometServer(context.TODO(), reqLogger, cs)
-	if err != nil {
-		reqLogger.Error(err, "Failed to create/update cometserver resources.")
-		return ctrl.Result{}, nil
+	reconcileErr := r.reconcileCometServer(ctx, reqLogger, cs)
+	if err := r.Client.Status().Update(ctx, cs); err != nil {
+		return ctrl.Result{}, err
+	}
+	if reconcileErr != nil && !stderrors.Is(reconcileErr, errIssuerQuotaReached) {
+		// Returning the error retries the reconcile with backoff
+		reqLogger.Error(reconcileErr, "Failed to create/update cometserver resources.")
+		return ctrl.Result{}, reconcileErr
+	}
+	return ctrl.Result{RequeueAfter: cometServerRequeueAfter(cs)}, nil
+}
+
+// cometServerRequeueAfter returns when to reconcile the CometServer again, for changes which
+// don't trigger a watch - the issuer's quota is checked again, and a declared configuration is
+// re-checked against the running Comet Server. Failed steps are retried by returning their
+// error instead.
+func cometServerRequeueAfter(cs *cometdv1alpha1.CometServer) time.Duration {
+	if meta.IsStatusConditionFalse(cs.Status.Conditions, conditionLicenseIssued) {
+		return issuerQuotaRetryInterval
+	}
+	if cs.Spec.Config != nil {
+		return cometAPIResyncInterval
 	}
-	_ = r.Client.Status().Update(context.TODO(), cs)
-	return ctrl.Result{}, nil
+	return 0
 }
 
 func (r *CometServerReconciler) reconcileCometServer(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer) error {
+	// Restore Source
+	restore, err := r.resolveRestoreSource(ctx, cs)
+	if err != nil {
+		return err
+	}
+	if restore == nil && isRestoring(cs) {
+		// Waiting for the backup to complete
+		return nil
+	}
+
 	// License
 	if _, ok := cs.Annotations[cometServerSerialNumber]; !ok {
 		// Serial Number not defined as an annotation - this must be a first start up.
-		// Attempt to generate a new serial number using the defined CometServerLicenseIssuer -
-		reqLogger.Info("CometServer serial number not defined... attempting to generate a new one.")
-		issuer := &cometdv1alpha1.CometLicenseIssuer{}
-		err := r.Client.Get(ctx, types.NamespacedName{Name: cs.Spec.License.Issuer, Namespace: cs.Namespace}, issuer)
-		if err != nil {
-			reqLogger.Error(err, fmt.Sprintf("Failed to get cometlicenseissuer/%s - It must be defined before CometServer resource creation.", cs.Spec.License.Issuer))
-			return err
+		// Keep the serial number of restored data, otherwise attempt to generate a new serial
+		// number using the defined CometServerLicenseIssuer -
+		serial := ""
+		if restore != nil {
+			serial, err = r.restoredSerialNumber(ctx, reqLogger, cs, restore)
+			if err != nil {
+				return err
+			}
 		}
-		serial, err := newSerialNumber(issuer, &cs.Spec.License.Features)
-		if err != nil {
-			reqLogger.Error(err, "Failed to generate new serial number.")
-			return err
+		if serial == "" {
+			reqLogger.Info("CometServer serial number not defined... attempting to generate a new one.")
+			issuer := &cometdv1alpha1.CometLicenseIssuer{}
+			err := r.Client.Get(ctx, types.NamespacedName{Name: cs.Spec.License.Issuer, Namespace: cs.Namespace}, issuer)
+			if err != nil {
+				reqLogger.Error(err, fmt.Sprintf("Failed to get cometlicenseissuer/%s - It must be defined before CometServer resource creation.", cs.Spec.License.Issuer))
+				return err
+			}
+			if err := r.checkIssuerQuota(ctx, cs, issuer); err != nil {
+				reqLogger.Error(err, "Not generating a new serial number.")
+				if stderrors.Is(err, errIssuerQuotaReached) {
+					setCometServerCondition(cs, conditionLicenseIssued, metav1.ConditionFalse, "QuotaReached", err.Error())
+				}
+				return err
+			}
+			token, err := issuer.AuthToken(ctx, r.Client)
+			if err != nil {
+				reqLogger.Error(err, fmt.Sprintf("Failed to get the API token of cometlicenseissuer/%s.", issuer.Name))
+				return err
+			}
+			serial, err = newSerialNumber(issuer.Spec.Auth.Email, token, cs.LicenseFeatures(issuer))
+			if err != nil {
+				reqLogger.Error(err, "Failed to generate new serial number.")
+				return err
+			}
 		}
 		// Add the serial number as an annotation
 		if cs.Annotations == nil {
@@ -154,12 +273,13 @@ func (r *CometServerReconciler) reconcileCometServer(ctx context.Context, reqLog
 			reqLogger.Error(err, "Failed to add serial number label.")
 			return err
 		}
+		setCometServerCondition(cs, conditionLicenseIssued, metav1.ConditionTrue, "Issued", "The Comet Server has a serial number.")
 	}
 
 	// Service
 	svcExpected := getCometServerService(cs)
 	svcActual := &corev1.Service{}
-	err := r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-service", cs.Name), Namespace: cs.Namespace}, svcActual)
+	err = r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-service", cs.Name), Namespace: cs.Namespace}, svcActual)
 	if err != nil {
 		// Failed to get service - maybe we need to create it?
 		if errors.IsNotFound(err) {
@@ -182,8 +302,21 @@ func (r *CometServerReconciler) reconcileCometServer(ctx context.Context, reqLog
 		reqLogger.Info("Successfully updated Service")
 	}
 
+	// Maintenance Page
+	maintenance := false
+	if r.MaintenanceBackend != "" {
+		if err := r.reconcileMaintenanceService(ctx, reqLogger, cs); err != nil {
+			return err
+		}
+		available, err := r.isCometServerAvailable(ctx, cs)
+		if err != nil {
+			return err
+		}
+		maintenance = !available
+	}
+
 	// Ingress
-	ingressExpected := getCometServerIngress(cs)
+	ingressExpected := getCometServerIngress(cs, maintenance)
 	ingressActual := &networkingv1.Ingress{}
 	err = r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-ingress", cs.Name), Namespace: cs.Namespace}, ingressActual)
 	if err != nil {
@@ -198,6 +331,8 @@ func (r *CometServerReconciler) reconcileCometServer(ctx context.Context, reqLog
 			return err
 		}
 	} else if !reflect.DeepEqual(ingressExpected.Spec, ingressActual.Spec) {
+		swapped := ingressActual.Spec.DefaultBackend == nil || ingressActual.Spec.DefaultBackend.Service == nil ||
+			ingressActual.Spec.DefaultBackend.Service.Name != ingressExpected.Spec.DefaultBackend.Service.Name
 		ingressExpected.ObjectMeta = ingressActual.ObjectMeta
 		controllerutil.SetControllerReference(cs, ingressExpected, r.Scheme)
 		err = r.Client.Update(ctx, ingressExpected)
@@ -205,10 +340,15 @@ func (r *CometServerReconciler) reconcileCometServer(ctx context.Context, reqLog
 			return err
 		}
 		reqLogger.Info("Successfully updated Ingress")
+		if swapped && maintenance {
+			r.Recorder.Event(cs, corev1.EventTypeNormal, "MaintenancePage", "The Comet Server is unavailable, serving the maintenance page.")
+		} else if swapped {
+			r.Recorder.Event(cs, corev1.EventTypeNormal, "MaintenancePage", "The Comet Server is available again.")
+		}
 	}
 
 	// PersistentVolumeClaim
-	pvcExpected := getCometServerPVC(cs)
+	pvcExpected := getCometServerPVC(cs, restore)
 	pvcActual := &corev1.PersistentVolumeClaim{}
 	err = r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-pvc", cs.Name), Namespace: cs.Namespace}, pvcActual)
 	if err != nil {
@@ -223,7 +363,46 @@ func (r *CometServerReconciler) reconcileCometServer(ctx context.Context, reqLog
 			return err
 		}
 	} else {
-		// PVCs are immutable after creation... nothing to do here.
+		// PVCs are immutable after creation, except to grow the volume. A PVC retained from a
+		// previous CometServer of the same name is adopted.
+		changed := false
+		if metav1.GetControllerOf(pvcActual) == nil {
+			controllerutil.SetControllerReference(cs, pvcActual, r.Scheme)
+			changed = true
+		}
+		sizeExpected := pvcExpected.Spec.Resources.Requests[corev1.ResourceStorage]
+		if sizeExpected.Cmp(pvcActual.Spec.Resources.Requests[corev1.ResourceStorage]) > 0 {
+			pvcActual.Spec.Resources.Requests[corev1.ResourceStorage] = sizeExpected
+			changed = true
+		}
+		if changed {
+			err = r.Client.Update(ctx, pvcActual)
+			if err != nil {
+				return err
+			}
+			reqLogger.Info("Successfully updated PersistentVolumeClaim")
+		}
+	}
+
+	// Config
+	bootstrap, err := r.reconcileCometServerConfig(ctx, reqLogger, cs)
+	if err != nil {
+		return err
+	}
+
+	// Admin Credentials
+	admin, err := r.reconcileCometServerAdmin(ctx, reqLogger, cs, restore, bootstrap)
+	if err != nil {
+		return err
+	}
+
+	// Restore
+	if restore != nil {
+		restored, err := r.reconcileCometServerRestore(ctx, reqLogger, cs, restore)
+		if err != nil || !restored {
+			// The Comet Server must not start until the data volume is restored
+			return err
+		}
 	}
 
 	// Deployment
@@ -250,28 +429,219 @@ func (r *CometServerReconciler) reconcileCometServer(ctx context.Context, reqLog
 		}
 		reqLogger.Info("Successfully updated Deployment")
 	}
+	if cs.Spec.Suspend {
+		setCometServerCondition(cs, conditionSuspended, metav1.ConditionTrue, "Suspended", "The Comet Server is scaled to zero.")
+	} else {
+		setCometServerCondition(cs, conditionSuspended, metav1.ConditionFalse, "Running", "The Comet Server is not suspended.")
+	}
 
-	return nil
+	// Admin Account - the Comet Server starts with the bootstrap account only
+	if _, err := r.applyAdminCredentials(ctx, reqLogger, cs, admin, bootstrap); err != nil {
+		return err
+	}
+
+	// Config Drift
+	return r.reconcileCometServerConfigDrift(ctx, reqLogger, cs)
 }
 
-func (r *CometServerReconciler) finalizeCometServer(reqLogger logr.Logger, cs *cometdv1alpha1.CometServer) error {
-	// TODO(user): Add the cleanup steps that the operator
-	// needs to do before the CR can be deleted. Examples
-	// of finalizers include performing backups and deleting
-	// resources that are not owned by this CR, like a PVC.
+// isReconcilePaused reports whether the reconcile-paused annotation is set to true.
+func isReconcilePaused(cs *cometdv1alpha1.CometServer) bool {
+	paused, _ := strconv.ParseBool(cs.Annotations[cometServerReconcilePaused])
+	return paused
+}
+
+// finalizeCometServer applies the data volume's deletion policy. Returns
+// true once the CometServer can be deleted - owned resources, including the PVC unless
+// retained, are then garbage collected.
+func (r *CometServerReconciler) finalizeCometServer(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer) (bool, error) {
+	switch cs.Spec.Storage.DeletionPolicy {
+	case cometdv1alpha1.CometServerDeletionPolicyRetain:
+		// Orphan the PVC, so it isn't garbage collected with the CometServer. The admin Secret
+		// is kept with it, as it holds the credentials stored in the retained cometd.cfg.
+		pvcName := fmt.Sprintf("%s-pvc", cs.Name)
+		if retained, err := r.orphan(ctx, cs, pvcName, &corev1.PersistentVolumeClaim{}); err != nil {
+			return false, err
+		} else if retained {
+			r.Recorder.Event(cs, corev1.EventTypeNormal, "Retained", fmt.Sprintf("Retained persistentvolumeclaim/%s.", pvcName))
+		}
+		if retained, err := r.orphan(ctx, cs, cs.AdminSecretName(), &corev1.Secret{}); err != nil {
+			return false, err
+		} else if retained {
+			r.Recorder.Event(cs, corev1.EventTypeNormal, "Retained", fmt.Sprintf("Retained secret/%s.", cs.AdminSecretName()))
+		}
+
+	case cometdv1alpha1.CometServerDeletionPolicySnapshot:
+		// Take a final backup, which outlives the CometServer and can be restored from
+		b := &cometdv1alpha1.CometServerBackup{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-final", cs.Name), Namespace: cs.Namespace}, b)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return false, err
+			}
+			b = getCometServerFinalBackup(cs)
+			if err := r.Client.Create(ctx, b); err != nil {
+				return false, err
+			}
+			r.Recorder.Event(cs, corev1.EventTypeNormal, "Snapshotting", fmt.Sprintf("Taking final backup cometserverbackup/%s.", b.Name))
+			return false, nil
+		}
+		switch b.Status.Phase {
+		case cometdv1alpha1.CometServerBackupCompleted:
+		case cometdv1alpha1.CometServerBackupFailed:
+			r.Recorder.Event(cs, corev1.EventTypeWarning, "SnapshotFailed", fmt.Sprintf("Final backup failed: %s - delete cometserverbackup/%s to retry, or change spec.storage.deletionPolicy.", b.Status.Message, b.Name))
+			return false, nil
+		default:
+			return false, nil
+		}
+	}
+
 	reqLogger.Info("Successfully finalized CometServer.")
+	return true, nil
+}
+
+// orphan removes the CometServer's owner reference from the named object, so it isn't garbage
+// collected with the CometServer. Returns true if the owner reference was removed.
+func (r *CometServerReconciler) orphan(ctx context.Context, cs *cometdv1alpha1.CometServer, name string, obj client.Object) (bool, error) {
+	err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: cs.Namespace}, obj)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	refs := obj.GetOwnerReferences()
+	kept := make([]metav1.OwnerReference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.UID != cs.UID {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(refs) {
+		return false, nil
+	}
+	obj.SetOwnerReferences(kept)
+	if err := r.Client.Update(ctx, obj); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// cometMaintenancePort is the plain HTTP port the operator frontend serves the maintenance page
+// on. Ingresses proxy plain HTTP to it, even when the frontend itself is served over HTTPS.
+const cometMaintenancePort = 8068
+
+// reconcileMaintenanceService creates the <name>-maintenance ExternalName Service, which routes
+// to the operator frontend from the CometServer's namespace.
+func (r *CometServerReconciler) reconcileMaintenanceService(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer) error {
+	svcExpected := getCometServerMaintenanceService(cs, r.MaintenanceBackend)
+	svcActual := &corev1.Service{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: svcExpected.Name, Namespace: cs.Namespace}, svcActual)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			controllerutil.SetControllerReference(cs, svcExpected, r.Scheme)
+			return r.Client.Create(ctx, svcExpected)
+		}
+		return err
+	}
+	// The port is compared by number only, as the API server defaults its target port
+	portChanged := len(svcActual.Spec.Ports) != 1 || svcActual.Spec.Ports[0].Port != svcExpected.Spec.Ports[0].Port
+	if svcActual.Spec.Type != svcExpected.Spec.Type || svcActual.Spec.ExternalName != svcExpected.Spec.ExternalName || portChanged {
+		svcActual.Spec.Type = svcExpected.Spec.Type
+		svcActual.Spec.ExternalName = svcExpected.Spec.ExternalName
+		svcActual.Spec.Ports = svcExpected.Spec.Ports
+		if err := r.Client.Update(ctx, svcActual); err != nil {
+			return err
+		}
+		reqLogger.Info("Successfully updated maintenance Service")
+	}
 	return nil
 }
 
+// isCometServerAvailable reports whether the Comet Server has a ready pod. It doesn't while
+// suspended, quiesced, upgrading (the pod is recreated) or crash-looping.
+func (r *CometServerReconciler) isCometServerAvailable(ctx context.Context, cs *cometdv1alpha1.CometServer) (bool, error) {
+	if cs.Spec.Suspend {
+		return false, nil
+	}
+	depl := &appsv1.Deployment{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: cs.Name, Namespace: cs.Namespace}, depl)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return depl.Status.AvailableReplicas > 0, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CometServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Index the config references, so changes to a ConfigMap or Secret can be mapped back to
+	// the CometServers which use them.
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &cometdv1alpha1.CometServer{}, configMapRefIndexField, func(o client.Object) []string {
+		cs := o.(*cometdv1alpha1.CometServer)
+		if cs.Spec.Config == nil || cs.Spec.Config.ConfigMapKeyRef == nil {
+			return nil
+		}
+		return []string{cs.Spec.Config.ConfigMapKeyRef.Name}
+	})
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &cometdv1alpha1.CometServer{}, secretRefIndexField, func(o client.Object) []string {
+		cs := o.(*cometdv1alpha1.CometServer)
+		var names []string
+		if cs.Spec.Config != nil && cs.Spec.Config.SecretKeyRef != nil {
+			names = append(names, cs.Spec.Config.SecretKeyRef.Name)
+		}
+		if cs.Spec.Admin.SecretRef != nil {
+			names = append(names, cs.Spec.Admin.SecretRef.Name)
+		}
+		return names
+	})
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &cometdv1alpha1.CometServer{}, restoreBackupRefIndexField, func(o client.Object) []string {
+		cs := o.(*cometdv1alpha1.CometServer)
+		if cs.Spec.RestoreFrom == nil || cs.Spec.RestoreFrom.BackupRef == "" {
+			return nil
+		}
+		return []string{cs.Spec.RestoreFrom.BackupRef}
+	})
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&cometdv1alpha1.CometServer{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Secret{}).
+		Owns(&batchv1.Job{}).
+		Owns(&cometdv1alpha1.CometServerBackup{}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.findServersForConfigMap)).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.findServersForSecret)).
+		Watches(&source.Kind{Type: &cometdv1alpha1.CometServerBackup{}}, handler.EnqueueRequestsFromMapFunc(r.findServersForBackup)).
 		Complete(r)
 }
 
 // --
 
+func getCometServerFinalBackup(cs *cometdv1alpha1.CometServer) *cometdv1alpha1.CometServerBackup {
+	return &cometdv1alpha1.CometServerBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-final", cs.Name),
+			Namespace: cs.Namespace,
+			Labels:    map[string]string{"app": cs.Name},
+		},
+		Spec: cometdv1alpha1.CometServerBackupSpec{
+			ServerRef: cs.Name,
+			Target: cometdv1alpha1.CometServerBackupTarget{
+				VolumeSnapshot: &cometdv1alpha1.CometServerBackupVolumeSnapshotTarget{
+					VolumeSnapshotClassName: cs.Spec.Storage.VolumeSnapshotClassName,
+				},
+			},
+		},
+	}
+}
+
 func getCometServerService(cs *cometdv1alpha1.CometServer) *corev1.Service {
 	labels := map[string]string{"app": cs.Name}
 	return &corev1.Service{
@@ -298,9 +668,40 @@ func getCometServerService(cs *cometdv1alpha1.CometServer) *corev1.Service {
 	}
 }
 
-func getCometServerIngress(cs *cometdv1alpha1.CometServer) *networkingv1.Ingress {
+func getCometServerMaintenanceService(cs *cometdv1alpha1.CometServer, backend string) *corev1.Service {
+	labels := map[string]string{"app": cs.Name}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-maintenance", cs.Name),
+			Namespace: cs.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:         corev1.ServiceTypeExternalName,
+			ExternalName: backend,
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "web",
+					Port:     cometMaintenancePort,
+					Protocol: corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+}
+
+// getCometServerIngress routes to the Comet Server, or to the maintenance page while it's unavailable.
+func getCometServerIngress(cs *cometdv1alpha1.CometServer, maintenance bool) *networkingv1.Ingress {
 	labels := map[string]string{"app": cs.Name}
 	ingressClassName := "traefik"
+	backend := fmt.Sprintf("%s-service", cs.Name)
+	if maintenance {
+		backend = fmt.Sprintf("%s-maintenance", cs.Name)
+	}
 	return &networkingv1.Ingress{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Ingress",
@@ -327,7 +728,7 @@ func getCometServerIngress(cs *cometdv1alpha1.CometServer) *networkingv1.Ingress
 			},
 			DefaultBackend: &networkingv1.IngressBackend{
 				Service: &networkingv1.IngressServiceBackend{
-					Name: fmt.Sprintf("%s-service", cs.Name),
+					Name: backend,
 					Port: networkingv1.ServiceBackendPort{
 						Name: "web",
 					},
@@ -337,10 +738,10 @@ func getCometServerIngress(cs *cometdv1alpha1.CometServer) *networkingv1.Ingress
 	}
 }
 
-func getCometServerPVC(cs *cometdv1alpha1.CometServer) *corev1.PersistentVolumeClaim {
+func getCometServerPVC(cs *cometdv1alpha1.CometServer, restore *cometServerRestoreSource) *corev1.PersistentVolumeClaim {
 	labels := map[string]string{"app": cs.Name}
 	storageClassName := "hostpath"
-	return &corev1.PersistentVolumeClaim{
+	pvc := &corev1.PersistentVolumeClaim{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "PersistentVolumeClaim",
 			APIVersion: "v1",
@@ -357,26 +758,87 @@ func getCometServerPVC(cs *cometdv1alpha1.CometServer) *corev1.PersistentVolumeC
 			StorageClassName: &storageClassName,
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					"storage": resource.MustParse("8Gi"),
+					"storage": cs.StorageSize(),
 				},
 			},
 		},
 	}
+	if restore != nil && restore.VolumeSnapshot != "" {
+		apiGroup := volumeSnapshotGVK.Group
+		pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{
+			APIGroup: &apiGroup,
+			Kind:     volumeSnapshotGVK.Kind,
+			Name:     restore.VolumeSnapshot,
+		}
+	}
+	return pvc
 }
 
 func getCometServerDeployment(cs *cometdv1alpha1.CometServer) *appsv1.Deployment {
 	labels := map[string]string{"app": cs.Name}
+	annotations := make(map[string]string, len(cs.Annotations)+1)
+	for k, v := range cs.Annotations {
+		if k == cometServerQuiescedBy || k == cometServerReconcilePaused {
+			continue
+		}
+		annotations[k] = v
+	}
+	// A backup may stop the Comet Server, so the data volume can be copied consistently
+	replicas := int32(1)
+	if _, ok := cs.Annotations[cometServerQuiescedBy]; ok || cs.Spec.Suspend {
+		replicas = 0
+	}
+	if cs.Status.ConfigHash != "" {
+		// Restart the pod whenever the rendered configuration changes
+		annotations[cometServerConfigHash] = cs.Status.ConfigHash
+	}
+	// The rendered configuration is copied onto the data volume before cometd starts. Unless the
+	// configuration is declared, it is only copied on first start up to bootstrap the admin account.
+	configMode := "initial"
+	if cs.Spec.Config != nil {
+		configMode = "replace"
+	}
 	podTemplateSpec := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:      labels,
-			Annotations: cs.Annotations,
+			Annotations: annotations,
 		},
 		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{
+					Name:            "cometd-config",
+					Image:           "ghcr.io/cometbackup/comet-server:" + cs.Spec.Version,
+					ImagePullPolicy: "Always",
+					Command: []string{
+						"/bin/sh", "-c",
+						`if [ "$COMET_CONFIG_MODE" = "replace" ] || [ ! -f /var/lib/cometd/cometd.cfg ]; then cp /etc/cometd/cometd.cfg /var/lib/cometd/cometd.cfg; fi`,
+					},
+					Env: []corev1.EnvVar{
+						{
+							Name:  "COMET_CONFIG_MODE",
+							Value: configMode,
+						},
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "cometd-data",
+							MountPath: "/var/lib/cometd",
+							SubPath:   "data",
+						},
+						{
+							Name:      "cometd-config",
+							MountPath: "/etc/cometd",
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
 			Containers: []corev1.Container{
 				{
-					Name:            "cometd",
+					Name:            cometdv1alpha1.CometServerContainer,
 					Image:           "ghcr.io/cometbackup/comet-server:" + cs.Spec.Version,
 					ImagePullPolicy: "Always",
+					Resources:       cs.Spec.Resources,
 					Ports: []corev1.ContainerPort{
 						{
 							Name:          "web",
@@ -419,9 +881,20 @@ func getCometServerDeployment(cs *cometdv1alpha1.CometServer) *appsv1.Deployment
 						},
 					},
 				},
+				{
+					Name: "cometd-config",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: fmt.Sprintf("%s-config", cs.Name),
+						},
+					},
+				},
 			},
 		},
 	}
+	if cs.Spec.LogFiles {
+		podTemplateSpec.Spec.Containers = append(podTemplateSpec.Spec.Containers, getCometServerLogsContainer(cs))
+	}
 	return &appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Deployment",
@@ -433,14 +906,53 @@ func getCometServerDeployment(cs *cometdv1alpha1.CometServer) *appsv1.Deployment
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
+			// The data volume is ReadWriteOnce, and cometd must never run twice against it -
+			// so replace the pod rather than rolling a second one alongside it.
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
 			Template: podTemplateSpec,
 		},
 	}
 }
 
+// getCometServerLogsContainer returns the sidecar which follows the newest log file of the Comet
+// Server, switching over when it starts a new one, so that the log files can be read as container
+// logs. It is only run with spec.logFiles.
+func getCometServerLogsContainer(cs *cometdv1alpha1.CometServer) corev1.Container {
+	return corev1.Container{
+		Name:            cometdv1alpha1.CometServerLogsContainer,
+		Image:           "ghcr.io/cometbackup/comet-server:" + cs.Spec.Version,
+		ImagePullPolicy: "Always",
+		Command: []string{
+			"/bin/sh", "-c",
+			`lines=100; current=""; while true; do latest=$(ls -t /var/log/cometd/*.log 2>/dev/null | head -n 1); if [ -n "$latest" ] && [ "$latest" != "$current" ]; then [ -n "$pid" ] && kill "$pid"; tail -n "$lines" -F "$latest" & pid=$!; current="$latest"; lines=+1; fi; sleep 10; done`,
+		},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("50m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "cometd-data",
+				MountPath: "/var/log/cometd",
+				SubPath:   "logs",
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
 // --
 
 type licenseCreateResponse struct {
@@ -449,12 +961,40 @@ type licenseCreateResponse struct {
 	} `json:"data"`
 }
 
-func newSerialNumber(issuer *cometdv1alpha1.CometLicenseIssuer, features *cometdv1alpha1.CometLicenseFeatures) (string, error) {
+// checkIssuerQuota returns errIssuerQuotaReached if the issuer's MaxServers other CometServers
+// already hold a serial number issued by it. The servers are listed uncached, as the cache may not
+// have seen the serial number just issued to another server yet.
+func (r *CometServerReconciler) checkIssuerQuota(ctx context.Context, cs *cometdv1alpha1.CometServer, issuer *cometdv1alpha1.CometLicenseIssuer) error {
+	if issuer.Spec.MaxServers == 0 {
+		return nil
+	}
+	servers := &cometdv1alpha1.CometServerList{}
+	if err := r.APIReader.List(ctx, servers, client.InNamespace(cs.Namespace)); err != nil {
+		return err
+	}
+	issued := 0
+	for i := range servers.Items {
+		other := &servers.Items[i]
+		if other.Name != cs.Name && other.Spec.License.Issuer == issuer.Name && other.SerialNumber() != "" {
+			issued++
+		}
+	}
+	if issued >= issuer.Spec.MaxServers {
+		return fmt.Errorf("%w: cometlicenseissuer/%s allows %d servers", errIssuerQuotaReached, issuer.Name, issuer.Spec.MaxServers)
+	}
+	return nil
+}
+
+func newSerialNumber(email, token string, features cometdv1alpha1.CometLicenseFeatures) (string, error) {
 	client := &http.Client{}
 	data := url.Values{
 		"auth_type": []string{"token"},
-		"email":     []string{issuer.Spec.Auth.Email},
-		"token":     []string{issuer.Spec.Auth.Token},
+		"email":     []string{email},
+		"token":     []string{token},
+	}
+	// Features left out keep the account default, which enables everything
+	for name, value := range features {
+		data.Set(name, strconv.Itoa(value))
 	}
 
 	resp, err := client.PostForm("https://account.cometbackup.com/api/v1/license/create_license", data)
@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+var _ = Describe("CometServer finalizer", func() {
+	var (
+		ctx   = context.Background()
+		c     client.Client
+		r     *CometServerReconciler
+		cs    *cometdv1alpha1.CometServer
+		pvc   *corev1.PersistentVolumeClaim
+		admin *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		cs = &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "cometd", Namespace: "default", UID: "cometd"},
+			Spec:       cometdv1alpha1.CometServerSpec{Version: "23.5.0"},
+		}
+		pvc = getCometServerPVC(cs, nil)
+		admin = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: cs.AdminSecretName(), Namespace: "default"}}
+		for _, obj := range []client.Object{pvc, admin} {
+			Expect(controllerutil.SetControllerReference(cs, obj, scheme.Scheme)).To(Succeed())
+		}
+		c = newFakeClient(cs, pvc, admin)
+		r = &CometServerReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	finalize := func() bool {
+		done, err := r.finalizeCometServer(ctx, ctrl.Log, cs)
+		Expect(err).NotTo(HaveOccurred())
+		return done
+	}
+
+	ownedBy := func(obj client.Object) bool {
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		return metav1.IsControlledBy(obj, cs)
+	}
+
+	It("leaves the data volume to be garbage collected by default", func() {
+		Expect(finalize()).To(BeTrue())
+		Expect(ownedBy(pvc)).To(BeTrue())
+		Expect(ownedBy(admin)).To(BeTrue())
+	})
+
+	It("retains the data volume and admin Secret", func() {
+		cs.Spec.Storage.DeletionPolicy = cometdv1alpha1.CometServerDeletionPolicyRetain
+		Expect(finalize()).To(BeTrue())
+		Expect(ownedBy(pvc)).To(BeFalse())
+		Expect(ownedBy(admin)).To(BeFalse())
+	})
+
+	Describe("with the Snapshot deletion policy", func() {
+		BeforeEach(func() {
+			cs.Spec.Storage.DeletionPolicy = cometdv1alpha1.CometServerDeletionPolicySnapshot
+		})
+
+		finalBackup := func() *cometdv1alpha1.CometServerBackup {
+			b := &cometdv1alpha1.CometServerBackup{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "cometd-final", Namespace: "default"}, b)).To(Succeed())
+			return b
+		}
+
+		It("waits for a final backup, which outlives the CometServer", func() {
+			Expect(finalize()).To(BeFalse())
+			b := finalBackup()
+			Expect(b.Spec.ServerRef).To(Equal("cometd"))
+			Expect(b.OwnerReferences).To(BeEmpty())
+
+			Expect(finalize()).To(BeFalse())
+			b.Status.Phase = cometdv1alpha1.CometServerBackupCompleted
+			Expect(c.Status().Update(ctx, b)).To(Succeed())
+			Expect(finalize()).To(BeTrue())
+		})
+
+		It("blocks deletion while the final backup failed", func() {
+			Expect(finalize()).To(BeFalse())
+			b := finalBackup()
+			b.Status.Phase = cometdv1alpha1.CometServerBackupFailed
+			Expect(c.Status().Update(ctx, b)).To(Succeed())
+			Expect(finalize()).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("CometServer deployment", func() {
+	var cs *cometdv1alpha1.CometServer
+
+	BeforeEach(func() {
+		cs = &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "cometd", Namespace: "default"},
+			Spec:       cometdv1alpha1.CometServerSpec{Version: "23.5.0"},
+		}
+	})
+
+	It("only runs the Comet Server by default", func() {
+		deployment := getCometServerDeployment(cs)
+		Expect(containerNames(deployment.Spec.Template.Spec.Containers)).To(Equal([]string{cometdv1alpha1.CometServerContainer}))
+	})
+
+	It("follows the log files in a limited sidecar with spec.logFiles", func() {
+		cs.Spec.LogFiles = true
+		deployment := getCometServerDeployment(cs)
+		containers := deployment.Spec.Template.Spec.Containers
+		Expect(containerNames(containers)).To(Equal([]string{cometdv1alpha1.CometServerContainer, cometdv1alpha1.CometServerLogsContainer}))
+		Expect(containers[1].Resources.Limits).To(HaveKey(corev1.ResourceCPU))
+		Expect(containers[1].Resources.Limits).To(HaveKey(corev1.ResourceMemory))
+		Expect(containers[1].VolumeMounts).To(ConsistOf(HaveField("ReadOnly", true)))
+	})
+})
@@ -0,0 +1,114 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+func newLicensedServer(name, issuer, serial string) *cometdv1alpha1.CometServer {
+	cs := &cometdv1alpha1.CometServer{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: cometdv1alpha1.CometServerSpec{
+			License: cometdv1alpha1.CometServerLicense{Issuer: issuer},
+		},
+	}
+	if serial != "" {
+		cs.Annotations = map[string]string{cometServerSerialNumber: serial}
+	}
+	return cs
+}
+
+func TestCheckIssuerQuota(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := cometdv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	issuer := &cometdv1alpha1.CometLicenseIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"},
+		Spec:       cometdv1alpha1.CometLicenseIssuerSpec{MaxServers: 2},
+	}
+	tests := []struct {
+		name    string
+		servers []client.Object
+		reached bool
+	}{
+		{
+			name:    "below the quota",
+			servers: []client.Object{newLicensedServer("a", "issuer", "A")},
+		},
+		{
+			name: "at the quota",
+			servers: []client.Object{
+				newLicensedServer("a", "issuer", "A"),
+				newLicensedServer("b", "issuer", "B"),
+			},
+			reached: true,
+		},
+		{
+			name: "servers without a serial number, or of another issuer",
+			servers: []client.Object{
+				newLicensedServer("a", "issuer", "A"),
+				newLicensedServer("b", "issuer", ""),
+				newLicensedServer("c", "other", "C"),
+			},
+		},
+		{
+			name: "its own serial number",
+			servers: []client.Object{
+				newLicensedServer("a", "issuer", "A"),
+				newLicensedServer("new", "issuer", "NEW"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The quota is counted from the API server, never from the cache
+			r := &CometServerReconciler{
+				Client:    fake.NewClientBuilder().WithScheme(scheme).Build(),
+				APIReader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.servers...).Build(),
+			}
+			err := r.checkIssuerQuota(context.Background(), newLicensedServer("new", "issuer", ""), issuer)
+			if tt.reached != errors.Is(err, errIssuerQuotaReached) {
+				t.Errorf("checkIssuerQuota() = %v, want quota reached %t", err, tt.reached)
+			}
+			if !tt.reached && err != nil {
+				t.Errorf("checkIssuerQuota() = %v", err)
+			}
+		})
+	}
+}
+
+func TestCometServerRequeueAfter(t *testing.T) {
+	cs := newLicensedServer("a", "issuer", "")
+	if got := cometServerRequeueAfter(cs); got != 0 {
+		t.Errorf("cometServerRequeueAfter() = %v, want no requeue", got)
+	}
+	setCometServerCondition(cs, conditionLicenseIssued, metav1.ConditionFalse, "QuotaReached", "")
+	if got := cometServerRequeueAfter(cs); got != issuerQuotaRetryInterval {
+		t.Errorf("cometServerRequeueAfter() = %v, want %v while waiting for the quota", got, issuerQuotaRetryInterval)
+	}
+}
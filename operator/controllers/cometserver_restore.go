@@ -0,0 +1,339 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+)
+
+const (
+	conditionRestored = "Restored"
+
+	restoreBackupRefIndexField = ".spec.restoreFrom.backupRef"
+)
+
+// cometServerRestoreSource is spec.restoreFrom, resolved to the data to restore.
+type cometServerRestoreSource struct {
+	// VolumeSnapshot to provision the data volume from.
+	VolumeSnapshot string
+	// S3 tarball to download onto the data volume, in rclone :s3: form, and its connection.
+	S3Path     string
+	S3Endpoint string
+	S3Region   string
+	S3Secret   corev1.LocalObjectReference
+	// SerialNumber to keep, if not in use.
+	SerialNumber string
+	// AdminSecret of the backed up server, holding credentials valid for the restored data.
+	AdminSecret string
+	// ConfigSecret holds a cometd.cfg to replace the restored one with.
+	ConfigSecret string
+}
+
+// isRestoring reports whether the data volume is still to be restored or cloned.
+func isRestoring(cs *cometdv1alpha1.CometServer) bool {
+	return (cs.Spec.RestoreFrom != nil || cs.Spec.CloneFrom != nil) && !meta.IsStatusConditionTrue(cs.Status.Conditions, conditionRestored)
+}
+
+// resolveRestoreSource returns the data to restore into a new CometServer. Returns nil once the
+// restore has completed, or while the source is not yet ready - the Restored condition says
+// which.
+func (r *CometServerReconciler) resolveRestoreSource(ctx context.Context, cs *cometdv1alpha1.CometServer) (*cometServerRestoreSource, error) {
+	if !isRestoring(cs) {
+		return nil, nil
+	}
+	if cs.Spec.CloneFrom != nil {
+		if cs.Spec.RestoreFrom != nil {
+			err := fmt.Errorf("restoreFrom and cloneFrom are mutually exclusive")
+			setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "InvalidSource", err.Error())
+			return nil, err
+		}
+		return r.resolveCloneSource(ctx, cs)
+	}
+	spec := cs.Spec.RestoreFrom
+
+	sources := 0
+	for _, set := range []bool{spec.BackupRef != "", spec.VolumeSnapshotRef != "", spec.S3 != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		err := fmt.Errorf("exactly one of restoreFrom.backupRef, restoreFrom.volumeSnapshotRef or restoreFrom.s3 must be set")
+		setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "InvalidSource", err.Error())
+		return nil, err
+	}
+
+	src := &cometServerRestoreSource{SerialNumber: spec.SerialNumber}
+	switch {
+	case spec.VolumeSnapshotRef != "":
+		src.VolumeSnapshot = spec.VolumeSnapshotRef
+	case spec.S3 != nil:
+		src.S3Path = fmt.Sprintf(":s3:%s/%s", spec.S3.Bucket, spec.S3.Key)
+		src.S3Endpoint = spec.S3.Endpoint
+		src.S3Region = spec.S3.Region
+		src.S3Secret = spec.S3.CredentialsSecretRef
+	default:
+		b := &cometdv1alpha1.CometServerBackup{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: spec.BackupRef, Namespace: cs.Namespace}, b)
+		if err != nil {
+			setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "BackupNotFound", err.Error())
+			return nil, err
+		}
+		if !isBackupCompleted(cs, b) {
+			return nil, nil
+		}
+		serial := src.SerialNumber
+		src = getRestoreSourceFromBackup(cs, b)
+		if serial != "" {
+			src.SerialNumber = serial
+		}
+	}
+	return src, nil
+}
+
+// isBackupCompleted reports whether the backup to restore has completed, otherwise recording
+// why the restore is waiting. The CometServer is reconciled again once the backup finishes.
+func isBackupCompleted(cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) bool {
+	switch b.Status.Phase {
+	case cometdv1alpha1.CometServerBackupCompleted:
+		return true
+	case cometdv1alpha1.CometServerBackupFailed:
+		setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "BackupFailed", fmt.Sprintf("cometserverbackup/%s failed: %s", b.Name, b.Status.Message))
+	default:
+		setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "BackupNotReady", fmt.Sprintf("Waiting for cometserverbackup/%s to complete.", b.Name))
+	}
+	return false
+}
+
+func getRestoreSourceFromBackup(cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) *cometServerRestoreSource {
+	src := &cometServerRestoreSource{SerialNumber: b.Status.SerialNumber}
+	if b.Spec.Target.S3 != nil {
+		s3 := b.Spec.Target.S3
+		src.S3Path = fmt.Sprintf(":s3:%s/%s", s3.Bucket, s3BackupKey(b))
+		src.S3Endpoint = s3.Endpoint
+		src.S3Region = s3.Region
+		src.S3Secret = s3.CredentialsSecretRef
+	} else {
+		src.VolumeSnapshot = b.Status.Location
+	}
+	if b.Spec.ServerRef != cs.Name {
+		src.AdminSecret = fmt.Sprintf("%s-admin", b.Spec.ServerRef)
+	}
+	return src
+}
+
+// restoredSerialNumber returns the serial number of the restored Comet Server, or an empty
+// string if a new one must be issued because it is unknown or in use by another CometServer.
+func (r *CometServerReconciler) restoredSerialNumber(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, src *cometServerRestoreSource) (string, error) {
+	if src.SerialNumber == "" {
+		return "", nil
+	}
+	list := &cometdv1alpha1.CometServerList{}
+	if err := r.Client.List(ctx, list); err != nil {
+		return "", err
+	}
+	for _, other := range list.Items {
+		if other.UID != cs.UID && other.SerialNumber() == src.SerialNumber {
+			reqLogger.Info("Restored serial number is in use - a new one will be issued.", "cometserver", types.NamespacedName{Name: other.Name, Namespace: other.Namespace})
+			r.Recorder.Event(cs, corev1.EventTypeWarning, "SerialNumberInUse", fmt.Sprintf("Serial number is in use by cometserver/%s in namespace %s.", other.Name, other.Namespace))
+			return "", nil
+		}
+	}
+	return src.SerialNumber, nil
+}
+
+// restoredAdminCredentials returns the admin credentials of the backed up server, if they
+// are still available.
+func (r *CometServerReconciler) restoredAdminCredentials(ctx context.Context, cs *cometdv1alpha1.CometServer, src *cometServerRestoreSource) (*cometAdminCredentials, error) {
+	if src == nil || src.AdminSecret == "" {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: src.AdminSecret, Namespace: cs.Namespace}, secret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	creds := &cometAdminCredentials{
+		Username: string(secret.Data[cometAdminUsernameKey]),
+		Password: string(secret.Data[cometAdminPasswordKey]),
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return nil, nil
+	}
+	return creds, nil
+}
+
+// reconcileCometServerRestore runs the <name>-restore job, which downloads the backup onto the
+// data volume (if restoring from S3) and verifies the restored data. Returns true once the data
+// volume is ready for the Comet Server to start.
+func (r *CometServerReconciler) reconcileCometServerRestore(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, src *cometServerRestoreSource) (bool, error) {
+	job := &batchv1.Job{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-restore", cs.Name), Namespace: cs.Namespace}, job)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+		job = getCometServerRestoreJob(cs, src)
+		controllerutil.SetControllerReference(cs, job, r.Scheme)
+		if err := r.Client.Create(ctx, job); err != nil {
+			return false, err
+		}
+		setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "Restoring", "Restoring the data volume.")
+		return false, nil
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			message := fmt.Sprintf("job/%s failed: %s - delete the job to retry.", job.Name, c.Message)
+			if cond := meta.FindStatusCondition(cs.Status.Conditions, conditionRestored); cond == nil || cond.Reason != "RestoreFailed" {
+				r.Recorder.Event(cs, corev1.EventTypeWarning, "RestoreFailed", message)
+			}
+			setCometServerCondition(cs, conditionRestored, metav1.ConditionFalse, "RestoreFailed", message)
+			return false, nil
+		}
+	}
+	if job.Status.Succeeded == 0 {
+		return false, nil
+	}
+
+	reqLogger.Info("Successfully restored data volume.")
+	r.Recorder.Event(cs, corev1.EventTypeNormal, "Restored", "Data volume restored and verified.")
+	setCometServerCondition(cs, conditionRestored, metav1.ConditionTrue, "Restored", "Data volume restored and verified.")
+	return true, nil
+}
+
+func setCometServerCondition(cs *cometdv1alpha1.CometServer, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&cs.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: cs.Generation,
+	})
+}
+
+// getCometServerRestoreJob runs the restore as a sequence of steps, the last as the job's
+// container and the others as init containers - download the backup (S3 only), verify the
+// restored cometd.cfg, then replace it with the clone's configuration (clones only).
+func getCometServerRestoreJob(cs *cometdv1alpha1.CometServer, src *cometServerRestoreSource) *batchv1.Job {
+	backoffLimit := int32(2)
+	dataMount := corev1.VolumeMount{
+		Name:      "cometd-data",
+		MountPath: "/var/lib/cometd",
+		SubPath:   "data",
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: "cometd-data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: fmt.Sprintf("%s-pvc", cs.Name),
+				},
+			},
+		},
+	}
+
+	// Volume snapshots are already restored by the provisioner - only verify them
+	var steps []corev1.Container
+	if src.S3Path != "" {
+		env := []corev1.EnvVar{{Name: "RESTORE_SRC", Value: src.S3Path}}
+		env = append(env, getRcloneS3Env(src.S3Endpoint, src.S3Region, src.S3Secret)...)
+		steps = append(steps, corev1.Container{
+			Name:         "restore",
+			Image:        cometBackupImage,
+			Command:      []string{"/bin/sh", "-c", `set -e; rclone cat "$RESTORE_SRC" | tar xzf - -C /var/lib/cometd`},
+			Env:          env,
+			VolumeMounts: []corev1.VolumeMount{dataMount},
+		})
+	}
+	// cometd.cfg must hold a single JSON object, with the admin accounts the operator signs in
+	// with. It is slurped, so an empty file fails too.
+	steps = append(steps, corev1.Container{
+		Name:  "verify",
+		Image: cometVerifyImage,
+		Args: []string{
+			"-e", "-s",
+			`if length == 1 and (.[0] | type == "object" and (.AdminUsers | type) == "array") then true else error("restored data does not contain a valid cometd.cfg") end`,
+			"/var/lib/cometd/cometd.cfg",
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		VolumeMounts:             []corev1.VolumeMount{dataMount},
+	})
+	if src.ConfigSecret != "" {
+		steps = append(steps, corev1.Container{
+			Name:    "configure",
+			Image:   cometBackupImage,
+			Command: []string{"/bin/sh", "-c", `cp /etc/cometd/cometd.cfg /var/lib/cometd/cometd.cfg`},
+			VolumeMounts: []corev1.VolumeMount{
+				dataMount,
+				{
+					Name:      "cometd-config",
+					MountPath: "/etc/cometd",
+					ReadOnly:  true,
+				},
+			},
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: "cometd-config",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: src.ConfigSecret,
+				},
+			},
+		})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-restore", cs.Name),
+			Namespace: cs.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:  corev1.RestartPolicyNever,
+					InitContainers: steps[:len(steps)-1],
+					Containers:     steps[len(steps)-1:],
+					Volumes:        volumes,
+				},
+			},
+		},
+	}
+}
+
+// findServersForBackup maps a CometServerBackup to the CometServers restoring it.
+func (r *CometServerReconciler) findServersForBackup(obj client.Object) []reconcile.Request {
+	return r.findServersByIndex(obj, restoreBackupRefIndexField)
+}
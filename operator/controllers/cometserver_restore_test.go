@@ -0,0 +1,213 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// containerNames returns the names of the containers, in order.
+func containerNames(containers []corev1.Container) []string {
+	names := make([]string, 0, len(containers))
+	for _, c := range containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+var _ = Describe("CometServer restore", func() {
+	var (
+		ctx = context.Background()
+		c   client.Client
+		r   *CometServerReconciler
+		cs  *cometdv1alpha1.CometServer
+		b   *cometdv1alpha1.CometServerBackup
+	)
+
+	BeforeEach(func() {
+		b = &cometdv1alpha1.CometServerBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+			Spec:       s3BackupSpec("old"),
+			Status: cometdv1alpha1.CometServerBackupStatus{
+				Phase:        cometdv1alpha1.CometServerBackupCompleted,
+				SerialNumber: "SERIAL",
+			},
+		}
+		cs = &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "cometd", Namespace: "default", UID: "cometd"},
+			Spec: cometdv1alpha1.CometServerSpec{
+				Version:     "23.5.0",
+				RestoreFrom: &cometdv1alpha1.CometServerRestore{BackupRef: b.Name},
+			},
+		}
+		c = newFakeClient(cs, b)
+		r = &CometServerReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	restoredCondition := func() *metav1.Condition {
+		cond := meta.FindStatusCondition(cs.Status.Conditions, conditionRestored)
+		Expect(cond).NotTo(BeNil())
+		return cond
+	}
+
+	Describe("resolving the restore source", func() {
+		It("restores a completed backup with its serial number and admin account", func() {
+			src, err := r.resolveRestoreSource(ctx, cs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(src).To(Equal(&cometServerRestoreSource{
+				S3Path:       ":s3:backups/old/nightly.tar.gz",
+				S3Endpoint:   "s3.example.com",
+				S3Secret:     corev1.LocalObjectReference{Name: "s3"},
+				SerialNumber: "SERIAL",
+				AdminSecret:  "old-admin",
+			}))
+		})
+
+		It("waits for the backup to complete", func() {
+			b.Status.Phase = cometdv1alpha1.CometServerBackupRunning
+			Expect(c.Update(ctx, b)).To(Succeed())
+			src, err := r.resolveRestoreSource(ctx, cs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(src).To(BeNil())
+			Expect(isRestoring(cs)).To(BeTrue())
+			Expect(restoredCondition().Reason).To(Equal("BackupNotReady"))
+		})
+
+		It("reports a failed backup", func() {
+			b.Status.Phase = cometdv1alpha1.CometServerBackupFailed
+			b.Status.Message = "job/nightly-backup: BackoffLimitExceeded"
+			Expect(c.Update(ctx, b)).To(Succeed())
+			src, err := r.resolveRestoreSource(ctx, cs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(src).To(BeNil())
+			Expect(restoredCondition().Reason).To(Equal("BackupFailed"))
+			Expect(restoredCondition().Message).To(ContainSubstring("BackoffLimitExceeded"))
+		})
+
+		It("fails when the backup doesn't exist", func() {
+			cs.Spec.RestoreFrom.BackupRef = "missing"
+			_, err := r.resolveRestoreSource(ctx, cs)
+			Expect(err).To(HaveOccurred())
+			Expect(restoredCondition().Status).To(Equal(metav1.ConditionFalse))
+			Expect(restoredCondition().Reason).To(Equal("BackupNotFound"))
+		})
+
+		It("requires exactly one source", func() {
+			cs.Spec.RestoreFrom.VolumeSnapshotRef = "snapshot"
+			_, err := r.resolveRestoreSource(ctx, cs)
+			Expect(err).To(MatchError(ContainSubstring("exactly one of")))
+			Expect(restoredCondition().Reason).To(Equal("InvalidSource"))
+		})
+
+		It("is done once restored", func() {
+			setCometServerCondition(cs, conditionRestored, metav1.ConditionTrue, "Restored", "")
+			src, err := r.resolveRestoreSource(ctx, cs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(src).To(BeNil())
+			Expect(isRestoring(cs)).To(BeFalse())
+		})
+	})
+
+	Describe("the restored serial number", func() {
+		It("is kept while unused", func() {
+			serial, err := r.restoredSerialNumber(ctx, ctrl.Log, cs, &cometServerRestoreSource{SerialNumber: "SERIAL"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serial).To(Equal("SERIAL"))
+		})
+
+		It("is dropped while another CometServer uses it", func() {
+			Expect(c.Create(ctx, &cometdv1alpha1.CometServer{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "old",
+					Namespace:   "default",
+					Annotations: map[string]string{cometServerSerialNumber: "SERIAL"},
+				},
+			})).To(Succeed())
+			serial, err := r.restoredSerialNumber(ctx, ctrl.Log, cs, &cometServerRestoreSource{SerialNumber: "SERIAL"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serial).To(BeEmpty())
+		})
+	})
+
+	Describe("the restore job", func() {
+		It("downloads an S3 backup before verifying it", func() {
+			job := getCometServerRestoreJob(cs, &cometServerRestoreSource{S3Path: ":s3:backups/old/nightly.tar.gz"})
+			Expect(containerNames(job.Spec.Template.Spec.InitContainers)).To(Equal([]string{"restore"}))
+			Expect(containerNames(job.Spec.Template.Spec.Containers)).To(Equal([]string{"verify"}))
+			Expect(job.Spec.Template.Spec.InitContainers[0].Env).To(ContainElement(
+				corev1.EnvVar{Name: "RESTORE_SRC", Value: ":s3:backups/old/nightly.tar.gz"},
+			))
+		})
+
+		It("only verifies a volume snapshot", func() {
+			job := getCometServerRestoreJob(cs, &cometServerRestoreSource{VolumeSnapshot: "snapshot"})
+			Expect(job.Spec.Template.Spec.InitContainers).To(BeEmpty())
+			Expect(containerNames(job.Spec.Template.Spec.Containers)).To(Equal([]string{"verify"}))
+		})
+
+		It("marks the CometServer restored once the job succeeds", func() {
+			src := &cometServerRestoreSource{VolumeSnapshot: "snapshot"}
+			restored, err := r.reconcileCometServerRestore(ctx, ctrl.Log, cs, src)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(BeFalse())
+			Expect(restoredCondition().Reason).To(Equal("Restoring"))
+
+			job := &batchv1.Job{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "cometd-restore", Namespace: "default"}, job)).To(Succeed())
+			job.Status.Succeeded = 1
+			Expect(c.Status().Update(ctx, job)).To(Succeed())
+
+			restored, err = r.reconcileCometServerRestore(ctx, ctrl.Log, cs, src)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(BeTrue())
+			Expect(restoredCondition().Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("reports a failed job", func() {
+			src := &cometServerRestoreSource{VolumeSnapshot: "snapshot"}
+			_, err := r.reconcileCometServerRestore(ctx, ctrl.Log, cs, src)
+			Expect(err).NotTo(HaveOccurred())
+
+			job := &batchv1.Job{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "cometd-restore", Namespace: "default"}, job)).To(Succeed())
+			job.Status.Conditions = []batchv1.JobCondition{{
+				Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded",
+			}}
+			Expect(c.Status().Update(ctx, job)).To(Succeed())
+
+			restored, err := r.reconcileCometServerRestore(ctx, ctrl.Log, cs, src)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(BeFalse())
+			Expect(restoredCondition().Reason).To(Equal("RestoreFailed"))
+			Expect(restoredCondition().Message).To(ContainSubstring("delete the job to retry"))
+		})
+	})
+})
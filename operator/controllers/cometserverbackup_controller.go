@@ -0,0 +1,549 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"path"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// cometBackupImage runs the S3 upload and delete jobs - it needs a shell, tar and rclone.
+	cometBackupImage = "rclone/rclone:1.62"
+	// cometVerifyImage verifies restored data - it needs jq.
+	cometVerifyImage = "ghcr.io/jqlang/jq:1.7.1"
+
+	// cometBackupPollInterval is how often a running backup is checked for completion.
+	cometBackupPollInterval = 10 * time.Second
+)
+
+var (
+	volumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+	// errBackupFailed marks errors which fail the backup, rather than being retried.
+	errBackupFailed = stderrors.New("backup failed")
+)
+
+// CometServerBackupReconciler reconciles a CometServerBackup object
+type CometServerBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometserverbackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometserverbackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometserverbackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
+
+// Reconcile copies the data volume of the referenced CometServer to the backup target. The
+// backup runs once - a finished backup is never retaken. Deleting the backup deletes its stored
+// data.
+func (r *CometServerBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx).WithValues("cometserverbackup", req.NamespacedName)
+	reqLogger.Info("Reconciling CometServerBackup")
+
+	// Fetch the CometServerBackup instance
+	b := &cometdv1alpha1.CometServerBackup{}
+	err := r.Get(ctx, req.NamespacedName, b)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			reqLogger.Info("CometServerBackup resource not found. Ignoring since object must be deleted.")
+			return ctrl.Result{}, nil
+		}
+		reqLogger.Error(err, "Failed to get CometServerBackup.")
+		return ctrl.Result{}, err
+	}
+
+	if b.GetDeletionTimestamp() != nil {
+		if controllerutil.ContainsFinalizer(b, cometServerFinalizer) {
+			done, err := r.finalizeCometServerBackup(ctx, reqLogger, b)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !done {
+				return ctrl.Result{RequeueAfter: cometBackupPollInterval}, nil
+			}
+			controllerutil.RemoveFinalizer(b, cometServerFinalizer)
+			if err := r.Update(ctx, b); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(b, cometServerFinalizer) {
+		controllerutil.AddFinalizer(b, cometServerFinalizer)
+		if err := r.Update(ctx, b); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if b.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	// --
+
+	result, err := r.reconcileCometServerBackup(ctx, reqLogger, b)
+	if err != nil {
+		reqLogger.Error(err, "Failed to run backup.")
+	}
+	if err := r.Client.Status().Update(ctx, b); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+func (r *CometServerBackupReconciler) reconcileCometServerBackup(ctx context.Context, reqLogger logr.Logger, b *cometdv1alpha1.CometServerBackup) (ctrl.Result, error) {
+	if b.Status.Phase == "" {
+		now := metav1.Now()
+		b.Status.Phase = cometdv1alpha1.CometServerBackupPending
+		b.Status.StartTime = &now
+	}
+
+	cs := &cometdv1alpha1.CometServer{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: b.Spec.ServerRef, Namespace: b.Namespace}, cs)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			r.finish(ctx, reqLogger, nil, b, fmt.Errorf("%w: cometserver/%s not found", errBackupFailed, b.Spec.ServerRef))
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if b.Status.SerialNumber == "" {
+		b.Status.SerialNumber = cs.SerialNumber()
+	}
+
+	target := b.Spec.Target
+	if (target.S3 == nil) == (target.VolumeSnapshot == nil) {
+		r.finish(ctx, reqLogger, cs, b, fmt.Errorf("%w: exactly one of target.s3 or target.volumeSnapshot must be set", errBackupFailed))
+		return ctrl.Result{}, nil
+	}
+
+	// Quiesce
+	if b.Spec.Quiesce {
+		stopped, err := r.quiesceCometServer(ctx, reqLogger, cs, b)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !stopped {
+			return ctrl.Result{RequeueAfter: cometBackupPollInterval}, nil
+		}
+	}
+
+	// Copy
+	b.Status.Phase = cometdv1alpha1.CometServerBackupRunning
+	var done bool
+	if target.S3 != nil {
+		done, err = r.reconcileS3Backup(ctx, cs, b)
+	} else {
+		done, err = r.reconcileVolumeSnapshotBackup(ctx, reqLogger, cs, b)
+	}
+	if err != nil {
+		if stderrors.Is(err, errBackupFailed) {
+			r.finish(ctx, reqLogger, cs, b, err)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !done {
+		return ctrl.Result{RequeueAfter: cometBackupPollInterval}, nil
+	}
+	r.finish(ctx, reqLogger, cs, b, nil)
+	return ctrl.Result{}, nil
+}
+
+// finish records the result of the backup, and restarts the Comet Server if it was quiesced.
+// cs may be nil if the CometServer no longer exists.
+func (r *CometServerBackupReconciler) finish(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup, backupErr error) {
+	if cs != nil {
+		if err := r.releaseCometServer(ctx, cs, b); err != nil {
+			// Not fatal to the backup - the finalizer retries the release
+			reqLogger.Error(err, "Failed to restart quiesced CometServer.")
+		}
+	}
+
+	now := metav1.Now()
+	b.Status.CompletionTime = &now
+	if b.Status.StartTime != nil {
+		b.Status.Duration = &metav1.Duration{Duration: now.Sub(b.Status.StartTime.Time).Round(time.Second)}
+	}
+	if backupErr != nil {
+		b.Status.Phase = cometdv1alpha1.CometServerBackupFailed
+		b.Status.Message = backupErr.Error()
+		r.Recorder.Event(b, corev1.EventTypeWarning, "Failed", backupErr.Error())
+		return
+	}
+	b.Status.Phase = cometdv1alpha1.CometServerBackupCompleted
+	b.Status.Message = ""
+	r.Recorder.Event(b, corev1.EventTypeNormal, "Completed", fmt.Sprintf("Backup of cometserver/%s stored at %s.", b.Spec.ServerRef, b.Status.Location))
+}
+
+// quiesceCometServer scales the Comet Server down for the backup. Returns true once no
+// cometd pod is running.
+func (r *CometServerBackupReconciler) quiesceCometServer(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) (bool, error) {
+	holder, ok := cs.Annotations[cometServerQuiescedBy]
+	if !ok {
+		if cs.Annotations == nil {
+			cs.Annotations = make(map[string]string)
+		}
+		cs.Annotations[cometServerQuiescedBy] = b.Name
+		if err := r.Client.Update(ctx, cs); err != nil {
+			return false, err
+		}
+		r.Recorder.Event(b, corev1.EventTypeNormal, "Quiesced", fmt.Sprintf("Stopping cometserver/%s for the backup.", cs.Name))
+		return false, nil
+	}
+	if holder != b.Name {
+		// Another backup has stopped the server - wait for it to finish
+		reqLogger.Info("CometServer is quiesced by another backup.", "cometserverbackup", holder)
+		return false, nil
+	}
+
+	pods := &corev1.PodList{}
+	err := r.Client.List(ctx, pods, client.InNamespace(cs.Namespace), client.MatchingLabels{"app": cs.Name})
+	if err != nil {
+		return false, err
+	}
+	return len(pods.Items) == 0, nil
+}
+
+// releaseCometServer restarts the Comet Server, if it was quiesced by this backup.
+func (r *CometServerBackupReconciler) releaseCometServer(ctx context.Context, cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) error {
+	if cs.Annotations[cometServerQuiescedBy] != b.Name {
+		return nil
+	}
+	delete(cs.Annotations, cometServerQuiescedBy)
+	return r.Client.Update(ctx, cs)
+}
+
+// reconcileS3Backup runs a job which streams a tarball of the data volume to the bucket.
+func (r *CometServerBackupReconciler) reconcileS3Backup(ctx context.Context, cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) (bool, error) {
+	job := &batchv1.Job{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-backup", b.Name), Namespace: b.Namespace}, job)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+		job = getCometServerBackupJob(cs, b)
+		controllerutil.SetControllerReference(b, job, r.Scheme)
+		if err := r.Client.Create(ctx, job); err != nil {
+			return false, err
+		}
+		b.Status.Location = fmt.Sprintf("s3://%s/%s", b.Spec.Target.S3.Bucket, s3BackupKey(b))
+		return false, nil
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return false, fmt.Errorf("%w: job/%s: %s", errBackupFailed, job.Name, c.Message)
+		}
+	}
+	if job.Status.Succeeded == 0 {
+		return false, nil
+	}
+
+	// The job reports the uploaded size as its termination message
+	pods := &corev1.PodList{}
+	err = r.Client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated == nil || terminated.ExitCode != 0 || terminated.Message == "" {
+				continue
+			}
+			size := struct {
+				Bytes int64 `json:"bytes"`
+			}{}
+			if err := json.Unmarshal([]byte(terminated.Message), &size); err == nil {
+				b.Status.Size = resource.NewQuantity(size.Bytes, resource.BinarySI)
+			}
+		}
+	}
+	return true, nil
+}
+
+// reconcileVolumeSnapshotBackup takes a CSI snapshot of the data volume.
+func (r *CometServerBackupReconciler) reconcileVolumeSnapshotBackup(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) (bool, error) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	err := r.Client.Get(ctx, types.NamespacedName{Name: b.Name, Namespace: b.Namespace}, snapshot)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, fmt.Errorf("%w: the VolumeSnapshot API is not installed in the cluster", errBackupFailed)
+		}
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+		snapshot = getCometServerVolumeSnapshot(cs, b)
+		controllerutil.SetControllerReference(b, snapshot, r.Scheme)
+		if err := r.Client.Create(ctx, snapshot); err != nil {
+			return false, err
+		}
+		b.Status.Location = snapshot.GetName()
+		return false, nil
+	}
+
+	if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+		return false, fmt.Errorf("%w: volumesnapshot/%s: %s", errBackupFailed, snapshot.GetName(), message)
+	}
+	// The point-in-time copy is cut once the snapshot has a creation time - the Comet Server
+	// can be restarted while the snapshot is still being uploaded.
+	if _, found, _ := unstructured.NestedString(snapshot.Object, "status", "creationTime"); found {
+		if err := r.releaseCometServer(ctx, cs, b); err != nil {
+			return false, err
+		}
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	if !ready {
+		return false, nil
+	}
+	if size, found, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); found {
+		if q, err := resource.ParseQuantity(size); err == nil {
+			b.Status.Size = &q
+		}
+	}
+	reqLogger.Info("VolumeSnapshot ready.", "volumesnapshot", snapshot.GetName())
+	return true, nil
+}
+
+// finalizeCometServerBackup deletes the stored backup. Returns true once it is gone.
+// VolumeSnapshots are owned by the backup, and garbage collected with it.
+func (r *CometServerBackupReconciler) finalizeCometServerBackup(ctx context.Context, reqLogger logr.Logger, b *cometdv1alpha1.CometServerBackup) (bool, error) {
+	cs := &cometdv1alpha1.CometServer{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: b.Spec.ServerRef, Namespace: b.Namespace}, cs)
+	if err == nil {
+		if err := r.releaseCometServer(ctx, cs, b); err != nil {
+			return false, err
+		}
+	} else if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	if b.Spec.Target.S3 != nil && b.Status.Location != "" {
+		job := &batchv1.Job{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-delete", b.Name), Namespace: b.Namespace}, job)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return false, err
+			}
+			job = getCometServerBackupDeleteJob(b)
+			controllerutil.SetControllerReference(b, job, r.Scheme)
+			if err := r.Client.Create(ctx, job); err != nil {
+				return false, err
+			}
+			return false, nil
+		}
+		for _, c := range job.Status.Conditions {
+			if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+				// Don't block deletion forever - the object is left in the bucket
+				r.Recorder.Event(b, corev1.EventTypeWarning, "DeleteFailed", fmt.Sprintf("Failed to delete %s: %s", b.Status.Location, c.Message))
+				return true, nil
+			}
+		}
+		if job.Status.Succeeded == 0 {
+			return false, nil
+		}
+	}
+	reqLogger.Info("Successfully finalized CometServerBackup.")
+	return true, nil
+}
+
+// --
+
+// s3BackupKey is the object key of the backup tarball.
+func s3BackupKey(b *cometdv1alpha1.CometServerBackup) string {
+	return path.Join(b.Spec.Target.S3.Prefix, b.Spec.ServerRef, b.Name+".tar.gz")
+}
+
+// getS3BackupEnv configures rclone for the S3 target through environment variables.
+func getS3BackupEnv(b *cometdv1alpha1.CometServerBackup) []corev1.EnvVar {
+	s3 := b.Spec.Target.S3
+	env := []corev1.EnvVar{
+		{Name: "BACKUP_DEST", Value: fmt.Sprintf(":s3:%s/%s", s3.Bucket, s3BackupKey(b))},
+	}
+	return append(env, getRcloneS3Env(s3.Endpoint, s3.Region, s3.CredentialsSecretRef)...)
+}
+
+// getRcloneS3Env configures the rclone :s3: backend, with credentials from a Secret with
+// accessKeyID and secretAccessKey keys.
+func getRcloneS3Env(endpoint, region string, credentials corev1.LocalObjectReference) []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: "RCLONE_S3_PROVIDER", Value: "Other"},
+		{Name: "RCLONE_S3_ENDPOINT", Value: endpoint},
+		{
+			Name: "RCLONE_S3_ACCESS_KEY_ID",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: credentials, Key: "accessKeyID"},
+			},
+		},
+		{
+			Name: "RCLONE_S3_SECRET_ACCESS_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: credentials, Key: "secretAccessKey"},
+			},
+		},
+	}
+	if region != "" {
+		env = append(env, corev1.EnvVar{Name: "RCLONE_S3_REGION", Value: region})
+	}
+	return env
+}
+
+func getCometServerBackupJob(cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) *batchv1.Job {
+	backoffLimit := int32(2)
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers: []corev1.Container{
+			{
+				Name:  "backup",
+				Image: cometBackupImage,
+				Command: []string{
+					"/bin/sh", "-c",
+					`set -e; tar czf - -C /var/lib/cometd . | rclone rcat "$BACKUP_DEST"; rclone size --json "$BACKUP_DEST" > /dev/termination-log`,
+				},
+				Env: getS3BackupEnv(b),
+				VolumeMounts: []corev1.VolumeMount{
+					{
+						Name:      "cometd-data",
+						MountPath: "/var/lib/cometd",
+						SubPath:   "data",
+						ReadOnly:  true,
+					},
+				},
+			},
+		},
+		Volumes: []corev1.Volume{
+			{
+				Name: "cometd-data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: fmt.Sprintf("%s-pvc", cs.Name),
+						ReadOnly:  true,
+					},
+				},
+			},
+		},
+	}
+	if !b.Spec.Quiesce && !cs.Spec.Suspend {
+		// The data volume is ReadWriteOnce - run on the same node as the Comet Server to mount it
+		podSpec.Affinity = &corev1.Affinity{
+			PodAffinity: &corev1.PodAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+					{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"app": cs.Name},
+						},
+						TopologyKey: corev1.LabelHostname,
+					},
+				},
+			},
+		}
+	}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-backup", b.Name),
+			Namespace: b.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+func getCometServerBackupDeleteJob(b *cometdv1alpha1.CometServerBackup) *batchv1.Job {
+	backoffLimit := int32(2)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-delete", b.Name),
+			Namespace: b.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "delete",
+							Image:   cometBackupImage,
+							Command: []string{"/bin/sh", "-c", `rclone deletefile "$BACKUP_DEST"`},
+							Env:     getS3BackupEnv(b),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func getCometServerVolumeSnapshot(cs *cometdv1alpha1.CometServer, b *cometdv1alpha1.CometServerBackup) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": fmt.Sprintf("%s-pvc", cs.Name),
+		},
+	}
+	if class := b.Spec.Target.VolumeSnapshot.VolumeSnapshotClassName; class != "" {
+		spec["volumeSnapshotClassName"] = class
+	}
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(b.Name)
+	snapshot.SetNamespace(b.Namespace)
+	return snapshot
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CometServerBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cometdv1alpha1.CometServerBackup{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
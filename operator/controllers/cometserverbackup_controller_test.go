@@ -0,0 +1,252 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// s3BackupSpec backs up server to an S3 bucket.
+func s3BackupSpec(server string) cometdv1alpha1.CometServerBackupSpec {
+	return cometdv1alpha1.CometServerBackupSpec{
+		ServerRef: server,
+		Target: cometdv1alpha1.CometServerBackupTarget{
+			S3: &cometdv1alpha1.CometServerBackupS3Target{
+				Endpoint:             "s3.example.com",
+				Bucket:               "backups",
+				CredentialsSecretRef: corev1.LocalObjectReference{Name: "s3"},
+			},
+		},
+	}
+}
+
+var _ = Describe("CometServerBackup controller", func() {
+	var (
+		ctx = context.Background()
+		c   client.Client
+		r   *CometServerBackupReconciler
+		b   *cometdv1alpha1.CometServerBackup
+	)
+
+	BeforeEach(func() {
+		cs := &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "cometd", Namespace: "default"},
+			Spec:       cometdv1alpha1.CometServerSpec{Version: "23.5.0"},
+		}
+		b = &cometdv1alpha1.CometServerBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+			Spec:       s3BackupSpec(cs.Name),
+		}
+		c = newFakeClient(cs, b)
+		r = &CometServerBackupReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	reconcile := func() *cometdv1alpha1.CometServerBackup {
+		_, err := r.Reconcile(ctx, reconcileRequest(b))
+		Expect(err).NotTo(HaveOccurred())
+		current := &cometdv1alpha1.CometServerBackup{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(b), current)).To(Succeed())
+		return current
+	}
+
+	job := func(name string) *batchv1.Job {
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, job)).To(Succeed())
+		return job
+	}
+
+	It("runs a job uploading the data volume", func() {
+		current := reconcile()
+		Expect(current.Status.Phase).To(Equal(cometdv1alpha1.CometServerBackupRunning))
+		Expect(current.Status.Location).To(Equal("s3://backups/cometd/nightly.tar.gz"))
+		Expect(current.Finalizers).To(ContainElement(cometServerFinalizer))
+		Expect(metav1.IsControlledBy(job("nightly-backup"), current)).To(BeTrue())
+	})
+
+	It("completes with the size reported by the job", func() {
+		reconcile()
+		upload := job("nightly-backup")
+		upload.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, upload)).To(Succeed())
+		Expect(c.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly-backup-x", Namespace: "default", Labels: map[string]string{"job-name": upload.Name}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: `{"bytes":2048}`}},
+			}}},
+		})).To(Succeed())
+
+		current := reconcile()
+		Expect(current.Status.Phase).To(Equal(cometdv1alpha1.CometServerBackupCompleted))
+		Expect(current.Status.Size.Value()).To(Equal(int64(2048)))
+		Expect(current.Status.CompletionTime).NotTo(BeNil())
+	})
+
+	It("fails with the job", func() {
+		reconcile()
+		upload := job("nightly-backup")
+		upload.Status.Conditions = []batchv1.JobCondition{{
+			Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded",
+		}}
+		Expect(c.Status().Update(ctx, upload)).To(Succeed())
+
+		current := reconcile()
+		Expect(current.Status.Phase).To(Equal(cometdv1alpha1.CometServerBackupFailed))
+		Expect(current.Status.Message).To(ContainSubstring("BackoffLimitExceeded"))
+	})
+
+	It("fails when the CometServer doesn't exist", func() {
+		b.Spec.ServerRef = "missing"
+		Expect(c.Update(ctx, b)).To(Succeed())
+		current := reconcile()
+		Expect(current.Status.Phase).To(Equal(cometdv1alpha1.CometServerBackupFailed))
+		Expect(current.Status.Message).To(ContainSubstring("cometserver/missing not found"))
+	})
+
+	It("deletes the uploaded tarball before removing the finalizer", func() {
+		current := reconcile()
+		Expect(c.Delete(ctx, current)).To(Succeed())
+
+		current = reconcile()
+		Expect(current.Finalizers).To(ContainElement(cometServerFinalizer))
+		remove := job("nightly-delete")
+		remove.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, remove)).To(Succeed())
+
+		_, err := r.Reconcile(ctx, reconcileRequest(b))
+		Expect(err).NotTo(HaveOccurred())
+		err = c.Get(ctx, client.ObjectKeyFromObject(b), current)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("CometServerBackupSchedule controller", func() {
+	var (
+		ctx = context.Background()
+		c   client.Client
+		r   *CometServerBackupScheduleReconciler
+		bs  *cometdv1alpha1.CometServerBackupSchedule
+	)
+
+	BeforeEach(func() {
+		bs = &cometdv1alpha1.CometServerBackupSchedule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "hourly",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+			},
+			Spec: cometdv1alpha1.CometServerBackupScheduleSpec{
+				Schedule:                "0 * * * *",
+				Template:                s3BackupSpec("cometd"),
+				SuccessfulBackupsToKeep: 1,
+				FailedBackupsToKeep:     1,
+			},
+		}
+		c = newFakeClient(bs)
+		r = &CometServerBackupScheduleReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	reconcile := func() *cometdv1alpha1.CometServerBackupSchedule {
+		_, err := r.Reconcile(ctx, reconcileRequest(bs))
+		Expect(err).NotTo(HaveOccurred())
+		current := &cometdv1alpha1.CometServerBackupSchedule{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bs), current)).To(Succeed())
+		return current
+	}
+
+	backups := func() []cometdv1alpha1.CometServerBackup {
+		list := &cometdv1alpha1.CometServerBackupList{}
+		Expect(c.List(ctx, list, client.InNamespace("default"))).To(Succeed())
+		return list.Items
+	}
+
+	// backup adds a finished backup of the schedule, created age ago
+	backup := func(name string, phase cometdv1alpha1.CometServerBackupPhase, age time.Duration) {
+		Expect(c.Create(ctx, &cometdv1alpha1.CometServerBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{cometBackupScheduleLabel: bs.Name},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			},
+			Spec:   bs.Spec.Template,
+			Status: cometdv1alpha1.CometServerBackupStatus{Phase: phase},
+		})).To(Succeed())
+	}
+
+	It("creates a backup once the schedule is due", func() {
+		current := reconcile()
+		Expect(current.Status.LastScheduleTime).NotTo(BeNil())
+		Expect(backups()).To(ConsistOf(And(
+			HaveField("Labels", HaveKeyWithValue(cometBackupScheduleLabel, "hourly")),
+			HaveField("Spec", Equal(bs.Spec.Template)),
+		)))
+
+		// Not due again until the next hour
+		reconcile()
+		Expect(backups()).To(HaveLen(1))
+	})
+
+	It("doesn't create backups while suspended", func() {
+		bs.Spec.Suspend = true
+		Expect(c.Update(ctx, bs)).To(Succeed())
+		reconcile()
+		Expect(backups()).To(BeEmpty())
+	})
+
+	It("keeps only the newest backups", func() {
+		bs.Spec.Suspend = true
+		Expect(c.Update(ctx, bs)).To(Succeed())
+		backup("hourly-1", cometdv1alpha1.CometServerBackupCompleted, 3*time.Hour)
+		backup("hourly-2", cometdv1alpha1.CometServerBackupCompleted, 2*time.Hour)
+		backup("hourly-3", cometdv1alpha1.CometServerBackupFailed, 90*time.Minute)
+		backup("hourly-4", cometdv1alpha1.CometServerBackupFailed, time.Hour)
+
+		current := reconcile()
+		Expect(current.Status.LastSuccessfulBackup).To(Equal("hourly-2"))
+		Expect(backups()).To(ConsistOf(HaveField("Name", "hourly-2"), HaveField("Name", "hourly-4")))
+	})
+
+	It("keeps a backup a CometServer is restoring from", func() {
+		bs.Spec.Suspend = true
+		Expect(c.Update(ctx, bs)).To(Succeed())
+		backup("hourly-1", cometdv1alpha1.CometServerBackupCompleted, 3*time.Hour)
+		backup("hourly-2", cometdv1alpha1.CometServerBackupCompleted, 2*time.Hour)
+		Expect(c.Create(ctx, &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "restored", Namespace: "default"},
+			Spec: cometdv1alpha1.CometServerSpec{
+				RestoreFrom: &cometdv1alpha1.CometServerRestore{BackupRef: "hourly-1"},
+			},
+		})).To(Succeed())
+
+		reconcile()
+		Expect(backups()).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,202 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// cometBackupScheduleLabel names the CometServerBackupSchedule which created a backup.
+const cometBackupScheduleLabel = "cometd.cometbackup.com/schedule"
+
+// CometServerBackupScheduleReconciler reconciles a CometServerBackupSchedule object
+type CometServerBackupScheduleReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometserverbackupschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometserverbackupschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometserverbackupschedules/finalizers,verbs=update
+
+// Reconcile creates a CometServerBackup whenever the schedule is due, and prunes backups past
+// the retention limits. Backups are not owned by the schedule, so deleting the schedule keeps
+// them.
+func (r *CometServerBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx).WithValues("cometserverbackupschedule", req.NamespacedName)
+	reqLogger.Info("Reconciling CometServerBackupSchedule")
+
+	// Fetch the CometServerBackupSchedule instance
+	bs := &cometdv1alpha1.CometServerBackupSchedule{}
+	err := r.Get(ctx, req.NamespacedName, bs)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			reqLogger.Info("CometServerBackupSchedule resource not found. Ignoring since object must be deleted.")
+			return ctrl.Result{}, nil
+		}
+		reqLogger.Error(err, "Failed to get CometServerBackupSchedule.")
+		return ctrl.Result{}, err
+	}
+
+	// Retention
+	backups := &cometdv1alpha1.CometServerBackupList{}
+	err = r.Client.List(ctx, backups, client.InNamespace(bs.Namespace), client.MatchingLabels{cometBackupScheduleLabel: bs.Name})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Newest first
+	sort.Slice(backups.Items, func(i, j int) bool {
+		return backups.Items[j].CreationTimestamp.Before(&backups.Items[i].CreationTimestamp)
+	})
+	running := false
+	var completed, failed []cometdv1alpha1.CometServerBackup
+	for _, b := range backups.Items {
+		switch {
+		case !b.GetDeletionTimestamp().IsZero():
+		case b.Status.Phase == cometdv1alpha1.CometServerBackupCompleted:
+			completed = append(completed, b)
+		case b.Status.Phase == cometdv1alpha1.CometServerBackupFailed:
+			failed = append(failed, b)
+		default:
+			running = true
+		}
+	}
+	if len(completed) > 0 {
+		bs.Status.LastSuccessfulBackup = completed[0].Name
+	}
+	if err := r.pruneBackups(ctx, completed, bs.Spec.SuccessfulBackupsToKeep); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.pruneBackups(ctx, failed, bs.Spec.FailedBackupsToKeep); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Schedule
+	sched, err := cron.ParseStandard(bs.Spec.Schedule)
+	if err != nil {
+		// Nothing to retry until the spec is fixed
+		r.Recorder.Event(bs, corev1.EventTypeWarning, "InvalidSchedule", err.Error())
+		return ctrl.Result{}, r.Client.Status().Update(ctx, bs)
+	}
+	if bs.Spec.Suspend {
+		return ctrl.Result{}, r.Client.Status().Update(ctx, bs)
+	}
+
+	now := time.Now()
+	last := bs.CreationTimestamp.Time
+	if bs.Status.LastScheduleTime != nil {
+		last = bs.Status.LastScheduleTime.Time
+	}
+	next := sched.Next(last)
+	if !now.Before(next) {
+		// Missed runs are not caught up - only a single backup is taken when overdue
+		if running {
+			r.Recorder.Event(bs, corev1.EventTypeWarning, "Skipped", "Previous backup is still running.")
+		} else {
+			// Named after the scheduled time, so a retry after failing to record the
+			// LastScheduleTime finds the backup it already created
+			b := getScheduledCometServerBackup(bs, next)
+			err := r.Client.Create(ctx, b)
+			if err != nil && !errors.IsAlreadyExists(err) {
+				return ctrl.Result{}, err
+			}
+			if err == nil {
+				r.Recorder.Event(bs, corev1.EventTypeNormal, "Scheduled", fmt.Sprintf("Created cometserverbackup/%s.", b.Name))
+			}
+		}
+		bs.Status.LastScheduleTime = &metav1.Time{Time: now}
+		next = sched.Next(now)
+	}
+	if err := r.Client.Status().Update(ctx, bs); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+}
+
+// pruneBackups deletes all but the newest keep backups. backups must be sorted newest first.
+// Backups a CometServer is restoring from, through spec.restoreFrom.backupRef, are kept. The
+// index is registered by the CometServerReconciler.
+func (r *CometServerBackupScheduleReconciler) pruneBackups(ctx context.Context, backups []cometdv1alpha1.CometServerBackup, keep int) error {
+	for i := keep; i < len(backups); i++ {
+		servers := &cometdv1alpha1.CometServerList{}
+		err := r.Client.List(ctx, servers, client.InNamespace(backups[i].Namespace), client.MatchingFields{restoreBackupRefIndexField: backups[i].Name})
+		if err != nil {
+			return err
+		}
+		if len(servers.Items) > 0 {
+			continue
+		}
+		if err := r.Client.Delete(ctx, &backups[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func getScheduledCometServerBackup(bs *cometdv1alpha1.CometServerBackupSchedule, scheduled time.Time) *cometdv1alpha1.CometServerBackup {
+	return &cometdv1alpha1.CometServerBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", bs.Name, scheduled.Unix()),
+			Namespace: bs.Namespace,
+			Labels: map[string]string{
+				cometBackupScheduleLabel: bs.Name,
+			},
+		},
+		Spec: bs.Spec.Template,
+	}
+}
+
+// findScheduleForBackup maps a CometServerBackup to the schedule which created it, so that
+// retention is applied as soon as a backup finishes.
+func (r *CometServerBackupScheduleReconciler) findScheduleForBackup(obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[cometBackupScheduleLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CometServerBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cometdv1alpha1.CometServerBackupSchedule{}).
+		Watches(
+			&source.Kind{Type: &cometdv1alpha1.CometServerBackup{}},
+			handler.EnqueueRequestsFromMapFunc(r.findScheduleForBackup),
+		).
+		Complete(r)
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/go-logr/logr"
+)
+
+const (
+	conditionProvisioned = "Provisioned"
+	conditionConnected   = "Connected"
+
+	// cometAPIRetryInterval is how long to wait before retrying a Comet Server which is unavailable.
+	cometAPIRetryInterval = 30 * time.Second
+	// cometAPIResyncInterval is how often to re-check resources managed through the Comet admin API,
+	// as changes made on the Comet Server itself do not trigger a reconcile.
+	cometAPIResyncInterval = 10 * time.Minute
+	// cometAPIFinalizeTimeout is how long to retry cleaning up a resource on an unavailable Comet
+	// Server, before it is left behind and the finalizer is removed.
+	cometAPIFinalizeTimeout = 10 * time.Minute
+
+	credentialsSecretRefIndexField = ".spec.credentialsSecretRef.name"
+)
+
+// CometStorageVaultReconciler reconciles a CometStorageVault object
+type CometStorageVaultReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometstoragevaults,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometstoragevaults/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometstoragevaults/finalizers,verbs=update
+
+// Reconcile provisions the storage template on the referenced CometServer through the Comet
+// admin API, and verifies that the Comet Server can connect to the object storage.
+func (r *CometStorageVaultReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx).WithValues("cometstoragevault", req.NamespacedName)
+	reqLogger.Info("Reconciling CometStorageVault")
+
+	// Fetch the CometStorageVault instance
+	sv := &cometdv1alpha1.CometStorageVault{}
+	err := r.Get(ctx, req.NamespacedName, sv)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			reqLogger.Info("CometStorageVault resource not found. Ignoring since object must be deleted.")
+			return ctrl.Result{}, nil
+		}
+		reqLogger.Error(err, "Failed to get CometStorageVault.")
+		return ctrl.Result{}, err
+	}
+
+	if sv.GetDeletionTimestamp() != nil {
+		if controllerutil.ContainsFinalizer(sv, cometServerFinalizer) {
+			if err := r.finalizeCometStorageVault(ctx, reqLogger, sv); err != nil {
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(sv, cometServerFinalizer)
+			if err := r.Update(ctx, sv); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(sv, cometServerFinalizer) {
+		controllerutil.AddFinalizer(sv, cometServerFinalizer)
+		if err := r.Update(ctx, sv); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// --
+
+	result, err := r.reconcileCometStorageVault(ctx, reqLogger, sv)
+	if err != nil {
+		reqLogger.Error(err, "Failed to provision storage template.")
+	}
+	if err := r.Client.Status().Update(ctx, sv); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+func (r *CometStorageVaultReconciler) reconcileCometStorageVault(ctx context.Context, reqLogger logr.Logger, sv *cometdv1alpha1.CometStorageVault) (ctrl.Result, error) {
+	cs := &cometdv1alpha1.CometServer{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: sv.Spec.ServerRef, Namespace: sv.Namespace}, cs)
+	if err != nil {
+		r.setCondition(sv, conditionProvisioned, metav1.ConditionFalse, "ServerUnavailable", err.Error())
+		return ctrl.Result{RequeueAfter: cometAPIRetryInterval}, err
+	}
+	if cs.Spec.Config != nil {
+		// A declared configuration replaces cometd.cfg on every start up, which would silently
+		// remove the storage template
+		r.setCondition(sv, conditionProvisioned, metav1.ConditionFalse, "ConfigDeclared", fmt.Sprintf("cometserver/%s declares spec.config - add the storage template to its RemoteStorage settings instead.", cs.Name))
+		return ctrl.Result{RequeueAfter: cometAPIResyncInterval}, nil
+	}
+	api, err := comet.ForServer(ctx, r.Client, cs)
+	if err != nil {
+		r.setCondition(sv, conditionProvisioned, metav1.ConditionFalse, "ServerUnavailable", err.Error())
+		return ctrl.Result{RequeueAfter: cometAPIRetryInterval}, err
+	}
+
+	// Changes to the credentials secret are picked up through the watch
+	opt, err := r.getStorageTemplate(ctx, sv)
+	if err != nil {
+		r.setCondition(sv, conditionProvisioned, metav1.ConditionFalse, "InvalidCredentials", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// Storage templates live in the server settings - add or update ours
+	cfg, err := api.ServerConfig(ctx)
+	if err != nil {
+		r.setCondition(sv, conditionProvisioned, metav1.ConditionFalse, "ServerUnavailable", err.Error())
+		return ctrl.Result{RequeueAfter: cometAPIRetryInterval}, err
+	}
+	if comet.SetRemoteStorage(cfg, *opt) {
+		if err := api.SetServerConfig(ctx, cfg); err != nil {
+			r.setCondition(sv, conditionProvisioned, metav1.ConditionFalse, "UpdateFailed", err.Error())
+			return ctrl.Result{RequeueAfter: cometAPIRetryInterval}, err
+		}
+		r.Recorder.Event(sv, corev1.EventTypeNormal, "Provisioned", fmt.Sprintf("Storage template %q saved on cometserver/%s.", opt.Description, sv.Spec.ServerRef))
+	}
+	r.setCondition(sv, conditionProvisioned, metav1.ConditionTrue, "Provisioned", "Storage template exists on the Comet Server.")
+
+	// Connectivity
+	if err := api.TestRemoteStorage(ctx, *opt); err != nil {
+		r.setCondition(sv, conditionConnected, metav1.ConditionFalse, "ConnectionFailed", err.Error())
+		r.Recorder.Event(sv, corev1.EventTypeWarning, "ConnectionFailed", err.Error())
+	} else {
+		r.setCondition(sv, conditionConnected, metav1.ConditionTrue, "Connected", "Comet Server connected to the object storage.")
+	}
+
+	return ctrl.Result{RequeueAfter: cometAPIResyncInterval}, nil
+}
+
+// finalizeCometStorageVault removes the storage template from the Comet Server. If the Comet
+// Server is suspended, or stays unavailable for cometAPIFinalizeTimeout, the template is left
+// behind so the CometStorageVault can still be deleted.
+func (r *CometStorageVaultReconciler) finalizeCometStorageVault(ctx context.Context, reqLogger logr.Logger, sv *cometdv1alpha1.CometStorageVault) error {
+	cs := &cometdv1alpha1.CometServer{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: sv.Spec.ServerRef, Namespace: sv.Namespace}, cs)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// The CometServer is gone, and its storage templates with it
+			reqLogger.Info("CometServer not found. Nothing to clean up.")
+			return nil
+		}
+		return err
+	}
+	if cs.Spec.Config != nil {
+		reqLogger.Info("CometServer declares its configuration. Nothing to clean up.")
+		return nil
+	}
+
+	err = r.removeStorageTemplate(ctx, cs, sv)
+	if err != nil && (cs.Spec.Suspend || isFinalizeTimedOut(sv)) {
+		r.Recorder.Event(sv, corev1.EventTypeWarning, "CleanupSkipped", fmt.Sprintf("Storage template %q left on cometserver/%s, which is unavailable: %s", sv.TemplateDescription(), cs.Name, err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	reqLogger.Info("Successfully finalized CometStorageVault.")
+	return nil
+}
+
+func (r *CometStorageVaultReconciler) removeStorageTemplate(ctx context.Context, cs *cometdv1alpha1.CometServer, sv *cometdv1alpha1.CometStorageVault) error {
+	api, err := comet.ForServer(ctx, r.Client, cs)
+	if err != nil {
+		return err
+	}
+	cfg, err := api.ServerConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if comet.RemoveRemoteStorage(cfg, sv.TemplateDescription()) {
+		return api.SetServerConfig(ctx, cfg)
+	}
+	return nil
+}
+
+// isFinalizeTimedOut reports whether obj has been waiting longer than cometAPIFinalizeTimeout
+// to be cleaned up on its Comet Server.
+func isFinalizeTimedOut(obj client.Object) bool {
+	deleted := obj.GetDeletionTimestamp()
+	return deleted != nil && time.Since(deleted.Time) > cometAPIFinalizeTimeout
+}
+
+// getStorageTemplate builds the Comet storage template from the spec and credentials secret.
+func (r *CometStorageVaultReconciler) getStorageTemplate(ctx context.Context, sv *cometdv1alpha1.CometStorageVault) (*comet.RemoteStorageOption, error) {
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: sv.Spec.CredentialsSecretRef.Name, Namespace: sv.Namespace}, secret)
+	if err != nil {
+		return nil, err
+	}
+	opt := &comet.RemoteStorageOption{
+		Description: sv.TemplateDescription(),
+		Username:    string(secret.Data["accessKeyID"]),
+		Password:    string(secret.Data["secretAccessKey"]),
+	}
+	switch sv.Spec.Type {
+	case cometdv1alpha1.CometStorageVaultS3:
+		if sv.Spec.S3 == nil || sv.Spec.S3.Endpoint == "" {
+			return nil, fmt.Errorf("spec.s3.endpoint is required for type %s", sv.Spec.Type)
+		}
+		opt.Type = comet.RemoteStorageTypeS3
+		opt.RemoteAddress = sv.Spec.S3.Endpoint
+	default:
+		return nil, fmt.Errorf("unsupported storage vault type %q", sv.Spec.Type)
+	}
+	return opt, nil
+}
+
+func (r *CometStorageVaultReconciler) setCondition(sv *cometdv1alpha1.CometStorageVault, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&sv.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: sv.Generation,
+	})
+}
+
+// findVaultsForSecret maps a credentials secret to the CometStorageVaults which reference it.
+func (r *CometStorageVaultReconciler) findVaultsForSecret(obj client.Object) []reconcile.Request {
+	list := &cometdv1alpha1.CometStorageVaultList{}
+	err := r.Client.List(context.TODO(), list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{credentialsSecretRefIndexField: obj.GetName()})
+	if err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, len(list.Items))
+	for i, sv := range list.Items {
+		requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Name: sv.Name, Namespace: sv.Namespace}}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CometStorageVaultReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &cometdv1alpha1.CometStorageVault{}, credentialsSecretRefIndexField, func(o client.Object) []string {
+		sv := o.(*cometdv1alpha1.CometStorageVault)
+		return []string{sv.Spec.CredentialsSecretRef.Name}
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cometdv1alpha1.CometStorageVault{}).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.findVaultsForSecret),
+		).
+		Complete(r)
+}
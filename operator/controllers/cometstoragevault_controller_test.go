@@ -0,0 +1,173 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/cometbackup/comet-server-operator/comet/comettest"
+)
+
+// newCometServerFake starts a comettest server standing in for the admin API of every
+// CometServer, and returns the CometServer with its admin Secret.
+func newCometServerFake(name string) (*comettest.Server, *cometdv1alpha1.CometServer, *corev1.Secret) {
+	srv := comettest.NewServer("admin", "pa55")
+	DeferCleanup(srv.Close)
+	serverURL := comet.ServerURL
+	comet.ServerURL = func(cs *cometdv1alpha1.CometServer) string { return srv.URL }
+	DeferCleanup(func() { comet.ServerURL = serverURL })
+
+	cs := &cometdv1alpha1.CometServer{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: cometdv1alpha1.CometServerSpec{
+			Version: "23.5.0",
+			License: cometdv1alpha1.CometServerLicense{Issuer: "issuer"},
+			Ingress: cometdv1alpha1.CometServerIngress{Host: "example.com"},
+		},
+	}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: cs.AdminSecretName(), Namespace: "default"},
+		Data: map[string][]byte{
+			cometAdminUsernameKey: []byte(srv.Username),
+			cometAdminPasswordKey: []byte(srv.Password),
+		},
+	}
+	return srv, cs, admin
+}
+
+// reconcileRequest is the request for obj.
+func reconcileRequest(obj client.Object) ctrl.Request {
+	return ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)}
+}
+
+var _ = Describe("CometStorageVault controller", func() {
+	var (
+		ctx      = context.Background()
+		srv      *comettest.Server
+		s3Status int
+		c        client.Client
+		r        *CometStorageVaultReconciler
+		sv       *cometdv1alpha1.CometStorageVault
+	)
+
+	BeforeEach(func() {
+		var cs *cometdv1alpha1.CometServer
+		var admin *corev1.Secret
+		srv, cs, admin = newCometServerFake("cometd")
+
+		// The fake Comet Server tests the connection by requesting the S3 endpoint
+		s3Status = http.StatusOK
+		s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(s3Status)
+		}))
+		DeferCleanup(s3.Close)
+
+		credentials := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "wasabi", Namespace: "default"},
+			Data: map[string][]byte{
+				"accessKeyID":     []byte("AKID"),
+				"secretAccessKey": []byte("secret"),
+			},
+		}
+		sv = &cometdv1alpha1.CometStorageVault{
+			ObjectMeta: metav1.ObjectMeta{Name: "wasabi", Namespace: "default"},
+			Spec: cometdv1alpha1.CometStorageVaultSpec{
+				ServerRef:            cs.Name,
+				Type:                 cometdv1alpha1.CometStorageVaultS3,
+				S3:                   &cometdv1alpha1.CometStorageVaultS3Options{Endpoint: s3.URL},
+				CredentialsSecretRef: corev1.LocalObjectReference{Name: credentials.Name},
+			},
+		}
+		c = newFakeClient(cs, admin, credentials, sv)
+		r = &CometStorageVaultReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	reconcile := func() (ctrl.Result, *cometdv1alpha1.CometStorageVault) {
+		result, err := r.Reconcile(ctx, reconcileRequest(sv))
+		Expect(err).NotTo(HaveOccurred())
+		current := &cometdv1alpha1.CometStorageVault{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(sv), current)).To(Succeed())
+		return result, current
+	}
+
+	templates := func() []interface{} {
+		list, _ := srv.Config()["RemoteStorage"].([]interface{})
+		return list
+	}
+
+	It("provisions the storage template and reports the connection", func() {
+		result, current := reconcile()
+		Expect(result.RequeueAfter).To(Equal(cometAPIResyncInterval))
+		Expect(meta.IsStatusConditionTrue(current.Status.Conditions, conditionProvisioned)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(current.Status.Conditions, conditionConnected)).To(BeTrue())
+		Expect(templates()).To(ConsistOf(And(
+			HaveKeyWithValue("Description", "wasabi"),
+			HaveKeyWithValue("Type", comet.RemoteStorageTypeS3),
+			HaveKeyWithValue("Username", "AKID"),
+		)))
+	})
+
+	It("reports a failed connection to the object storage", func() {
+		s3Status = http.StatusServiceUnavailable
+		_, current := reconcile()
+		Expect(meta.IsStatusConditionTrue(current.Status.Conditions, conditionProvisioned)).To(BeTrue())
+		cond := meta.FindStatusCondition(current.Status.Conditions, conditionConnected)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("ConnectionFailed"))
+	})
+
+	It("retries while the CometServer doesn't exist", func() {
+		sv.Spec.ServerRef = "missing"
+		Expect(c.Update(ctx, sv)).To(Succeed())
+		result, current := reconcile()
+		Expect(result.RequeueAfter).To(Equal(cometAPIRetryInterval))
+		cond := meta.FindStatusCondition(current.Status.Conditions, conditionProvisioned)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("ServerUnavailable"))
+		Expect(templates()).To(BeEmpty())
+	})
+
+	It("removes the storage template when deleted", func() {
+		_, current := reconcile()
+		Expect(templates()).To(HaveLen(1))
+
+		Expect(c.Delete(ctx, current)).To(Succeed())
+		_, err := r.Reconcile(ctx, reconcileRequest(sv))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(templates()).To(BeEmpty())
+		err = c.Get(ctx, types.NamespacedName{Name: sv.Name, Namespace: sv.Namespace}, current)
+		Expect(client.IgnoreNotFound(err)).To(Succeed())
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,364 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/go-logr/logr"
+)
+
+const (
+	conditionReady = "Ready"
+
+	passwordSecretRefIndexField = ".spec.passwordSecretRef.name"
+)
+
+// CometUserReconciler reconciles a CometUser object
+type CometUserReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometusers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometusers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cometd.cometbackup.com,resources=cometusers/finalizers,verbs=update
+
+// Reconcile creates or updates the account on the referenced CometServer through the Comet
+// admin API. Customer accounts are managed with the user APIs, admin accounts through the
+// AdminUsers list of the server settings.
+func (r *CometUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx).WithValues("cometuser", req.NamespacedName)
+	reqLogger.Info("Reconciling CometUser")
+
+	// Fetch the CometUser instance
+	cu := &cometdv1alpha1.CometUser{}
+	err := r.Get(ctx, req.NamespacedName, cu)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			reqLogger.Info("CometUser resource not found. Ignoring since object must be deleted.")
+			return ctrl.Result{}, nil
+		}
+		reqLogger.Error(err, "Failed to get CometUser.")
+		return ctrl.Result{}, err
+	}
+
+	if cu.GetDeletionTimestamp() != nil {
+		if controllerutil.ContainsFinalizer(cu, cometServerFinalizer) {
+			if err := r.finalizeCometUser(ctx, reqLogger, cu); err != nil {
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(cu, cometServerFinalizer)
+			if err := r.Update(ctx, cu); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(cu, cometServerFinalizer) {
+		controllerutil.AddFinalizer(cu, cometServerFinalizer)
+		if err := r.Update(ctx, cu); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// --
+
+	result, err := r.reconcileCometUser(ctx, reqLogger, cu)
+	if err != nil {
+		reqLogger.Error(err, "Failed to provision account.")
+	}
+	if err := r.Client.Status().Update(ctx, cu); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+func (r *CometUserReconciler) reconcileCometUser(ctx context.Context, reqLogger logr.Logger, cu *cometdv1alpha1.CometUser) (ctrl.Result, error) {
+	cs := &cometdv1alpha1.CometServer{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: cu.Spec.ServerRef, Namespace: cu.Namespace}, cs)
+	if err != nil {
+		r.setCondition(cu, metav1.ConditionFalse, "ServerUnavailable", err.Error())
+		return ctrl.Result{RequeueAfter: cometAPIRetryInterval}, err
+	}
+	api, err := comet.ForServer(ctx, r.Client, cs)
+	if err != nil {
+		r.setCondition(cu, metav1.ConditionFalse, "ServerUnavailable", err.Error())
+		return ctrl.Result{RequeueAfter: cometAPIRetryInterval}, err
+	}
+
+	if cu.Spec.Type == cometdv1alpha1.CometUserTypeAdmin {
+		if cu.Username() == api.Username {
+			// The operator's own admin account is managed through the CometServer
+			r.setCondition(cu, metav1.ConditionFalse, "ReservedUsername", fmt.Sprintf("%q is the admin account the operator uses on cometserver/%s - set it through spec.admin.secretRef instead.", cu.Username(), cs.Name))
+			return ctrl.Result{}, nil
+		}
+		if cs.Spec.Config != nil {
+			// A declared configuration replaces cometd.cfg, and so the AdminUsers list, on
+			// every start up
+			r.setCondition(cu, metav1.ConditionFalse, "ConfigDeclared", fmt.Sprintf("cometserver/%s declares spec.config - add the admin account to its AdminUsers settings instead.", cs.Name))
+			return ctrl.Result{RequeueAfter: cometAPIResyncInterval}, nil
+		}
+	}
+
+	password, version, err := r.getPassword(ctx, cu)
+	if err != nil {
+		r.setCondition(cu, metav1.ConditionFalse, "InvalidPassword", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	switch cu.Spec.Type {
+	case cometdv1alpha1.CometUserTypeAdmin:
+		err = r.reconcileAdminAccount(ctx, api, cu, password)
+	default:
+		err = r.reconcileCustomerAccount(ctx, api, cu, password, version)
+	}
+	if err != nil {
+		r.setCondition(cu, metav1.ConditionFalse, "UpdateFailed", err.Error())
+		return ctrl.Result{RequeueAfter: cometAPIRetryInterval}, err
+	}
+
+	cu.Status.PasswordSecretVersion = version
+	r.setCondition(cu, metav1.ConditionTrue, "Provisioned", "Account exists on the Comet Server.")
+	return ctrl.Result{RequeueAfter: cometAPIResyncInterval}, nil
+}
+
+// reconcileAdminAccount adds the admin account to the server settings, keeping its password in
+// sync with the secret.
+func (r *CometUserReconciler) reconcileAdminAccount(ctx context.Context, api *comet.Client, cu *cometdv1alpha1.CometUser, password string) error {
+	cfg, err := api.ServerConfig(ctx)
+	if err != nil {
+		return err
+	}
+	created := !comet.HasAdminUser(cfg, cu.Username())
+	if !comet.SetAdminUser(cfg, cu.Username(), password) {
+		return nil
+	}
+	if err := api.SetServerConfig(ctx, cfg); err != nil {
+		return err
+	}
+	if created {
+		r.Recorder.Event(cu, corev1.EventTypeNormal, "Created", fmt.Sprintf("Admin account %q created on cometserver/%s.", cu.Username(), cu.Spec.ServerRef))
+	} else {
+		r.Recorder.Event(cu, corev1.EventTypeNormal, "PasswordChanged", fmt.Sprintf("Admin account %q password updated.", cu.Username()))
+	}
+	return nil
+}
+
+// reconcileCustomerAccount creates the customer account if missing, resets its password when
+// the secret changes, and applies the profile settings from the spec.
+func (r *CometUserReconciler) reconcileCustomerAccount(ctx context.Context, api *comet.Client, cu *cometdv1alpha1.CometUser, password, version string) error {
+	users, err := api.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	exists := false
+	for _, u := range users {
+		if u == cu.Username() {
+			exists = true
+			break
+		}
+	}
+
+	if !exists {
+		if err := api.AddUser(ctx, cu.Username(), password); err != nil {
+			return err
+		}
+		r.Recorder.Event(cu, corev1.EventTypeNormal, "Created", fmt.Sprintf("Account %q created on cometserver/%s.", cu.Username(), cu.Spec.ServerRef))
+	} else if cu.Status.PasswordSecretVersion != version {
+		// The password can't be read back from the Comet Server, so it is only reset when the
+		// secret has changed since it was last applied
+		if err := api.ResetUserPassword(ctx, cu.Username(), password); err != nil {
+			return err
+		}
+		r.Recorder.Event(cu, corev1.EventTypeNormal, "PasswordChanged", fmt.Sprintf("Account %q password updated.", cu.Username()))
+	}
+
+	profile, err := api.UserProfile(ctx, cu.Username())
+	if err != nil {
+		return err
+	}
+	changed := setProfileField(profile, "AccountName", cu.Spec.AccountName)
+	changed = setProfileField(profile, "PolicyID", cu.Spec.PolicyID) || changed
+	changed = setProfileField(profile, "MaximumDevices", cu.Spec.Quota.MaximumDevices) || changed
+	if limit := cu.Spec.Quota.StorageLimit; limit != nil {
+		changed = setProfileField(profile, "AllProtectedItemsQuotaEnabled", true) || changed
+		changed = setProfileField(profile, "AllProtectedItemsQuotaBytes", limit.Value()) || changed
+	} else {
+		changed = setProfileField(profile, "AllProtectedItemsQuotaEnabled", false) || changed
+	}
+	if !changed {
+		return nil
+	}
+	return api.SetUserProfile(ctx, cu.Username(), profile)
+}
+
+// finalizeCometUser deletes the account from the Comet Server, if the deletion policy asks for
+// it. The operator's own admin account is never deleted. If the Comet Server is suspended, or
+// stays unavailable for cometAPIFinalizeTimeout, the account is left behind so the CometUser can
+// still be deleted.
+func (r *CometUserReconciler) finalizeCometUser(ctx context.Context, reqLogger logr.Logger, cu *cometdv1alpha1.CometUser) error {
+	if cu.Spec.DeletionPolicy != cometdv1alpha1.CometUserDeletionPolicyDelete {
+		reqLogger.Info("Retaining account on the Comet Server.", "username", cu.Username())
+		return nil
+	}
+	cs := &cometdv1alpha1.CometServer{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: cu.Spec.ServerRef, Namespace: cu.Namespace}, cs)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// The CometServer is gone, and its accounts with it
+			reqLogger.Info("CometServer not found. Nothing to clean up.")
+			return nil
+		}
+		return err
+	}
+	if cu.Spec.Type == cometdv1alpha1.CometUserTypeAdmin && cs.Spec.Config != nil {
+		reqLogger.Info("CometServer declares its configuration. Nothing to clean up.")
+		return nil
+	}
+
+	err = r.deleteAccount(ctx, reqLogger, cs, cu)
+	if err != nil && (cs.Spec.Suspend || isFinalizeTimedOut(cu)) {
+		r.Recorder.Event(cu, corev1.EventTypeWarning, "CleanupSkipped", fmt.Sprintf("Account %q left on cometserver/%s, which is unavailable: %s", cu.Username(), cs.Name, err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	reqLogger.Info("Successfully finalized CometUser.")
+	return nil
+}
+
+func (r *CometUserReconciler) deleteAccount(ctx context.Context, reqLogger logr.Logger, cs *cometdv1alpha1.CometServer, cu *cometdv1alpha1.CometUser) error {
+	api, err := comet.ForServer(ctx, r.Client, cs)
+	if err != nil {
+		return err
+	}
+
+	switch cu.Spec.Type {
+	case cometdv1alpha1.CometUserTypeAdmin:
+		if cu.Username() == api.Username {
+			reqLogger.Info("Not deleting the operator's admin account.", "username", cu.Username())
+			return nil
+		}
+		cfg, err := api.ServerConfig(ctx)
+		if err != nil {
+			return err
+		}
+		if comet.RemoveAdminUser(cfg, cu.Username()) {
+			if err := api.SetServerConfig(ctx, cfg); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := api.DeleteUser(ctx, cu.Username()); err != nil && !comet.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPassword returns the account password, and the resource version of the secret holding it.
+func (r *CometUserReconciler) getPassword(ctx context.Context, cu *cometdv1alpha1.CometUser) (string, string, error) {
+	ref := cu.Spec.PasswordSecretRef
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cu.Namespace}, secret)
+	if err != nil {
+		return "", "", err
+	}
+	password, ok := secret.Data[ref.Key]
+	if !ok || len(password) == 0 {
+		return "", "", fmt.Errorf("secret %s has no key %q", ref.Name, ref.Key)
+	}
+	return string(password), secret.ResourceVersion, nil
+}
+
+func (r *CometUserReconciler) setCondition(cu *cometdv1alpha1.CometUser, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&cu.Status.Conditions, metav1.Condition{
+		Type:               conditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: cu.Generation,
+	})
+}
+
+// setProfileField sets a user profile field, comparing through JSON since profile numbers are
+// decoded as float64. Returns true if the field was changed.
+func setProfileField(profile map[string]interface{}, key string, value interface{}) bool {
+	have, _ := json.Marshal(profile[key])
+	want, _ := json.Marshal(value)
+	if string(have) == string(want) {
+		return false
+	}
+	profile[key] = value
+	return true
+}
+
+// findUsersForSecret maps a password secret to the CometUsers which reference it.
+func (r *CometUserReconciler) findUsersForSecret(obj client.Object) []reconcile.Request {
+	list := &cometdv1alpha1.CometUserList{}
+	err := r.Client.List(context.TODO(), list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{passwordSecretRefIndexField: obj.GetName()})
+	if err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, len(list.Items))
+	for i, cu := range list.Items {
+		requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Name: cu.Name, Namespace: cu.Namespace}}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CometUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &cometdv1alpha1.CometUser{}, passwordSecretRefIndexField, func(o client.Object) []string {
+		cu := o.(*cometdv1alpha1.CometUser)
+		return []string{cu.Spec.PasswordSecretRef.Name}
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cometdv1alpha1.CometUser{}).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.findUsersForSecret),
+		).
+		Complete(r)
+}
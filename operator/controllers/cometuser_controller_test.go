@@ -0,0 +1,196 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+	"github.com/cometbackup/comet-server-operator/comet/comettest"
+)
+
+var _ = Describe("CometUser controller", func() {
+	var (
+		ctx      = context.Background()
+		srv      *comettest.Server
+		c        client.Client
+		r        *CometUserReconciler
+		cu       *cometdv1alpha1.CometUser
+		password *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		var cs *cometdv1alpha1.CometServer
+		var admin *corev1.Secret
+		srv, cs, admin = newCometServerFake("cometd")
+
+		password = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice-password", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("first")},
+		}
+		cu = &cometdv1alpha1.CometUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Spec: cometdv1alpha1.CometUserSpec{
+				ServerRef: cs.Name,
+				Type:      cometdv1alpha1.CometUserTypeUser,
+				PasswordSecretRef: corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: password.Name},
+					Key:                  "password",
+				},
+				AccountName:    "Alice",
+				DeletionPolicy: cometdv1alpha1.CometUserDeletionPolicyDelete,
+			},
+		}
+		c = newFakeClient(cs, admin, password)
+		r = &CometUserReconciler{Client: c, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+	})
+
+	create := func() {
+		Expect(c.Create(ctx, cu)).To(Succeed())
+	}
+
+	reconcile := func() *cometdv1alpha1.CometUser {
+		_, err := r.Reconcile(ctx, reconcileRequest(cu))
+		Expect(err).NotTo(HaveOccurred())
+		current := &cometdv1alpha1.CometUser{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(cu), current)).To(Succeed())
+		return current
+	}
+
+	Describe("a customer account", func() {
+		accountPassword := func() string {
+			password, exists := srv.UserPassword("alice")
+			Expect(exists).To(BeTrue())
+			return password
+		}
+
+		It("creates the account with its profile", func() {
+			create()
+			current := reconcile()
+			Expect(meta.IsStatusConditionTrue(current.Status.Conditions, conditionReady)).To(BeTrue())
+			Expect(current.Finalizers).To(ContainElement(cometServerFinalizer))
+			Expect(accountPassword()).To(Equal("first"))
+
+			profile, err := srv.AdminClient().UserProfile(ctx, "alice")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(profile).To(HaveKeyWithValue("AccountName", "Alice"))
+		})
+
+		It("resets the password when the Secret changes", func() {
+			create()
+			current := reconcile()
+			Expect(current.Status.PasswordSecretVersion).NotTo(BeEmpty())
+
+			password.Data["password"] = []byte("second")
+			Expect(c.Update(ctx, password)).To(Succeed())
+			current = reconcile()
+			Expect(accountPassword()).To(Equal("second"))
+			Expect(current.Status.PasswordSecretVersion).To(Equal(password.ResourceVersion))
+		})
+
+		It("reports a missing password key", func() {
+			cu.Spec.PasswordSecretRef.Key = "missing"
+			create()
+			cond := meta.FindStatusCondition(reconcile().Status.Conditions, conditionReady)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("InvalidPassword"))
+			_, exists := srv.UserPassword("alice")
+			Expect(exists).To(BeFalse())
+		})
+
+		It("deletes the account and removes the finalizer when deleted", func() {
+			create()
+			current := reconcile()
+			Expect(c.Delete(ctx, current)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, reconcileRequest(cu))
+			Expect(err).NotTo(HaveOccurred())
+			_, exists := srv.UserPassword("alice")
+			Expect(exists).To(BeFalse())
+			err = c.Get(ctx, client.ObjectKeyFromObject(cu), current)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("retains the account with the Retain deletion policy", func() {
+			cu.Spec.DeletionPolicy = cometdv1alpha1.CometUserDeletionPolicyRetain
+			create()
+			current := reconcile()
+			Expect(c.Delete(ctx, current)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, reconcileRequest(cu))
+			Expect(err).NotTo(HaveOccurred())
+			_, exists := srv.UserPassword("alice")
+			Expect(exists).To(BeTrue())
+			err = c.Get(ctx, client.ObjectKeyFromObject(cu), current)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Describe("an admin account", func() {
+		BeforeEach(func() {
+			cu.Spec.Type = cometdv1alpha1.CometUserTypeAdmin
+		})
+
+		It("adds the account to the server settings, and updates its password", func() {
+			create()
+			Expect(meta.IsStatusConditionTrue(reconcile().Status.Conditions, conditionReady)).To(BeTrue())
+			Expect(comet.HasAdminUser(srv.Config(), "alice")).To(BeTrue())
+
+			password.Data["password"] = []byte("second")
+			Expect(c.Update(ctx, password)).To(Succeed())
+			reconcile()
+			users, _ := srv.Config()["AdminUsers"].([]interface{})
+			Expect(users).To(ConsistOf(And(
+				HaveKeyWithValue("Username", "alice"),
+				HaveKeyWithValue("Password", "second"),
+			)))
+		})
+
+		It("refuses the operator's own admin account", func() {
+			cu.Spec.Username = srv.Username
+			create()
+			cond := meta.FindStatusCondition(reconcile().Status.Conditions, conditionReady)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal("ReservedUsername"))
+			Expect(comet.HasAdminUser(srv.Config(), srv.Username)).To(BeFalse())
+		})
+
+		It("removes the account from the server settings when deleted", func() {
+			create()
+			current := reconcile()
+			Expect(c.Delete(ctx, current)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, reconcileRequest(cu))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(comet.HasAdminUser(srv.Config(), "alice")).To(BeFalse())
+			err = c.Get(ctx, client.ObjectKeyFromObject(cu), current)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// storageVersionMigrationRetryInterval is how long to wait before retrying a failed migration,
+// e.g. while the conversion webhook's certificate is being injected.
+const storageVersionMigrationRetryInterval = 30 * time.Second
+
+// StorageVersionMigrator rewrites every stored object of the listed CRDs in the CRD's storage
+// version, then drops the older versions from the CRD's status.storedVersions. Once migrated,
+// the older versions can be removed from the CRD without losing existing objects.
+type StorageVersionMigrator struct {
+	Client client.Client
+	// APIReader reads CRDs and objects uncached, as the manager's cache doesn't watch them.
+	APIReader client.Reader
+	Resources []schema.GroupResource
+}
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update;patch
+
+var _ manager.LeaderElectionRunnable = &StorageVersionMigrator{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so only one replica migrates.
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start migrates each resource, retrying until it succeeds or the manager stops.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	reqLogger := log.FromContext(ctx).WithName("storageversion-migrator")
+	for _, gr := range m.Resources {
+		gr := gr
+		err := wait.PollImmediateUntilWithContext(ctx, storageVersionMigrationRetryInterval, func(ctx context.Context) (bool, error) {
+			if err := m.migrate(ctx, gr); err != nil {
+				reqLogger.Error(err, "Failed to migrate storage version, will retry.", "resource", gr.String())
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			// The manager is stopping
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *StorageVersionMigrator) migrate(ctx context.Context, gr schema.GroupResource) error {
+	reqLogger := log.FromContext(ctx).WithName("storageversion-migrator").WithValues("resource", gr.String())
+
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.APIReader.Get(ctx, client.ObjectKey{Name: gr.String()}, crd); err != nil {
+		return err
+	}
+	storageVersion := ""
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			storageVersion = v.Name
+		}
+	}
+	if storageVersion == "" {
+		return fmt.Errorf("%s has no storage version", gr.String())
+	}
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		return nil
+	}
+	reqLogger.Info("Migrating storage version.", "storedVersions", crd.Status.StoredVersions, "storageVersion", storageVersion)
+
+	// An unchanged update is still written, re-encoding the object in the storage version
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{Group: gr.Group, Version: storageVersion, Kind: crd.Spec.Names.ListKind})
+	if err := m.APIReader.List(ctx, list); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		err := m.Client.Update(ctx, &list.Items[i])
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			// A conflict means the object was written since it was listed - in the storage version
+			return fmt.Errorf("failed to migrate %s/%s: %w", list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+		}
+	}
+
+	patch := client.MergeFrom(crd.DeepCopy())
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := m.Client.Status().Patch(ctx, crd, patch); err != nil {
+		return err
+	}
+	reqLogger.Info("Successfully migrated storage version.", "objects", len(list.Items))
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1beta1 "github.com/cometbackup/comet-server-operator/api/v1beta1"
+)
+
+var _ = Describe("StorageVersionMigrator", func() {
+	ctx := context.Background()
+	gr := schema.GroupResource{Group: cometdv1beta1.GroupVersion.Group, Resource: "cometservers"}
+
+	storedVersions := func() []string {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: gr.String()}, crd)).To(Succeed())
+		return crd.Status.StoredVersions
+	}
+
+	It("leaves only the storage version in status.storedVersions", func() {
+		requireEnvtest()
+		cs := &cometdv1beta1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "migrated", Namespace: "default"},
+			Spec: cometdv1beta1.CometServerSpec{
+				Version: "23.6.3",
+				License: cometdv1beta1.CometServerLicense{IssuerRef: corev1.LocalObjectReference{Name: "issuer"}},
+				Ingress: cometdv1beta1.CometServerIngress{Host: "example.com"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, cs)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, cs)).To(Succeed())
+		})
+
+		// As if objects were stored in v1alpha1 before v1beta1 became the storage version
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: gr.String()}, crd)).To(Succeed())
+		patch := client.MergeFrom(crd.DeepCopy())
+		crd.Status.StoredVersions = []string{"v1alpha1", "v1beta1"}
+		Expect(k8sClient.Status().Patch(ctx, crd, patch)).To(Succeed())
+
+		m := &StorageVersionMigrator{Client: k8sClient, APIReader: k8sClient, Resources: []schema.GroupResource{gr}}
+		Expect(m.migrate(ctx, gr)).To(Succeed())
+		Expect(storedVersions()).To(Equal([]string{"v1beta1"}))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cs), cs)).To(Succeed())
+
+		// Nothing left to migrate
+		Expect(m.migrate(ctx, gr)).To(Succeed())
+		Expect(storedVersions()).To(Equal([]string{"v1beta1"}))
+	})
+})
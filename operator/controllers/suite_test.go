@@ -17,20 +17,24 @@ limitations under the License.
 package controllers
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	cometdv1beta1 "github.com/cometbackup/comet-server-operator/api/v1beta1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -50,23 +54,32 @@ func TestAPIs(t *testing.T) {
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
+	err := cometdv1alpha1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+	err = cometdv1beta1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+	err = apiextensionsv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	//+kubebuilder:scaffold:scheme
+
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
 		ErrorIfCRDPathMissing: true,
 	}
 
-	var err error
 	// cfg is defined in this file globally.
 	cfg, err = testEnv.Start()
+	if err != nil && os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		// The envtest binaries aren't installed - only the specs against the fake client run
+		GinkgoWriter.Printf("Skipping envtest specs: %v\n", err)
+		testEnv = nil
+		return
+	}
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
-	err = cometdv1alpha1.AddToScheme(scheme.Scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	//+kubebuilder:scaffold:scheme
-
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
@@ -74,7 +87,34 @@ var _ = BeforeSuite(func() {
 })
 
 var _ = AfterSuite(func() {
+	if testEnv == nil {
+		return
+	}
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
+
+// requireEnvtest skips the spec unless the envtest API server is running. make test installs
+// the envtest binaries.
+func requireEnvtest() {
+	if testEnv == nil {
+		Skip("envtest binaries not installed")
+	}
+}
+
+// newFakeClient returns a client for the specs which drive a reconciler directly, with the
+// field indexes its lookups use.
+func newFakeClient(objs ...client.Object) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(objs...).
+		WithIndex(&cometdv1alpha1.CometServer{}, restoreBackupRefIndexField, func(o client.Object) []string {
+			cs := o.(*cometdv1alpha1.CometServer)
+			if cs.Spec.RestoreFrom == nil || cs.Spec.RestoreFrom.BackupRef == "" {
+				return nil
+			}
+			return []string{cs.Spec.RestoreFrom.BackupRef}
+		}).
+		Build()
+}
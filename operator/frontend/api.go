@@ -0,0 +1,482 @@
+package frontend
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// openAPIDocument describes the JSON API served under /api/v1.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// maxAPIRequestSize bounds the request body of the JSON API.
+const maxAPIRequestSize = 1 << 20
+
+// APIServer is a CometServer in the JSON API.
+type APIServer struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ResourceVersion must be sent back unchanged when updating, so concurrent changes conflict.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	Version            string         `json:"version"`
+	Issuer             string         `json:"issuer"`
+	Hostname           string         `json:"hostname"`
+	Features           map[string]int `json:"features,omitempty"`
+	StorageSize        string         `json:"storageSize,omitempty"`
+	Suspend            bool           `json:"suspend"`
+	DeletionProtection bool           `json:"deletionProtection"`
+
+	// Read only
+	FQDN         string    `json:"fqdn,omitempty"`
+	SerialNumber string    `json:"serialNumber,omitempty"`
+	CreatedAt    time.Time `json:"createdAt,omitempty"`
+}
+
+// APIServerStatus is the status of a CometServer in the JSON API.
+type APIServerStatus struct {
+	// Available is true while the Comet Server has a ready pod.
+	Available    bool               `json:"available"`
+	Suspended    bool               `json:"suspended"`
+	SerialNumber string             `json:"serialNumber,omitempty"`
+	Conditions   []metav1.Condition `json:"conditions"`
+	// Health is omitted while the server is suspended.
+	Health *APIServerHealth `json:"health,omitempty"`
+}
+
+type APIServerHealth struct {
+	Healthy           bool   `json:"healthy"`
+	Version           string `json:"version,omitempty"`
+	LicenseValidUntil int64  `json:"licenseValidUntil,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// APIIssuer is a CometLicenseIssuer in the JSON API.
+type APIIssuer struct {
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Email           string `json:"email"`
+	// Token is write only, and stored in the issuer's credentials Secret. It is left unchanged if
+	// empty on update.
+	Token      string         `json:"token,omitempty"`
+	Features   map[string]int `json:"features,omitempty"`
+	MaxServers int            `json:"maxServers,omitempty"`
+}
+
+// APIError is the body of every unsuccessful JSON API response.
+type APIError struct {
+	Error  string          `json:"error"`
+	Fields []APIFieldError `json:"fields,omitempty"`
+}
+
+type APIFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// api serves the JSON API.
+func (s *Server) api(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "openapi.json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDocument)
+	case parts[0] == "servers":
+		s.apiServers(w, r, parts[1:])
+	case parts[0] == "issuers":
+		s.apiIssuers(w, r, parts[1:])
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// --
+
+func (s *Server) apiServers(w http.ResponseWriter, r *http.Request, parts []string) {
+	acc := s.access(r)
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		list := &cometdv1alpha1.CometServerList{}
+		if err := s.Client.List(r.Context(), list, client.InNamespace(r.URL.Query().Get("namespace"))); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		out := []APIServer{}
+		for i := range list.Items {
+			allowed, err := acc.Can("list", "cometservers", list.Items[i].Namespace)
+			if err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if allowed {
+				out = append(out, apiServerFrom(&list.Items[i]))
+			}
+		}
+		writeJSON(w, http.StatusOK, out)
+
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		in := &APIServer{}
+		if !readJSON(w, r, in) {
+			return
+		}
+		if !s.apiAllowed(w, acc, "create", "cometservers", in.Namespace) {
+			return
+		}
+		cs := &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      in.Name,
+				Namespace: in.Namespace,
+			},
+		}
+		if err := in.apply(cs); err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err := s.createCometServer(r.Context(), cs); err != nil {
+			writeAPIError(w, 0, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, apiServerFrom(cs))
+
+	case len(parts) == 2 || (len(parts) == 3 && parts[2] == "status"):
+		verb := map[string]string{
+			http.MethodGet:    "get",
+			http.MethodPut:    "update",
+			http.MethodDelete: "delete",
+		}[r.Method]
+		if verb == "" || (len(parts) == 3 && r.Method != http.MethodGet) {
+			writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		if !s.apiAllowed(w, acc, verb, "cometservers", parts[0]) {
+			return
+		}
+		cs := &cometdv1alpha1.CometServer{}
+		if err := s.Client.Get(r.Context(), types.NamespacedName{Namespace: parts[0], Name: parts[1]}, cs); err != nil {
+			writeAPIError(w, 0, err)
+			return
+		}
+		switch {
+		case len(parts) == 3:
+			status, err := s.apiServerStatus(r, cs)
+			if err != nil {
+				writeAPIError(w, 0, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, status)
+		case r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, apiServerFrom(cs))
+		case r.Method == http.MethodPut:
+			in := &APIServer{}
+			if !readJSON(w, r, in) {
+				return
+			}
+			if in.ResourceVersion == "" {
+				writeAPIError(w, http.StatusUnprocessableEntity, errors.New("resourceVersion is required"))
+				return
+			}
+			// The API replaces the whole server, like a PUT of the CometServer itself
+			var applyErr error
+			err := s.updateServer(r.Context(), cs, in.ResourceVersion, func(cs *cometdv1alpha1.CometServer) error {
+				applyErr = in.apply(cs)
+				return applyErr
+			})
+			if err != nil {
+				status := 0
+				if err == applyErr {
+					status = http.StatusUnprocessableEntity
+				}
+				writeAPIError(w, status, err)
+				return
+			}
+			if err := s.Client.Get(r.Context(), client.ObjectKeyFromObject(cs), cs); err != nil {
+				writeAPIError(w, 0, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, apiServerFrom(cs))
+		case r.Method == http.MethodDelete:
+			resourceVersion := r.URL.Query().Get("resourceVersion")
+			if resourceVersion == "" {
+				resourceVersion = cs.ResourceVersion
+			}
+			// The URL names the server, which confirms the deletion
+			if err := s.deleteServer(r.Context(), cs, resourceVersion, cs.Name); err != nil {
+				status := 0
+				if cs.Spec.DeletionProtection {
+					status = http.StatusConflict
+				}
+				writeAPIError(w, status, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) apiServerStatus(r *http.Request, cs *cometdv1alpha1.CometServer) (*APIServerStatus, error) {
+	depl := &appsv1.Deployment{}
+	err := s.Client.Get(r.Context(), types.NamespacedName{Namespace: cs.Namespace, Name: cs.Name}, depl)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	status := &APIServerStatus{
+		Available:    !cs.Spec.Suspend && depl.Status.AvailableReplicas > 0,
+		Suspended:    cs.Spec.Suspend,
+		SerialNumber: cs.SerialNumber(),
+		Conditions:   cs.Status.Conditions,
+	}
+	if status.Conditions == nil {
+		status.Conditions = []metav1.Condition{}
+	}
+	if !cs.Spec.Suspend {
+		health := s.getServerHealth(r.Context(), cs)
+		status.Health = &APIServerHealth{Error: health.Error}
+		if health.Version != nil {
+			status.Health.Healthy = true
+			status.Health.Version = health.Version.Version
+			status.Health.LicenseValidUntil = health.Version.LicenseValidUntil
+		}
+	}
+	return status, nil
+}
+
+func apiServerFrom(cs *cometdv1alpha1.CometServer) APIServer {
+	out := APIServer{
+		Namespace:          cs.Namespace,
+		Name:               cs.Name,
+		ResourceVersion:    cs.ResourceVersion,
+		Version:            cs.Spec.Version,
+		Issuer:             cs.Spec.License.Issuer,
+		Hostname:           cs.Spec.Ingress.Host,
+		Features:           cs.Spec.License.Features,
+		Suspend:            cs.Spec.Suspend,
+		DeletionProtection: cs.Spec.DeletionProtection,
+		FQDN:               cs.FQDN(),
+		SerialNumber:       cs.SerialNumber(),
+		CreatedAt:          cs.CreationTimestamp.Time,
+	}
+	if cs.Spec.Storage.Size != nil {
+		out.StorageSize = cs.Spec.Storage.Size.String()
+	}
+	return out
+}
+
+// apply sets the fields of the CometServer spec managed through the API.
+func (in *APIServer) apply(cs *cometdv1alpha1.CometServer) error {
+	cs.Spec.Version = in.Version
+	cs.Spec.License.Issuer = in.Issuer
+	cs.Spec.License.Features = in.Features
+	cs.Spec.Ingress.Host = in.Hostname
+	cs.Spec.Suspend = in.Suspend
+	cs.Spec.DeletionProtection = in.DeletionProtection
+	cs.Spec.Storage.Size = nil
+	if in.StorageSize != "" {
+		size, err := resource.ParseQuantity(in.StorageSize)
+		if err != nil {
+			return fmt.Errorf("storageSize: %w", err)
+		}
+		cs.Spec.Storage.Size = &size
+	}
+	return nil
+}
+
+// --
+
+func (s *Server) apiIssuers(w http.ResponseWriter, r *http.Request, parts []string) {
+	acc := s.access(r)
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		list := &cometdv1alpha1.CometLicenseIssuerList{}
+		if err := s.Client.List(r.Context(), list, client.InNamespace(r.URL.Query().Get("namespace"))); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		out := []APIIssuer{}
+		for i := range list.Items {
+			allowed, err := acc.Can("list", "cometlicenseissuers", list.Items[i].Namespace)
+			if err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if allowed {
+				out = append(out, apiIssuerFrom(&list.Items[i]))
+			}
+		}
+		writeJSON(w, http.StatusOK, out)
+
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		in := &APIIssuer{}
+		if !readJSON(w, r, in) {
+			return
+		}
+		if !s.apiAllowed(w, acc, "create", "cometlicenseissuers", in.Namespace) {
+			return
+		}
+		issuer := &cometdv1alpha1.CometLicenseIssuer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      in.Name,
+				Namespace: in.Namespace,
+			},
+		}
+		if in.Token != "" && !s.apiAllowed(w, acc, "create", "secrets", in.Namespace) {
+			return
+		}
+		in.apply(issuer)
+		if err := s.saveIssuer(r.Context(), issuer, nil, in.Token); err != nil {
+			writeAPIError(w, 0, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, apiIssuerFrom(issuer))
+
+	case len(parts) == 2:
+		verb := map[string]string{
+			http.MethodGet:    "get",
+			http.MethodPut:    "update",
+			http.MethodDelete: "delete",
+		}[r.Method]
+		if verb == "" {
+			writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		if !s.apiAllowed(w, acc, verb, "cometlicenseissuers", parts[0]) {
+			return
+		}
+		issuer := &cometdv1alpha1.CometLicenseIssuer{}
+		if err := s.Client.Get(r.Context(), types.NamespacedName{Namespace: parts[0], Name: parts[1]}, issuer); err != nil {
+			writeAPIError(w, 0, err)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, apiIssuerFrom(issuer))
+		case http.MethodPut:
+			in := &APIIssuer{}
+			if !readJSON(w, r, in) {
+				return
+			}
+			if in.ResourceVersion == "" {
+				writeAPIError(w, http.StatusUnprocessableEntity, errors.New("resourceVersion is required"))
+				return
+			}
+			if in.Token != "" && !s.apiAllowed(w, acc, "update", "secrets", parts[0]) {
+				return
+			}
+			updated := issuer.DeepCopy()
+			in.apply(updated)
+			updated.ResourceVersion = in.ResourceVersion
+			if err := s.saveIssuer(r.Context(), updated, issuer, in.Token); err != nil {
+				writeAPIError(w, 0, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, apiIssuerFrom(updated))
+		case http.MethodDelete:
+			if err := s.Client.Delete(r.Context(), issuer); err != nil {
+				writeAPIError(w, 0, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func apiIssuerFrom(issuer *cometdv1alpha1.CometLicenseIssuer) APIIssuer {
+	return APIIssuer{
+		Namespace:       issuer.Namespace,
+		Name:            issuer.Name,
+		ResourceVersion: issuer.ResourceVersion,
+		Email:           issuer.Spec.Auth.Email,
+		Features:        issuer.Spec.Features,
+		MaxServers:      issuer.Spec.MaxServers,
+	}
+}
+
+// apply sets the fields of the CometLicenseIssuer spec managed through the API, except for the
+// token, which saveIssuer stores.
+func (in *APIIssuer) apply(issuer *cometdv1alpha1.CometLicenseIssuer) {
+	issuer.Spec.Auth.Email = in.Email
+	issuer.Spec.Features = in.Features
+	issuer.Spec.MaxServers = in.MaxServers
+}
+
+// --
+
+// apiAllowed writes a 403 response unless the user may perform the verb.
+func (s *Server) apiAllowed(w http.ResponseWriter, acc *access, verb, resource, namespace string) bool {
+	if namespace == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, errors.New("namespace is required"))
+		return false
+	}
+	allowed, err := acc.Can(verb, resource, namespace)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if !allowed {
+		writeAPIError(w, http.StatusForbidden, fmt.Errorf("you are not allowed to %s %s in %s", verb, resource, namespace))
+		return false
+	}
+	return true
+}
+
+// readJSON decodes the request body into v, writing a 400 response if it is invalid.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes err as an APIError. If status is 0, it is taken from the Kubernetes API
+// error, defaulting to 500.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	out := &APIError{Error: err.Error()}
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		if status == 0 {
+			status = int(apiStatus.Status().Code)
+		}
+		if details := apiStatus.Status().Details; details != nil {
+			for _, cause := range details.Causes {
+				out.Fields = append(out.Fields, APIFieldError{Field: cause.Field, Message: cause.Message})
+			}
+		}
+	}
+	if err == errServerChanged {
+		status = http.StatusConflict
+	}
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, out)
+}
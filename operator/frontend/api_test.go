@@ -0,0 +1,248 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+var _ = Describe("API", func() {
+	var (
+		reviews *reviewClient
+		srv     *Server
+		user    *User
+		cs      *cometdv1alpha1.CometServer
+	)
+
+	BeforeEach(func() {
+		cs = &cometdv1alpha1.CometServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "cometd", Namespace: "default"},
+			Spec: cometdv1alpha1.CometServerSpec{
+				Version: "23.5.0",
+				License: cometdv1alpha1.CometServerLicense{Issuer: "issuer"},
+				Ingress: cometdv1alpha1.CometServerIngress{Host: "example.com"},
+			},
+		}
+		reviews = &reviewClient{
+			Client: newFakeClient(cs),
+			allow: func(attrs authorizationv1.ResourceAttributes) bool {
+				return attrs.Namespace == "default"
+			},
+		}
+		srv = &Server{Client: reviews, APIReader: reviews, Authorizer: &Authorizer{Client: reviews}}
+		user = &User{Name: "alice"}
+	})
+
+	// call sends the request as the user, and decodes the JSON response into out if not nil
+	call := func(method, path string, body interface{}, out interface{}) *httptest.ResponseRecorder {
+		var data []byte
+		if body != nil {
+			var err error
+			data, err = json.Marshal(body)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		r := httptest.NewRequest(method, path, bytes.NewReader(data))
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+		rec := httptest.NewRecorder()
+		srv.api(rec, r)
+		if out != nil {
+			Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(json.Unmarshal(rec.Body.Bytes(), out)).To(Succeed())
+		}
+		return rec
+	}
+
+	get := func() *APIServer {
+		out := &APIServer{}
+		Expect(call(http.MethodGet, "/api/v1/servers/default/cometd", nil, out).Code).To(Equal(http.StatusOK))
+		return out
+	}
+
+	stored := func() *cometdv1alpha1.CometServer {
+		current := &cometdv1alpha1.CometServer{}
+		Expect(reviews.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "cometd"}, current)).To(Succeed())
+		return current
+	}
+
+	Describe("updating a server", func() {
+		It("updates it at its resourceVersion", func() {
+			in := get()
+			in.Version = "23.6.0"
+			out := &APIServer{}
+			Expect(call(http.MethodPut, "/api/v1/servers/default/cometd", in, out).Code).To(Equal(http.StatusOK))
+			Expect(out.Version).To(Equal("23.6.0"))
+			Expect(out.ResourceVersion).NotTo(Equal(in.ResourceVersion))
+			Expect(stored().Spec.Version).To(Equal("23.6.0"))
+		})
+
+		It("conflicts with a change made in the meantime", func() {
+			in := get()
+			changed := stored()
+			changed.Spec.Suspend = true
+			Expect(reviews.Update(context.Background(), changed)).To(Succeed())
+
+			in.Version = "23.6.0"
+			out := &APIError{}
+			Expect(call(http.MethodPut, "/api/v1/servers/default/cometd", in, out).Code).To(Equal(http.StatusConflict))
+			Expect(out.Error).NotTo(BeEmpty())
+			Expect(stored().Spec.Version).To(Equal("23.5.0"))
+		})
+
+		It("requires the resourceVersion", func() {
+			in := get()
+			in.ResourceVersion = ""
+			out := &APIError{}
+			Expect(call(http.MethodPut, "/api/v1/servers/default/cometd", in, out).Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(out.Error).To(ContainSubstring("resourceVersion"))
+		})
+
+		It("reports the invalid fields", func() {
+			in := get()
+			in.Version = "not a version"
+			in.Hostname = ""
+			out := &APIError{}
+			Expect(call(http.MethodPut, "/api/v1/servers/default/cometd", in, out).Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(out.Fields).To(ConsistOf(
+				HaveField("Field", "spec.version"),
+				HaveField("Field", "spec.ingress.host"),
+			))
+		})
+
+		It("reports an invalid storage size", func() {
+			in := get()
+			in.StorageSize = "lots"
+			out := &APIError{}
+			Expect(call(http.MethodPut, "/api/v1/servers/default/cometd", in, out).Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(out.Error).To(ContainSubstring("storageSize"))
+		})
+
+		It("refuses changes to the license once the serial number is issued", func() {
+			current := stored()
+			current.Annotations = map[string]string{"cometd.cometbackup.com/serial-number": "SERIAL"}
+			Expect(reviews.Update(context.Background(), current)).To(Succeed())
+
+			in := get()
+			in.Issuer = "other"
+			out := &APIError{}
+			Expect(call(http.MethodPut, "/api/v1/servers/default/cometd", in, out).Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(out.Fields).To(ConsistOf(HaveField("Field", "spec.license.issuer")))
+		})
+	})
+
+	Describe("creating a server", func() {
+		It("reports the invalid fields", func() {
+			in := &APIServer{Namespace: "default", Name: "new", Version: "23.5.0"}
+			out := &APIError{}
+			Expect(call(http.MethodPost, "/api/v1/servers", in, out).Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(out.Fields).To(ContainElements(
+				HaveField("Field", "spec.license.issuer"),
+				HaveField("Field", "spec.ingress.host"),
+			))
+		})
+
+		It("rejects unknown fields", func() {
+			out := &APIError{}
+			Expect(call(http.MethodPost, "/api/v1/servers", map[string]string{"namespace": "default", "color": "blue"}, out).Code).To(Equal(http.StatusBadRequest))
+			Expect(out.Error).To(ContainSubstring("color"))
+		})
+	})
+
+	Describe("authorization", func() {
+		BeforeEach(func() {
+			other := cs.DeepCopy()
+			other.Namespace = "other"
+			other.ResourceVersion = ""
+			Expect(reviews.Create(context.Background(), other)).To(Succeed())
+		})
+
+		It("lists only the servers of namespaces the user may list", func() {
+			out := []APIServer{}
+			Expect(call(http.MethodGet, "/api/v1/servers", nil, &out).Code).To(Equal(http.StatusOK))
+			Expect(out).To(ConsistOf(HaveField("Namespace", "default")))
+		})
+
+		DescribeTable("forbids what the user may not do",
+			func(method, path string, body interface{}, verb string) {
+				out := &APIError{}
+				Expect(call(method, path, body, out).Code).To(Equal(http.StatusForbidden))
+				Expect(out.Error).To(ContainSubstring("not allowed to " + verb))
+			},
+			Entry("get", http.MethodGet, "/api/v1/servers/other/cometd", nil, "get"),
+			Entry("get the status", http.MethodGet, "/api/v1/servers/other/cometd/status", nil, "get"),
+			Entry("update", http.MethodPut, "/api/v1/servers/other/cometd", &APIServer{ResourceVersion: "1"}, "update"),
+			Entry("delete", http.MethodDelete, "/api/v1/servers/other/cometd", nil, "delete"),
+			Entry("create", http.MethodPost, "/api/v1/servers", &APIServer{Namespace: "other", Name: "new"}, "create"),
+			Entry("create an issuer", http.MethodPost, "/api/v1/issuers", &APIIssuer{Namespace: "other", Name: "new"}, "create"),
+		)
+
+		It("forbids before revealing whether the server exists", func() {
+			out := &APIError{}
+			Expect(call(http.MethodGet, "/api/v1/servers/other/missing", nil, out).Code).To(Equal(http.StatusForbidden))
+			Expect(call(http.MethodGet, "/api/v1/servers/default/missing", nil, out).Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("leaves a forbidden server unchanged", func() {
+			call(http.MethodDelete, "/api/v1/servers/other/cometd", nil, nil)
+			Expect(reviews.Get(context.Background(), types.NamespacedName{Namespace: "other", Name: "cometd"}, &cometdv1alpha1.CometServer{})).To(Succeed())
+		})
+	})
+
+	Describe("deleting a server", func() {
+		It("deletes it", func() {
+			Expect(call(http.MethodDelete, "/api/v1/servers/default/cometd", nil, nil).Code).To(Equal(http.StatusNoContent))
+			err := reviews.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "cometd"}, &cometdv1alpha1.CometServer{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("refuses while deletion protection is enabled", func() {
+			current := stored()
+			current.Spec.DeletionProtection = true
+			Expect(reviews.Update(context.Background(), current)).To(Succeed())
+
+			out := &APIError{}
+			Expect(call(http.MethodDelete, "/api/v1/servers/default/cometd", nil, out).Code).To(Equal(http.StatusConflict))
+			Expect(out.Error).To(ContainSubstring("deletion protection is enabled"))
+			Expect(stored().DeletionTimestamp).To(BeNil())
+		})
+
+		It("deletes once deletion protection is disabled through the API", func() {
+			current := stored()
+			current.Spec.DeletionProtection = true
+			Expect(reviews.Update(context.Background(), current)).To(Succeed())
+
+			in := get()
+			Expect(in.DeletionProtection).To(BeTrue())
+			in.DeletionProtection = false
+			Expect(call(http.MethodPut, "/api/v1/servers/default/cometd", in, nil).Code).To(Equal(http.StatusOK))
+
+			Expect(call(http.MethodDelete, "/api/v1/servers/default/cometd", nil, nil).Code).To(Equal(http.StatusNoContent))
+		})
+	})
+})
@@ -0,0 +1,252 @@
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Auth authenticates requests to the frontend. Browsers log in with a password or OIDC and are
+// then identified by their session cookie, while API clients send a bearer token with every
+// request. Any of the authenticators may be nil to disable that method.
+type Auth struct {
+	Sessions *SessionStore
+	Password PasswordAuthenticator
+	OIDC     *OIDCProvider
+	Tokens   TokenAuthenticator
+}
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	sessionContextKey
+)
+
+// UserFrom returns the authenticated user of the request context, or nil.
+func UserFrom(ctx context.Context) *User {
+	user, _ := ctx.Value(userContextKey).(*User)
+	return user
+}
+
+// sessionFrom returns the session of the request context, or nil for bearer token requests.
+func sessionFrom(ctx context.Context) *Session {
+	sess, _ := ctx.Value(sessionContextKey).(*Session)
+	return sess
+}
+
+// publicPaths are served without logging in, as are the static files.
+var publicPaths = map[string]bool{
+	"/login":           true,
+	"/login/oidc":      true,
+	"/oauth2/callback": true,
+	"/logout":          true,
+
+	"/api/v1/openapi.json": true,
+}
+
+// middleware authenticates the request, and checks the CSRF token of browser requests which
+// change anything.
+func (a *Auth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqLogger := log.FromContext(r.Context())
+
+		if token, ok := bearerToken(r); ok {
+			if a.Tokens == nil {
+				unauthorized(w)
+				return
+			}
+			user, err := a.Tokens.AuthenticateToken(r.Context(), token)
+			if err != nil {
+				if err != errInvalidCredentials {
+					reqLogger.Error(err, "Failed to authenticate bearer token.")
+				}
+				unauthorized(w)
+				return
+			}
+			// Bearer tokens aren't sent by browsers on their own, so need no CSRF protection
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+			return
+		}
+
+		sess, err := a.Sessions.Get(r)
+		if err != nil {
+			reqLogger.Error(err, "Failed to read session.")
+			renderErrorPage(w, r)
+			return
+		}
+		if sess == nil {
+			sess = a.Sessions.New()
+			if err := a.Sessions.Save(w, r, sess); err != nil {
+				reqLogger.Error(err, "Failed to save session.")
+				renderErrorPage(w, r)
+				return
+			}
+		}
+		if !isSafeMethod(r.Method) && !sess.ValidCSRFToken(r) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Forbidden: invalid CSRF token, reload the page and try again"))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), sessionContextKey, sess)
+		if sess.User != nil {
+			ctx = context.WithValue(ctx, userContextKey, sess.User)
+		} else if !publicPaths[r.URL.Path] && !strings.HasPrefix(r.URL.Path, staticPrefix) {
+			if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+				return
+			}
+			unauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// --
+
+type LoginPageData struct {
+	*PageData
+
+	Password bool
+	OIDC     bool
+	Username string
+	Next     string
+	Error    string
+}
+
+// login shows the login page, and handles the password login form.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	data := &LoginPageData{
+		PageData: newPageData(r, "Log In"),
+		Password: s.Auth.Password != nil,
+		OIDC:     s.Auth.OIDC != nil,
+		Next:     safeRedirect(r.FormValue("next")),
+	}
+	status := http.StatusOK
+	if r.Method == http.MethodPost && s.Auth.Password != nil {
+		data.Username = r.PostFormValue("username")
+		user, err := s.Auth.Password.AuthenticatePassword(r.Context(), data.Username, r.PostFormValue("password"))
+		if err == nil {
+			s.startSession(w, r, user, data.Next)
+			return
+		}
+		if err != errInvalidCredentials {
+			log.FromContext(r.Context()).Error(err, "Failed to authenticate password.")
+		}
+		data.Error = "Invalid username or password."
+		status = http.StatusUnauthorized
+	}
+	if err := RenderStatus(w, status, "login", data); err != nil {
+		renderError(w, r, err)
+	}
+}
+
+// loginOIDC redirects to the identity provider.
+func (s *Server) loginOIDC(w http.ResponseWriter, r *http.Request) {
+	if s.Auth.OIDC == nil {
+		http.NotFound(w, r)
+		return
+	}
+	sess := sessionFrom(r.Context())
+	sess.OIDCState = randomString(16)
+	sess.OIDCNonce = randomString(16)
+	sess.Next = safeRedirect(r.FormValue("next"))
+	authURL, err := s.Auth.OIDC.AuthCodeURL(r.Context(), sess.OIDCState, sess.OIDCNonce)
+	if err == nil {
+		err = s.Auth.Sessions.Save(w, r, sess)
+	}
+	if err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to start OIDC login.")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("The identity provider is unavailable"))
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oauth2Callback completes the OIDC login.
+func (s *Server) oauth2Callback(w http.ResponseWriter, r *http.Request) {
+	sess := sessionFrom(r.Context())
+	if s.Auth.OIDC == nil || sess.OIDCState == "" || r.FormValue("state") != sess.OIDCState {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Bad Request: unexpected OIDC callback, log in again"))
+		return
+	}
+	if msg := r.FormValue("error"); msg != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Login failed: " + msg))
+		return
+	}
+	user, err := s.Auth.OIDC.Exchange(r.Context(), r.FormValue("code"), sess.OIDCNonce)
+	if err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to complete OIDC login.")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Login failed"))
+		return
+	}
+	s.startSession(w, r, user, sess.Next)
+}
+
+// logout replaces the session with an anonymous one. Sessions are stateless cookies, so this can't
+// revoke the old cookie: a copy of it stays valid until it expires, after SessionStore.MaxAge.
+// Every session is ended by deleting the session Secret and restarting the operator, which then
+// creates a new key.
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method Not Allowed"))
+		return
+	}
+	s.startSession(w, r, nil, "/login")
+}
+
+// startSession replaces the session, so a session (and its CSRF token) obtained before logging
+// in can't be reused afterwards.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user *User, next string) {
+	sess := s.Auth.Sessions.New()
+	sess.User = user
+	if err := s.Auth.Sessions.Save(w, r, sess); err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to save session.")
+		renderErrorPage(w, r)
+		return
+	}
+	if next == "" {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// --
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="comet-server-operator"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte("Unauthorized"))
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// safeRedirect returns next if it is a path on this server, so the login can't be used to
+// redirect elsewhere.
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return ""
+	}
+	return next
+}
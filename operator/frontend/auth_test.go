@@ -0,0 +1,273 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// staticTokens authenticates the bearer tokens it maps to users.
+type staticTokens map[string]*User
+
+func (t staticTokens) AuthenticateToken(ctx context.Context, token string) (*User, error) {
+	if user, ok := t[token]; ok {
+		return user, nil
+	}
+	return nil, errInvalidCredentials
+}
+
+func newSessionStore() *SessionStore {
+	return &SessionStore{
+		Client: newFakeClient(),
+		Secret: types.NamespacedName{Namespace: "operator-system", Name: "operator-frontend-session"},
+		MaxAge: time.Hour,
+	}
+}
+
+// sessionCookie saves the session over HTTPS, and returns the cookie set.
+func sessionCookie(store *SessionStore, sess *Session) *http.Cookie {
+	rec := httptest.NewRecorder()
+	Expect(store.Save(rec, httptest.NewRequest(http.MethodGet, "https://example.com/", nil), sess)).To(Succeed())
+	cookies := rec.Result().Cookies()
+	Expect(cookies).To(HaveLen(1))
+	return cookies[0]
+}
+
+var _ = Describe("Auth", func() {
+	DescribeTable("safeRedirect",
+		func(next, expected string) {
+			Expect(safeRedirect(next)).To(Equal(expected))
+		},
+		Entry("a path", "/servers/default/cometd", "/servers/default/cometd"),
+		Entry("a path with a query", "/?namespace=default", "/?namespace=default"),
+		Entry("empty", "", ""),
+		Entry("an absolute URL", "https://evil.example.com/", ""),
+		Entry("a relative path", "servers", ""),
+		Entry("a protocol relative URL", "//evil.example.com/", ""),
+		Entry("a backslash, which browsers treat as a slash", "/\\evil.example.com/", ""),
+	)
+
+	DescribeTable("Session.ValidCSRFToken",
+		func(header, field string, valid bool) {
+			form := url.Values{}
+			if field != "" {
+				form.Set(csrfFieldName, field)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/servers", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if header != "" {
+				r.Header.Set(csrfHeaderName, header)
+			}
+			sess := &Session{CSRFToken: "token"}
+			Expect(sess.ValidCSRFToken(r)).To(Equal(valid))
+		},
+		Entry("in the header", "token", "", true),
+		Entry("in the form", "", "token", true),
+		Entry("the header takes precedence", "wrong", "token", false),
+		Entry("a wrong token", "", "wrong", false),
+		Entry("a prefix of the token", "tok", "", false),
+		Entry("missing", "", "", false),
+	)
+
+	It("rejects an empty CSRF token, even for a session without one", func() {
+		r := httptest.NewRequest(http.MethodPost, "/servers", nil)
+		Expect((&Session{}).ValidCSRFToken(r)).To(BeFalse())
+	})
+
+	Describe("SessionStore", func() {
+		var store *SessionStore
+
+		BeforeEach(func() {
+			store = newSessionStore()
+		})
+
+		get := func(cookie *http.Cookie) *Session {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if cookie != nil {
+				r.AddCookie(cookie)
+			}
+			sess, err := store.Get(r)
+			Expect(err).NotTo(HaveOccurred())
+			return sess
+		}
+
+		It("round-trips a session through its cookie", func() {
+			sess := store.New()
+			sess.User = &User{Name: "alice", Groups: []string{"admins"}}
+			sess.Next = "/issuers"
+			cookie := sessionCookie(store, sess)
+			Expect(cookie.Name).To(Equal(sessionCookieName))
+			Expect(cookie.HttpOnly).To(BeTrue())
+			Expect(cookie.Secure).To(BeTrue())
+			Expect(cookie.Value).NotTo(ContainSubstring("alice"))
+
+			got := get(cookie)
+			Expect(got).NotTo(BeNil())
+			Expect(got.User).To(Equal(sess.User))
+			Expect(got.CSRFToken).To(Equal(sess.CSRFToken))
+			Expect(got.Next).To(Equal("/issuers"))
+		})
+
+		It("shares the key through the Secret", func() {
+			cookie := sessionCookie(store, store.New())
+			other := &SessionStore{Client: store.Client, Secret: store.Secret, MaxAge: time.Hour}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(cookie)
+			sess, err := other.Get(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sess).NotTo(BeNil())
+		})
+
+		DescribeTable("marks the cookie Secure only over HTTPS",
+			func(target, forwardedProto string, secure bool) {
+				r := httptest.NewRequest(http.MethodGet, target, nil)
+				if forwardedProto != "" {
+					r.Header.Set("X-Forwarded-Proto", forwardedProto)
+				}
+				rec := httptest.NewRecorder()
+				Expect(store.Save(rec, r, store.New())).To(Succeed())
+				cookies := rec.Result().Cookies()
+				Expect(cookies).To(HaveLen(1))
+				Expect(cookies[0].Secure).To(Equal(secure))
+			},
+			Entry("TLS", "https://example.com/", "", true),
+			Entry("behind an HTTPS Ingress", "http://example.com/", "https", true),
+			Entry("plain HTTP", "http://example.com/", "", false),
+			Entry("behind a plain HTTP Ingress", "http://example.com/", "http", false),
+		)
+
+		It("returns no session without a cookie", func() {
+			Expect(get(nil)).To(BeNil())
+		})
+
+		DescribeTable("ignores tampered cookies",
+			func(tamper func(value string) string) {
+				cookie := sessionCookie(store, &Session{User: &User{Name: "alice"}, CSRFToken: "token", Expires: time.Now().Add(time.Hour)})
+				cookie.Value = tamper(cookie.Value)
+				Expect(get(cookie)).To(BeNil())
+			},
+			Entry("a changed byte", func(value string) string {
+				b := []byte(value)
+				i := len(b) / 2
+				if b[i] == 'A' {
+					b[i] = 'B'
+				} else {
+					b[i] = 'A'
+				}
+				return string(b)
+			}),
+			Entry("truncated", func(value string) string { return value[:len(value)-4] }),
+			Entry("shorter than the nonce", func(value string) string { return value[:8] }),
+			Entry("not base64", func(value string) string { return "!" + value }),
+			Entry("empty", func(value string) string { return "" }),
+		)
+
+		It("ignores expired sessions", func() {
+			cookie := sessionCookie(store, &Session{User: &User{Name: "alice"}, CSRFToken: "token", Expires: time.Now().Add(-time.Minute)})
+			Expect(get(cookie)).To(BeNil())
+		})
+	})
+
+	Describe("middleware", func() {
+		var (
+			auth    *Auth
+			handler http.Handler
+			served  *User
+		)
+
+		BeforeEach(func() {
+			auth = &Auth{
+				Sessions: newSessionStore(),
+				Tokens:   staticTokens{"secret": {Name: "robot"}},
+			}
+			served = nil
+			handler = auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = UserFrom(r.Context())
+				w.WriteHeader(http.StatusNoContent)
+			}))
+		})
+
+		serve := func(r *http.Request) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			return rec
+		}
+
+		loggedIn := func(method, csrfToken string) *http.Request {
+			sess := &Session{User: &User{Name: "alice"}, CSRFToken: "token", Expires: time.Now().Add(time.Hour)}
+			r := httptest.NewRequest(method, "/servers", nil)
+			r.AddCookie(sessionCookie(auth.Sessions, sess))
+			if csrfToken != "" {
+				r.Header.Set(csrfHeaderName, csrfToken)
+			}
+			return r
+		}
+
+		DescribeTable("checks the CSRF token of browser requests",
+			func(method, csrfToken string, expected int) {
+				rec := serve(loggedIn(method, csrfToken))
+				Expect(rec.Code).To(Equal(expected))
+				if expected == http.StatusForbidden {
+					Expect(served).To(BeNil())
+					Expect(rec.Body.String()).To(ContainSubstring("invalid CSRF token"))
+				} else {
+					Expect(served.Name).To(Equal("alice"))
+				}
+			},
+			Entry("a GET without a token", http.MethodGet, "", http.StatusNoContent),
+			Entry("a POST with the token", http.MethodPost, "token", http.StatusNoContent),
+			Entry("a POST without a token", http.MethodPost, "", http.StatusForbidden),
+			Entry("a POST with a wrong token", http.MethodPost, "wrong", http.StatusForbidden),
+			Entry("a DELETE without a token", http.MethodDelete, "", http.StatusForbidden),
+		)
+
+		It("rejects a POST of a new session, which can't have the token yet", func() {
+			rec := serve(httptest.NewRequest(http.MethodPost, "/login", nil))
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(rec.Result().Cookies()).To(HaveLen(1))
+		})
+
+		It("needs no CSRF token with a bearer token", func() {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/namespaces/default/cometservers", nil)
+			r.Header.Set("Authorization", "Bearer secret")
+			Expect(serve(r).Code).To(Equal(http.StatusNoContent))
+			Expect(served.Name).To(Equal("robot"))
+		})
+
+		It("rejects an invalid bearer token, even with a session", func() {
+			r := loggedIn(http.MethodGet, "")
+			r.Header.Set("Authorization", "Bearer wrong")
+			Expect(serve(r).Code).To(Equal(http.StatusUnauthorized))
+			Expect(served).To(BeNil())
+		})
+
+		It("redirects anonymous page views to the login page", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "/servers/default/cometd", nil))
+			Expect(rec.Code).To(Equal(http.StatusSeeOther))
+			Expect(rec.Header().Get("Location")).To(Equal("/login?next=%2Fservers%2Fdefault%2Fcometd"))
+		})
+	})
+})
@@ -0,0 +1,86 @@
+package frontend
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errInvalidCredentials is returned by authenticators for a wrong password or token.
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// User is an authenticated user of the frontend, named as the Kubernetes API would know them.
+type User struct {
+	Name   string   `json:"name"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// PasswordAuthenticator authenticates the login form.
+type PasswordAuthenticator interface {
+	AuthenticatePassword(ctx context.Context, username, password string) (*User, error)
+}
+
+// TokenAuthenticator authenticates bearer tokens.
+type TokenAuthenticator interface {
+	AuthenticateToken(ctx context.Context, token string) (*User, error)
+}
+
+// --
+
+// StaticUsers authenticates users listed in a Secret. Each key of the Secret is a username, and
+// its value the password.
+type StaticUsers struct {
+	Client client.Reader
+	Secret types.NamespacedName
+}
+
+func (u *StaticUsers) AuthenticatePassword(ctx context.Context, username, password string) (*User, error) {
+	secret := &corev1.Secret{}
+	if err := u.Client.Get(ctx, u.Secret, secret); err != nil {
+		return nil, err
+	}
+	expected, ok := secret.Data[username]
+	if !ok || username == "" || len(expected) == 0 {
+		return nil, errInvalidCredentials
+	}
+	if subtle.ConstantTimeCompare(expected, []byte(password)) != 1 {
+		return nil, errInvalidCredentials
+	}
+	return &User{Name: username}, nil
+}
+
+// --
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+// TokenReviewAuthenticator authenticates bearer tokens with the Kubernetes API server, so any
+// token it accepts (e.g. a ServiceAccount token) can be used with the frontend.
+type TokenReviewAuthenticator struct {
+	Client client.Client
+	// Audiences the token must be issued for. The API server's audiences if empty.
+	Audiences []string
+}
+
+func (a *TokenReviewAuthenticator) AuthenticateToken(ctx context.Context, token string) (*User, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.Audiences,
+		},
+	}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return nil, err
+	}
+	if !review.Status.Authenticated {
+		return nil, errInvalidCredentials
+	}
+	return &User{
+		Name:   review.Status.User.Username,
+		Groups: review.Status.User.Groups,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Authorizer checks what the logged in user may do with SubjectAccessReviews, so the frontend
+// grants exactly what the user's RBAC bindings grant through kubectl.
+type Authorizer struct {
+	Client client.Client
+}
+
+// Allowed reports whether the user may perform the verb on the resource in the namespace.
+func (a *Authorizer) Allowed(ctx context.Context, user *User, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	groups := user.Groups
+	if !containsString(groups, "system:authenticated") {
+		// The API server adds this group to every authenticated request
+		groups = append(append([]string{}, groups...), "system:authenticated")
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               user.Name,
+			Groups:             groups,
+			ResourceAttributes: &attrs,
+		},
+	}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+// access answers the authorization questions of a single request, asking the API server at most
+// once for each.
+type access struct {
+	ctx        context.Context
+	authorizer *Authorizer
+	user       *User
+	cache      map[authorizationv1.ResourceAttributes]bool
+}
+
+func (s *Server) access(r *http.Request) *access {
+	return &access{
+		ctx:        r.Context(),
+		authorizer: s.Authorizer,
+		user:       UserFrom(r.Context()),
+		cache:      map[authorizationv1.ResourceAttributes]bool{},
+	}
+}
+
+// coreResources are checked in the core API group, all others in cometd.cometbackup.com.
+var coreResources = map[string]bool{
+	"pods":    true,
+	"events":  true,
+	"secrets": true,
+}
+
+// Can reports whether the user may perform the verb on the resource (or resource/subresource) in
+// the namespace. Everything is allowed when authentication or authorization is disabled.
+func (a *access) Can(verb, resource, namespace string) (bool, error) {
+	if a.authorizer == nil || a.user == nil {
+		return true, nil
+	}
+	resource, subresource, _ := strings.Cut(resource, "/")
+	attrs := authorizationv1.ResourceAttributes{
+		Namespace:   namespace,
+		Verb:        verb,
+		Group:       cometdv1alpha1.GroupVersion.Group,
+		Resource:    resource,
+		Subresource: subresource,
+	}
+	if coreResources[resource] {
+		attrs.Group = ""
+	}
+	if allowed, ok := a.cache[attrs]; ok {
+		return allowed, nil
+	}
+	allowed, err := a.authorizer.Allowed(a.ctx, a.user, attrs)
+	if err != nil {
+		return false, err
+	}
+	a.cache[attrs] = allowed
+	return allowed, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
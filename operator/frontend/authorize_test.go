@@ -0,0 +1,139 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reviewClient answers SubjectAccessReviews with allow, recording the reviews asked.
+type reviewClient struct {
+	client.Client
+
+	allow   func(attrs authorizationv1.ResourceAttributes) bool
+	reviews []authorizationv1.SubjectAccessReviewSpec
+}
+
+func (c *reviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	c.reviews = append(c.reviews, review.Spec)
+	review.Status.Allowed = c.allow(*review.Spec.ResourceAttributes)
+	return nil
+}
+
+// requestAs returns a request authenticated as the user.
+func requestAs(user *User) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if user != nil {
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+	}
+	return r
+}
+
+var _ = Describe("access", func() {
+	var (
+		reviews *reviewClient
+		srv     *Server
+	)
+
+	BeforeEach(func() {
+		reviews = &reviewClient{
+			Client: newFakeClient(),
+			allow: func(attrs authorizationv1.ResourceAttributes) bool {
+				return attrs.Verb == "get"
+			},
+		}
+		srv = &Server{Authorizer: &Authorizer{Client: reviews}}
+	})
+
+	DescribeTable("checks resources in their API group",
+		func(resource string, expected authorizationv1.ResourceAttributes) {
+			_, err := srv.access(requestAs(&User{Name: "alice"})).Can("list", resource, "default")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reviews.reviews).To(HaveLen(1))
+			Expect(*reviews.reviews[0].ResourceAttributes).To(Equal(expected))
+		},
+		Entry("a CometServer", "cometservers", authorizationv1.ResourceAttributes{
+			Namespace: "default", Verb: "list", Group: "cometd.cometbackup.com", Resource: "cometservers",
+		}),
+		Entry("pods", "pods", authorizationv1.ResourceAttributes{
+			Namespace: "default", Verb: "list", Resource: "pods",
+		}),
+		Entry("events", "events", authorizationv1.ResourceAttributes{
+			Namespace: "default", Verb: "list", Resource: "events",
+		}),
+		Entry("secrets", "secrets", authorizationv1.ResourceAttributes{
+			Namespace: "default", Verb: "list", Resource: "secrets",
+		}),
+		Entry("a core subresource", "pods/log", authorizationv1.ResourceAttributes{
+			Namespace: "default", Verb: "list", Resource: "pods", Subresource: "log",
+		}),
+		Entry("a CometServer subresource", "cometservers/status", authorizationv1.ResourceAttributes{
+			Namespace: "default", Verb: "list", Group: "cometd.cometbackup.com", Resource: "cometservers", Subresource: "status",
+		}),
+	)
+
+	It("asks once for each question of a request", func() {
+		acc := srv.access(requestAs(&User{Name: "alice"}))
+		for i := 0; i < 3; i++ {
+			allowed, err := acc.Can("get", "cometservers", "default")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allowed).To(BeTrue())
+			allowed, err = acc.Can("delete", "cometservers", "default")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allowed).To(BeFalse())
+		}
+		_, err := acc.Can("get", "cometservers", "other")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews.reviews).To(HaveLen(3))
+
+		// Answers aren't kept across requests, so changed RBAC bindings apply immediately
+		_, err = srv.access(requestAs(&User{Name: "alice"})).Can("get", "cometservers", "default")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews.reviews).To(HaveLen(4))
+	})
+
+	It("reviews the user with the system:authenticated group", func() {
+		user := &User{Name: "alice", Groups: []string{"admins"}}
+		_, err := srv.access(requestAs(user)).Can("get", "cometservers", "default")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews.reviews[0].User).To(Equal("alice"))
+		Expect(reviews.reviews[0].Groups).To(Equal([]string{"admins", "system:authenticated"}))
+		Expect(user.Groups).To(Equal([]string{"admins"}))
+	})
+
+	It("allows everything without a user or authorizer", func() {
+		allowed, err := srv.access(requestAs(nil)).Can("delete", "cometservers", "default")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allowed).To(BeTrue())
+
+		allowed, err = (&Server{}).access(requestAs(&User{Name: "alice"})).Can("delete", "cometservers", "default")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allowed).To(BeTrue())
+		Expect(reviews.reviews).To(BeEmpty())
+	})
+})
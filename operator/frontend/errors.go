@@ -0,0 +1,84 @@
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+type ErrorPageData struct {
+	*PageData
+
+	Status  int
+	Message string
+}
+
+// renderError logs err and renders the error page. The error itself isn't shown, as it may reveal
+// more than the user is allowed to see.
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	log.FromContext(r.Context()).Error(err, "Failed to serve page.", "path", r.URL.Path)
+	renderErrorPage(w, r)
+}
+
+func renderErrorPage(w http.ResponseWriter, r *http.Request) {
+	err := RenderStatus(w, http.StatusInternalServerError, "error", &ErrorPageData{
+		PageData: newPageData(r, http.StatusText(http.StatusInternalServerError)),
+		Status:   http.StatusInternalServerError,
+		Message:  "Something went wrong while loading this page. The error has been logged - try again, or contact your administrator if it persists.",
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Internal Error"))
+	}
+}
+
+// recoverer renders the error page for handlers which panic, rather than dropping the connection.
+// Nothing more can be done once the handler has started its response.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err, ok := v.(error)
+			if !ok {
+				err = fmt.Errorf("%v", v)
+			}
+			log.FromContext(r.Context()).Error(err, "Recovered from panic.", "path", r.URL.Path, "stack", string(debug.Stack()))
+			if !rw.wroteHeader {
+				renderErrorPage(rw, r)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// responseWriter records whether the response has been started. It keeps http.Flusher, which the
+// event and log streams need.
+type responseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// failingClient fails every read, as when the API server is unavailable.
+type failingClient struct {
+	client.Client
+}
+
+func (c *failingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return errors.New("connection refused")
+}
+
+func (c *failingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return errors.New("connection refused")
+}
+
+var _ = Describe("Error page", func() {
+	BeforeEach(func() {
+		Expect(LoadTemplates()).To(Succeed())
+	})
+
+	DescribeTable("is rendered when a page fails to load",
+		func(path string) {
+			srv := &Server{Client: &failingClient{Client: newFakeClient()}}
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+			Expect(rec.Body.String()).To(ContainSubstring("Something went wrong while loading this page"))
+			Expect(rec.Body.String()).NotTo(ContainSubstring("connection refused"))
+		},
+		Entry("the overview", "/"),
+		Entry("a server", "/servers/default/cometd"),
+		Entry("the issuers", "/issuers"),
+		Entry("an issuer", "/issuers/default/issuer"),
+	)
+})
@@ -0,0 +1,499 @@
+package frontend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// issuerTokenKey is the key of the API token in an issuer's credentials Secret.
+const issuerTokenKey = "token"
+
+// issuerFormFields maps CometLicenseIssuer fields to the inputs of the issuer forms.
+var issuerFormFields = map[string]string{
+	"metadata.name":            "name",
+	"metadata.namespace":       "namespace",
+	"spec.auth.email":          "email",
+	"spec.auth.token":          "token",
+	"spec.auth.tokenSecretRef": "token",
+	"spec.maxServers":          "maxServers",
+	"spec.features":            "features",
+}
+
+// IssuerSummary is a CometLicenseIssuer with its validity and usage.
+type IssuerSummary struct {
+	Issuer *cometdv1alpha1.CometLicenseIssuer
+	// Problem is why serial numbers can't be issued. Empty if the issuer is valid.
+	Problem string
+	// InlineToken is set if the API token is stored in the CometLicenseIssuer itself.
+	InlineToken bool
+	// Servers using the issuer, and how many of them hold a serial number.
+	Servers []cometdv1alpha1.CometServer
+	Issued  int
+}
+
+// QuotaReached reports whether no more serial numbers can be issued.
+func (is *IssuerSummary) QuotaReached() bool {
+	return is.Issuer.Spec.MaxServers > 0 && is.Issued >= is.Issuer.Spec.MaxServers
+}
+
+// IssuerForm is the create and edit form of a CometLicenseIssuer. The API token is never shown,
+// and is left unchanged on edit if empty.
+type IssuerForm struct {
+	Namespace       string
+	Name            string
+	ResourceVersion string
+	Email           string
+	Token           string
+	MaxServers      string
+	// Features as NAME=VALUE lines.
+	Features string
+
+	// Errors by input name, and Error for anything not tied to an input.
+	Errors map[string]string
+	Error  string
+}
+
+// issuerFormFrom fills the form from the CometLicenseIssuer.
+func issuerFormFrom(issuer *cometdv1alpha1.CometLicenseIssuer) *IssuerForm {
+	form := &IssuerForm{
+		Namespace:       issuer.Namespace,
+		Name:            issuer.Name,
+		ResourceVersion: issuer.ResourceVersion,
+		Email:           issuer.Spec.Auth.Email,
+	}
+	if issuer.Spec.MaxServers > 0 {
+		form.MaxServers = strconv.Itoa(issuer.Spec.MaxServers)
+	}
+	names := make([]string, 0, len(issuer.Spec.Features))
+	for name := range issuer.Spec.Features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		form.Features += fmt.Sprintf("%s=%d\n", name, issuer.Spec.Features[name])
+	}
+	return form
+}
+
+// issuerFormFromRequest reads the posted form.
+func issuerFormFromRequest(r *http.Request) *IssuerForm {
+	return &IssuerForm{
+		Namespace:       strings.TrimSpace(r.PostFormValue("namespace")),
+		Name:            strings.TrimSpace(r.PostFormValue("name")),
+		ResourceVersion: r.PostFormValue("resourceVersion"),
+		Email:           strings.TrimSpace(r.PostFormValue("email")),
+		Token:           strings.TrimSpace(r.PostFormValue("token")),
+		MaxServers:      strings.TrimSpace(r.PostFormValue("maxServers")),
+		Features:        r.PostFormValue("features"),
+	}
+}
+
+// apply sets the spec of the CometLicenseIssuer from the form, except for the API token.
+// Returns false if the form has errors.
+func (f *IssuerForm) apply(issuer *cometdv1alpha1.CometLicenseIssuer) bool {
+	f.Errors = map[string]string{}
+	issuer.Spec.Auth.Email = f.Email
+	issuer.Spec.MaxServers = 0
+	if f.MaxServers != "" {
+		max, err := strconv.Atoi(f.MaxServers)
+		if err != nil {
+			f.Errors["maxServers"] = "Must be a whole number."
+		}
+		issuer.Spec.MaxServers = max
+	}
+	features, err := parseLicenseFeatures(f.Features)
+	if err != nil {
+		f.Errors["features"] = err.Error()
+	}
+	issuer.Spec.Features = features
+	return len(f.Errors) == 0
+}
+
+// SetError shows err on the inputs it relates to.
+func (f *IssuerForm) SetError(err error) {
+	if f.Errors == nil {
+		f.Errors = map[string]string{}
+	}
+	if apierrors.IsAlreadyExists(err) {
+		f.Errors["name"] = "A license issuer with this name already exists."
+		return
+	}
+	if errors.Is(err, errServerChanged) || apierrors.IsConflict(err) {
+		f.Error = "The issuer was changed since this page was loaded - review the changes and try again."
+		return
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil && len(status.Status().Details.Causes) > 0 {
+		var unmatched []string
+		for _, cause := range status.Status().Details.Causes {
+			// Features are reported by name, e.g. spec.features[booster]
+			field, _, _ := strings.Cut(cause.Field, "[")
+			if input, ok := issuerFormFields[field]; ok {
+				if _, set := f.Errors[input]; !set {
+					f.Errors[input] = cause.Message
+				}
+				continue
+			}
+			unmatched = append(unmatched, fmt.Sprintf("%s: %s", cause.Field, cause.Message))
+		}
+		f.Error = strings.Join(unmatched, "; ")
+		return
+	}
+	f.Error = err.Error()
+}
+
+// --
+
+type IssuersPageData struct {
+	*PageData
+
+	Issuers []IssuerSummary
+	Form    *IssuerForm
+}
+
+type IssuerPageData struct {
+	*PageData
+
+	Summary IssuerSummary
+	// Form is nil if the user can't update the issuer.
+	Form *IssuerForm
+}
+
+// issuers lists the CometLicenseIssuers at /issuers, and handles their create form.
+func (s *Server) issuers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderIssuers(w, r, &IssuerForm{}, http.StatusOK)
+	case http.MethodPost:
+		s.createIssuer(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method Not Allowed"))
+	}
+}
+
+func (s *Server) renderIssuers(w http.ResponseWriter, r *http.Request, form *IssuerForm, status int) {
+	list := &cometdv1alpha1.CometLicenseIssuerList{}
+	if err := s.Client.List(r.Context(), list); err != nil {
+		renderError(w, r, err)
+		return
+	}
+	acc := s.access(r)
+	var issuers []cometdv1alpha1.CometLicenseIssuer
+	for _, issuer := range list.Items {
+		allowed, err := acc.Can("list", "cometlicenseissuers", issuer.Namespace)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		if allowed {
+			issuers = append(issuers, issuer)
+		}
+	}
+	summaries, err := s.summarizeIssuers(r.Context(), issuers)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	err = RenderStatus(w, status, "issuers", &IssuersPageData{
+		PageData: newPageData(r, "License Issuers"),
+		Issuers:  summaries,
+		Form:     form,
+	})
+	if err != nil {
+		renderError(w, r, err)
+	}
+}
+
+// createIssuer handles the create form of the issuers page.
+func (s *Server) createIssuer(w http.ResponseWriter, r *http.Request) {
+	form := issuerFormFromRequest(r)
+	issuer := &cometdv1alpha1.CometLicenseIssuer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      form.Name,
+			Namespace: form.Namespace,
+		},
+	}
+	status := http.StatusUnprocessableEntity
+	if form.apply(issuer) {
+		err := s.issuerAllowed(r, "create", form.Namespace, form.Token)
+		if err != nil {
+			status = http.StatusForbidden
+		} else {
+			err = s.saveIssuer(r.Context(), issuer, nil, form.Token)
+		}
+		if err == nil {
+			http.Redirect(w, r, issuerPath(issuer), http.StatusSeeOther)
+			return
+		}
+		form.SetError(err)
+	}
+	// Never send the token back
+	form.Token = ""
+	s.renderIssuers(w, r, form, status)
+}
+
+// issuer shows the CometLicenseIssuer at /issuers/<namespace>/<name>, and handles its edit form.
+func (s *Server) issuer(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/issuers/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method Not Allowed"))
+		return
+	}
+	namespace, name := parts[0], parts[1]
+	acc := s.access(r)
+	allowed, err := acc.Can("get", "cometlicenseissuers", namespace)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return
+	}
+	issuer := &cometdv1alpha1.CometLicenseIssuer{}
+	err = s.Client.Get(r.Context(), types.NamespacedName{Namespace: namespace, Name: name}, issuer)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			http.NotFound(w, r)
+			return
+		}
+		renderError(w, r, err)
+		return
+	}
+	canUpdate, err := acc.Can("update", "cometlicenseissuers", namespace)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	var form *IssuerForm
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		if !canUpdate {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Forbidden"))
+			return
+		}
+		form = issuerFormFromRequest(r)
+		form.Namespace, form.Name = issuer.Namespace, issuer.Name
+		updated := issuer.DeepCopy()
+		status = http.StatusUnprocessableEntity
+		if form.apply(updated) {
+			err := s.issuerAllowed(r, "update", namespace, form.Token)
+			if err != nil {
+				status = http.StatusForbidden
+			} else if form.ResourceVersion == "" {
+				err = errServerChanged
+			} else {
+				updated.ResourceVersion = form.ResourceVersion
+				err = s.saveIssuer(r.Context(), updated, issuer, form.Token)
+			}
+			if err == nil {
+				http.Redirect(w, r, issuerPath(issuer), http.StatusSeeOther)
+				return
+			}
+			if errors.Is(err, errServerChanged) || apierrors.IsConflict(err) {
+				status = http.StatusConflict
+			}
+			form.SetError(err)
+		}
+		form.Token = ""
+	} else if canUpdate {
+		form = issuerFormFrom(issuer)
+	}
+
+	summaries, err := s.summarizeIssuers(r.Context(), []cometdv1alpha1.CometLicenseIssuer{*issuer})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	err = RenderStatus(w, status, "issuer", &IssuerPageData{
+		PageData: newPageData(r, issuer.Name),
+		Summary:  summaries[0],
+		Form:     form,
+	})
+	if err != nil {
+		renderError(w, r, err)
+	}
+}
+
+// issuerAllowed returns an error unless the user may perform the verb on CometLicenseIssuers in
+// the namespace, and, to store a token, on Secrets.
+func (s *Server) issuerAllowed(r *http.Request, verb, namespace, token string) error {
+	acc := s.access(r)
+	allowed, err := acc.Can(verb, "cometlicenseissuers", namespace)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("you are not allowed to %s license issuers in %s", verb, namespace)
+	}
+	if token == "" {
+		return nil
+	}
+	allowed, err = acc.Can(verb, "secrets", namespace)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("you are not allowed to %s secrets in %s", verb, namespace)
+	}
+	return nil
+}
+
+// summarizeIssuers checks the credentials of the CometLicenseIssuers, and finds the CometServers
+// using them.
+func (s *Server) summarizeIssuers(ctx context.Context, issuers []cometdv1alpha1.CometLicenseIssuer) ([]IssuerSummary, error) {
+	servers := &cometdv1alpha1.CometServerList{}
+	if err := s.Client.List(ctx, servers); err != nil {
+		return nil, err
+	}
+	summaries := make([]IssuerSummary, len(issuers))
+	for i := range issuers {
+		issuer := &issuers[i]
+		summary := &summaries[i]
+		summary.Issuer = issuer
+		summary.InlineToken = issuer.Spec.Auth.TokenSecretRef == nil && issuer.Spec.Auth.Token != ""
+		token, err := issuer.AuthToken(ctx, s.Client)
+		if err != nil {
+			summary.Problem = "API token: " + err.Error()
+		} else if token == "" || issuer.Spec.Auth.Email == "" {
+			summary.Problem = "The account email and API token are required."
+		}
+		for _, cs := range servers.Items {
+			if cs.Namespace != issuer.Namespace || cs.Spec.License.Issuer != issuer.Name {
+				continue
+			}
+			summary.Servers = append(summary.Servers, cs)
+			if cs.SerialNumber() != "" {
+				summary.Issued++
+			}
+		}
+	}
+	return summaries, nil
+}
+
+// saveIssuer creates the CometLicenseIssuer, or updates it from old, validating it as the admission
+// webhook would. A token is stored in the issuer's <name>-credentials Secret rather than in the
+// resource; if empty, the current token is kept.
+func (s *Server) saveIssuer(ctx context.Context, issuer, old *cometdv1alpha1.CometLicenseIssuer, token string) error {
+	if token != "" {
+		issuer.Spec.Auth.Token = ""
+		issuer.Spec.Auth.TokenSecretRef = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: issuer.Name + "-credentials"},
+			Key:                  issuerTokenKey,
+		}
+	}
+	if old == nil {
+		if err := issuer.ValidateCreate(); err != nil {
+			return err
+		}
+		if err := s.Client.Create(ctx, issuer); err != nil {
+			return err
+		}
+		if token == "" {
+			return nil
+		}
+		// The Secret is owned by the issuer, so it can only be created once the issuer exists
+		if err := s.saveIssuerToken(ctx, issuer, token); err != nil {
+			_ = s.Client.Delete(ctx, issuer)
+			return err
+		}
+		return nil
+	}
+
+	if err := issuer.ValidateUpdate(old); err != nil {
+		return err
+	}
+	// The issuer is updated first, so that a conflict leaves the token unchanged too
+	if err := s.Client.Update(ctx, issuer); err != nil {
+		return err
+	}
+	if token == "" {
+		return nil
+	}
+	return s.saveIssuerToken(ctx, issuer, token)
+}
+
+// saveIssuerToken creates or updates the Secret referenced by the issuer's TokenSecretRef. An
+// existing Secret is only updated if it belongs to the issuer.
+func (s *Server) saveIssuerToken(ctx context.Context, issuer *cometdv1alpha1.CometLicenseIssuer, token string) error {
+	ref := issuer.Spec.Auth.TokenSecretRef
+	secret := &corev1.Secret{}
+	err := s.Client.Get(ctx, types.NamespacedName{Namespace: issuer.Namespace, Name: ref.Name}, secret)
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ref.Name,
+				Namespace: issuer.Namespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{ref.Key: []byte(token)},
+		}
+		if err := controllerutil.SetControllerReference(issuer, secret, s.Client.Scheme()); err != nil {
+			return err
+		}
+		return s.Client.Create(ctx, secret)
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(secret, issuer) {
+		return fmt.Errorf("secret %s already exists, and does not belong to the issuer", ref.Name)
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[ref.Key] = []byte(token)
+	return s.Client.Update(ctx, secret)
+}
+
+func issuerPath(issuer *cometdv1alpha1.CometLicenseIssuer) string {
+	return "/issuers/" + issuer.Namespace + "/" + issuer.Name
+}
+
+// parseLicenseFeatures parses the features textarea of NAME=VALUE lines. Blank lines are ignored.
+func parseLicenseFeatures(text string) (cometdv1alpha1.CometLicenseFeatures, error) {
+	features := cometdv1alpha1.CometLicenseFeatures{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected NAME=VALUE", i+1)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s is not a number", i+1, strings.TrimSpace(value))
+		}
+		features[strings.TrimSpace(name)] = n
+	}
+	if len(features) == 0 {
+		return nil, nil
+	}
+	return features, nil
+}
@@ -0,0 +1,234 @@
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+const (
+	// serverStateAvailable and friends summarise a CometServer on the overview.
+	serverStateAvailable   = "Available"
+	serverStateUnavailable = "Unavailable"
+	serverStateSuspended   = "Suspended"
+
+	// liveKeepAliveInterval is how often a comment is sent on idle event streams, so proxies
+	// don't close them.
+	liveKeepAliveInterval = 30 * time.Second
+	// liveBufferSize is the number of updates buffered for each event stream. Updates to a slow
+	// stream beyond that are dropped.
+	liveBufferSize = 64
+)
+
+// ServerUpdate is streamed to the browser whenever a CometServer or its Deployment changes.
+type ServerUpdate struct {
+	Namespace    string             `json:"namespace"`
+	Name         string             `json:"name"`
+	Deleted      bool               `json:"deleted,omitempty"`
+	Version      string             `json:"version,omitempty"`
+	SerialNumber string             `json:"serialNumber,omitempty"`
+	FQDN         string             `json:"fqdn,omitempty"`
+	State        string             `json:"state,omitempty"`
+	Conditions   []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// serverState summarises the CometServer, given its Deployment (nil if not created yet).
+func serverState(cs *cometdv1alpha1.CometServer, depl *appsv1.Deployment) string {
+	switch {
+	case cs.Spec.Suspend:
+		return serverStateSuspended
+	case depl != nil && depl.Status.AvailableReplicas > 0:
+		return serverStateAvailable
+	default:
+		return serverStateUnavailable
+	}
+}
+
+// serverWatcher fans out changes to CometServers and their Deployments, as seen by the manager's
+// informers, to the event streams of the frontend.
+type serverWatcher struct {
+	client    client.Reader
+	informers cache.Informers
+
+	mu          sync.Mutex
+	started     bool
+	subscribers map[chan *ServerUpdate]struct{}
+}
+
+// subscribe returns a channel of updates. Call cancel when finished.
+func (sw *serverWatcher) subscribe(ctx context.Context) (<-chan *ServerUpdate, func(), error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if !sw.started {
+		if err := sw.start(ctx); err != nil {
+			return nil, nil, err
+		}
+		sw.started = true
+	}
+	ch := make(chan *ServerUpdate, liveBufferSize)
+	sw.subscribers[ch] = struct{}{}
+	cancel := func() {
+		sw.mu.Lock()
+		defer sw.mu.Unlock()
+		delete(sw.subscribers, ch)
+	}
+	return ch, cancel, nil
+}
+
+// start registers the event handlers on the informers, which the controllers already use.
+func (sw *serverWatcher) start(ctx context.Context) error {
+	informer, err := sw.informers.GetInformer(ctx, &cometdv1alpha1.CometServer{})
+	if err != nil {
+		return err
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { sw.publishFor(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { sw.publishFor(obj, false) },
+		DeleteFunc: func(obj interface{}) { sw.publishFor(obj, false) },
+	})
+	if err != nil {
+		return err
+	}
+
+	informer, err = sw.informers.GetInformer(ctx, &appsv1.Deployment{})
+	if err != nil {
+		return err
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { sw.publishFor(obj, true) },
+		UpdateFunc: func(_, obj interface{}) { sw.publishFor(obj, true) },
+		DeleteFunc: func(obj interface{}) { sw.publishFor(obj, true) },
+	})
+	return err
+}
+
+// publishFor publishes the update of the CometServer obj is, or if owned is set, is owned by.
+func (sw *serverWatcher) publishFor(obj interface{}, owned bool) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, ok := obj.(client.Object)
+	if !ok {
+		return
+	}
+	key := types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}
+	if owned {
+		owner := metav1.GetControllerOf(o)
+		if owner == nil || owner.Kind != "CometServer" {
+			return
+		}
+		key.Name = owner.Name
+	}
+
+	update, err := sw.getUpdate(context.Background(), key)
+	if err != nil {
+		log.Log.Error(err, "Failed to get CometServer update.", "cometserver", key)
+		return
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	for ch := range sw.subscribers {
+		select {
+		case ch <- update:
+		default:
+		}
+	}
+}
+
+// getUpdate reads the CometServer and its Deployment from the cache.
+func (sw *serverWatcher) getUpdate(ctx context.Context, key types.NamespacedName) (*ServerUpdate, error) {
+	update := &ServerUpdate{Namespace: key.Namespace, Name: key.Name}
+	cs := &cometdv1alpha1.CometServer{}
+	if err := sw.client.Get(ctx, key, cs); err != nil {
+		if apierrors.IsNotFound(err) {
+			update.Deleted = true
+			return update, nil
+		}
+		return nil, err
+	}
+	depl := &appsv1.Deployment{}
+	if err := sw.client.Get(ctx, key, depl); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		depl = nil
+	}
+	update.Version = cs.Spec.Version
+	update.SerialNumber = cs.SerialNumber()
+	update.FQDN = cs.FQDN()
+	update.State = serverState(cs, depl)
+	update.Conditions = cs.Status.Conditions
+	return update, nil
+}
+
+// --
+
+// live streams ServerUpdates as server-sent events, limited to the CometServers the user can
+// see. The ?namespace= and &name= parameters limit the stream to a single namespace or server.
+func (s *Server) live(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || s.watcher == nil {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, name := r.URL.Query().Get("namespace"), r.URL.Query().Get("name")
+	updates, cancel, err := s.watcher.subscribe(r.Context())
+	if err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to watch CometServers.")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Internal Error"))
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	acc := s.access(r)
+	verb := "list"
+	if name != "" {
+		verb = "get"
+	}
+	keepAlive := time.NewTicker(liveKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprintf(w, ": keep-alive\n\n")
+		case update := <-updates:
+			if (namespace != "" && update.Namespace != namespace) || (name != "" && update.Name != name) {
+				continue
+			}
+			allowed, err := acc.Can(verb, "cometservers", update.Namespace)
+			if err != nil || !allowed {
+				continue
+			}
+			data, err := json.Marshal(update)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: server\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,137 @@
+package frontend
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+const (
+	// defaultLogTailLines is the number of lines shown if the tail length isn't given.
+	defaultLogTailLines = 100
+	// maxLogTailLines caps the tail length.
+	maxLogTailLines = 5000
+	// maxLogLineSize is the longest log line shown. Longer lines are cut.
+	maxLogLineSize = 64 * 1024
+)
+
+// logContainers returns the containers of the CometServer's pods whose logs can be viewed, by name.
+// The log files can only be viewed while their sidecar is enabled.
+func logContainers(cs *cometdv1alpha1.CometServer) map[string]string {
+	containers := map[string]string{cometdv1alpha1.CometServerContainer: "Comet Server"}
+	if cs.Spec.LogFiles {
+		containers[cometdv1alpha1.CometServerLogsContainer] = "Log Files"
+	}
+	return containers
+}
+
+//+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+
+// serverLogs streams the logs of one of the CometServer's pods as plain text. The parameters are
+// pod, container, tail (the number of lines), search (only lines containing it, ignoring case) and
+// follow.
+func (s *Server) serverLogs(w http.ResponseWriter, r *http.Request, cs *cometdv1alpha1.CometServer) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method Not Allowed"))
+		return
+	}
+	if s.Clientset == nil {
+		http.NotFound(w, r)
+		return
+	}
+	allowed, err := s.access(r).Can("get", "pods/log", cs.Namespace)
+	if err != nil {
+		// Plain text rather than the error page, as the page shows the response as the log
+		log.FromContext(r.Context()).Error(err, "Failed to authorize pod logs.")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Internal Error"))
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return
+	}
+
+	query := r.URL.Query()
+	container := query.Get("container")
+	if container == "" {
+		container = cometdv1alpha1.CometServerContainer
+	}
+	if _, ok := logContainers(cs)[container]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Unknown container"))
+		return
+	}
+	tail := int64(defaultLogTailLines)
+	if v := query.Get("tail"); v != "" {
+		tail, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || tail < 1 || tail > maxLogTailLines {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("The tail length must be between 1 and " + strconv.Itoa(maxLogTailLines)))
+			return
+		}
+	}
+	follow := query.Get("follow") != ""
+	search := strings.ToLower(query.Get("search"))
+
+	// Only the CometServer's own pods, so that the logs of other pods can't be read with the
+	// permissions checked for this server
+	pod := &corev1.Pod{}
+	err = s.APIReader.Get(r.Context(), types.NamespacedName{Namespace: cs.Namespace, Name: query.Get("pod")}, pod)
+	if err != nil || pod.Labels["app"] != cs.Name {
+		http.NotFound(w, r)
+		return
+	}
+
+	stream, err := s.Clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &tail,
+		Follow:    follow,
+	}).Stream(r.Context())
+	if err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to get pod logs.", "pod", pod.Name, "container", container)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReaderSize(stream, maxLogLineSize)
+	for {
+		line, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+		// Skip the rest of overlong lines
+		for isPrefix {
+			_, isPrefix, err = reader.ReadLine()
+			if err != nil {
+				return
+			}
+		}
+		if search != "" && !strings.Contains(strings.ToLower(string(line)), search) {
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return
+		}
+		if follow && flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// maintenanceRetryAfter is the Retry-After, in seconds, of the maintenance page.
+const maintenanceRetryAfter = "60"
+
+type MaintenancePageData struct {
+	*PageData
+
+	BrandName string
+	Host      string
+	Suspended bool
+}
+
+// maintenance serves the maintenance page for requests addressed to a Comet Server. The operator
+// points a CometServer's ingress at the frontend while the Comet Server is unavailable.
+func (s *Server) maintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs, err := s.findServerForHost(r)
+		if err != nil {
+			// Plain text rather than the frontend's error page, as this is served to the Comet
+			// Server's users
+			log.FromContext(r.Context()).Error(err, "Failed to find the CometServer of the host.", "host", r.Host)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Internal Error"))
+			return
+		}
+		if cs == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		brandName := getBrandName(cs)
+		if brandName == "" {
+			brandName = cs.FQDN()
+		}
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		w.Header().Set("Cache-Control", "no-store")
+		err = RenderStatus(w, http.StatusServiceUnavailable, "maintenance", &MaintenancePageData{
+			PageData: &PageData{
+				PageTitle: brandName,
+			},
+			BrandName: brandName,
+			Host:      cs.FQDN(),
+			Suspended: cs.Spec.Suspend,
+		})
+		if err != nil {
+			renderError(w, r, err)
+		}
+	})
+}
+
+// findServerForHost returns the CometServer served under the request's host, or one of its
+// subdomains. Returns nil if the request isn't for a Comet Server.
+func (s *Server) findServerForHost(r *http.Request) (*cometdv1alpha1.CometServer, error) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	list := &cometdv1alpha1.CometServerList{}
+	if err := s.Client.List(r.Context(), list); err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		fqdn := strings.ToLower(list.Items[i].FQDN())
+		if host == fqdn || strings.HasSuffix(host, "."+fqdn) {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// getBrandName returns the brand name set in the CometServer's inline configuration, if any.
+func getBrandName(cs *cometdv1alpha1.CometServer) string {
+	if cs.Spec.Config == nil || cs.Spec.Config.Inline == nil {
+		return ""
+	}
+	cfg := struct {
+		Branding struct {
+			BrandName string
+		}
+	}{}
+	if err := json.Unmarshal(cs.Spec.Config.Inline.Raw, &cfg); err != nil {
+		return ""
+	}
+	return cfg.Branding.BrandName
+}
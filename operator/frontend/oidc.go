@@ -0,0 +1,238 @@
+package frontend
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider logs users in with an OpenID Connect identity provider, using the authorization
+// code flow. Usernames and groups are mapped as the API server's --oidc-* flags do, so the same
+// RBAC bindings apply to the frontend.
+type OIDCProvider struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the frontend's /oauth2/callback, as registered with the identity provider.
+	RedirectURL string
+	// Scopes requested in addition to "openid".
+	Scopes []string
+
+	// UsernameClaim is the ID token claim used as the username, "email" if empty.
+	UsernameClaim  string
+	UsernamePrefix string
+	// GroupsClaim is the ID token claim listing the user's groups, "groups" if empty.
+	GroupsClaim  string
+	GroupsPrefix string
+
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	config *oauth2.Config
+}
+
+// oidcDiscovery is the part of the provider's /.well-known/openid-configuration we use.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// AuthCodeURL is the identity provider's login page.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	config, err := p.oauth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+// Exchange redeems the authorization code, and returns the user of the ID token.
+//
+// The ID token is received directly from the token endpoint over TLS, which authenticates the
+// issuer in place of the token signature (OpenID Connect Core 1.0, section 3.1.3.7) - so
+// oauth2Config refuses an issuer or token endpoint which isn't HTTPS. Its claims are still checked.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (*User, error) {
+	config, err := p.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := config.Exchange(p.context(ctx), code)
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc: no id_token in token response")
+	}
+	claims, err := decodeJWTClaims(rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.verifyClaims(claims, nonce); err != nil {
+		return nil, err
+	}
+	return p.user(claims)
+}
+
+func (p *OIDCProvider) verifyClaims(claims map[string]interface{}, nonce string) error {
+	if iss, _ := claims["iss"].(string); iss != p.IssuerURL {
+		return fmt.Errorf("oidc: id_token issued by %q, expected %q", iss, p.IssuerURL)
+	}
+	if !claimContains(claims["aud"], p.ClientID) {
+		return errors.New("oidc: id_token not issued for this client")
+	}
+	exp, _ := claims["exp"].(float64)
+	if time.Now().After(time.Unix(int64(exp), 0)) {
+		return errors.New("oidc: id_token expired")
+	}
+	if n, _ := claims["nonce"].(string); n == "" || n != nonce {
+		return errors.New("oidc: id_token nonce does not match")
+	}
+	return nil
+}
+
+func (p *OIDCProvider) user(claims map[string]interface{}) (*User, error) {
+	usernameClaim := p.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "email"
+	}
+	username, _ := claims[usernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("oidc: id_token has no %s claim", usernameClaim)
+	}
+	if usernameClaim == "email" {
+		// As the API server does, only trust verified addresses
+		if verified, ok := claims["email_verified"].(bool); ok && !verified {
+			return nil, errors.New("oidc: email is not verified")
+		}
+	}
+	user := &User{Name: p.UsernamePrefix + username}
+
+	groupsClaim := p.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	switch groups := claims[groupsClaim].(type) {
+	case string:
+		user.Groups = []string{p.GroupsPrefix + groups}
+	case []interface{}:
+		for _, group := range groups {
+			if g, ok := group.(string); ok {
+				user.Groups = append(user.Groups, p.GroupsPrefix+g)
+			}
+		}
+	}
+	return user, nil
+}
+
+// oauth2Config discovers the provider's endpoints on first use.
+func (p *OIDCProvider) oauth2Config(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.config != nil {
+		return p.config, nil
+	}
+	if err := requireHTTPS("issuer", p.IssuerURL); err != nil {
+		return nil, err
+	}
+
+	wellKnown := strings.TrimSuffix(p.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery returned %s", resp.Status)
+	}
+	discovery := &oidcDiscovery{}
+	if err := json.NewDecoder(resp.Body).Decode(discovery); err != nil {
+		return nil, fmt.Errorf("oidc: failed to decode discovery document: %w", err)
+	}
+	if discovery.Issuer != p.IssuerURL {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", discovery.Issuer, p.IssuerURL)
+	}
+	if err := requireHTTPS("token endpoint", discovery.TokenEndpoint); err != nil {
+		return nil, err
+	}
+
+	p.config = &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Scopes:       append([]string{"openid"}, p.Scopes...),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}
+	return p.config, nil
+}
+
+// requireHTTPS returns an error unless rawURL is an absolute https URL. The ID token is only
+// trusted because it is received over TLS from the issuer.
+func requireHTTPS(name, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("oidc: %s %q must be an https URL", name, rawURL)
+	}
+	return nil
+}
+
+func (p *OIDCProvider) httpClient() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// context makes the oauth2 package use our HTTP client.
+func (p *OIDCProvider) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, p.httpClient())
+}
+
+// decodeJWTClaims returns the payload of a JWT, without verifying it.
+func decodeJWTClaims(jwt string) (map[string]interface{}, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed id_token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("oidc: malformed id_token: %w", err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("oidc: malformed id_token: %w", err)
+	}
+	return claims, nil
+}
+
+// claimContains reports whether the string or list claim contains value.
+func claimContains(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == value
+	case []interface{}:
+		for _, v := range c {
+			if v == value {
+				return true
+			}
+		}
+	}
+	return false
+}
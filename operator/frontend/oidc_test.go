@@ -0,0 +1,175 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OIDCProvider", func() {
+	const issuer = "https://accounts.example.com"
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   issuer,
+			"aud":   "operator",
+			"exp":   float64(time.Now().Add(time.Hour).Unix()),
+			"nonce": "nonce",
+			"email": "alice@example.com",
+		}
+	}
+
+	DescribeTable("verifyClaims",
+		func(mutate func(claims map[string]interface{}), expected string) {
+			p := &OIDCProvider{IssuerURL: issuer, ClientID: "operator"}
+			claims := validClaims()
+			mutate(claims)
+			err := p.verifyClaims(claims, "nonce")
+			if expected == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expected)))
+			}
+		},
+		Entry("valid", func(claims map[string]interface{}) {}, ""),
+		Entry("an audience list", func(claims map[string]interface{}) {
+			claims["aud"] = []interface{}{"other", "operator"}
+		}, ""),
+		Entry("another issuer", func(claims map[string]interface{}) {
+			claims["iss"] = "https://evil.example.com"
+		}, "issued by"),
+		Entry("no issuer", func(claims map[string]interface{}) {
+			delete(claims, "iss")
+		}, "issued by"),
+		Entry("another audience", func(claims map[string]interface{}) {
+			claims["aud"] = "other"
+		}, "not issued for this client"),
+		Entry("an audience list without the client", func(claims map[string]interface{}) {
+			claims["aud"] = []interface{}{"other"}
+		}, "not issued for this client"),
+		Entry("expired", func(claims map[string]interface{}) {
+			claims["exp"] = float64(time.Now().Add(-time.Minute).Unix())
+		}, "expired"),
+		Entry("no expiry", func(claims map[string]interface{}) {
+			delete(claims, "exp")
+		}, "expired"),
+		Entry("another nonce", func(claims map[string]interface{}) {
+			claims["nonce"] = "other"
+		}, "nonce"),
+		Entry("no nonce", func(claims map[string]interface{}) {
+			delete(claims, "nonce")
+		}, "nonce"),
+	)
+
+	It("rejects a token without a nonce when none is expected", func() {
+		p := &OIDCProvider{IssuerURL: issuer, ClientID: "operator"}
+		claims := validClaims()
+		delete(claims, "nonce")
+		Expect(p.verifyClaims(claims, "")).To(MatchError(ContainSubstring("nonce")))
+	})
+
+	DescribeTable("user",
+		func(p *OIDCProvider, claims map[string]interface{}, expected *User, expectedErr string) {
+			user, err := p.user(claims)
+			if expectedErr != "" {
+				Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user).To(Equal(expected))
+		},
+		Entry("the email by default",
+			&OIDCProvider{},
+			map[string]interface{}{"email": "alice@example.com", "email_verified": true, "groups": []interface{}{"admins", "ops"}},
+			&User{Name: "alice@example.com", Groups: []string{"admins", "ops"}}, ""),
+		Entry("an unverified email",
+			&OIDCProvider{},
+			map[string]interface{}{"email": "alice@example.com", "email_verified": false},
+			nil, "not verified"),
+		Entry("no username",
+			&OIDCProvider{},
+			map[string]interface{}{"sub": "1234"},
+			nil, "no email claim"),
+		Entry("other claims and prefixes",
+			&OIDCProvider{UsernameClaim: "sub", UsernamePrefix: "oidc:", GroupsClaim: "roles", GroupsPrefix: "oidc:"},
+			map[string]interface{}{"sub": "1234", "email_verified": false, "roles": []interface{}{"admins"}, "groups": []interface{}{"ignored"}},
+			&User{Name: "oidc:1234", Groups: []string{"oidc:admins"}}, ""),
+		Entry("a single group",
+			&OIDCProvider{},
+			map[string]interface{}{"email": "alice@example.com", "groups": "admins"},
+			&User{Name: "alice@example.com", Groups: []string{"admins"}}, ""),
+		Entry("groups which aren't strings",
+			&OIDCProvider{},
+			map[string]interface{}{"email": "alice@example.com", "groups": []interface{}{"admins", 42.0}},
+			&User{Name: "alice@example.com", Groups: []string{"admins"}}, ""),
+	)
+
+	Describe("oauth2Config", func() {
+		var (
+			srv       *httptest.Server
+			discovery map[string]string
+		)
+
+		BeforeEach(func() {
+			srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/.well-known/openid-configuration"))
+				Expect(json.NewEncoder(w).Encode(discovery)).To(Succeed())
+			}))
+			DeferCleanup(srv.Close)
+			discovery = map[string]string{
+				"issuer":                 srv.URL,
+				"authorization_endpoint": srv.URL + "/authorize",
+				"token_endpoint":         srv.URL + "/token",
+			}
+		})
+
+		It("discovers the endpoints", func() {
+			p := &OIDCProvider{IssuerURL: srv.URL, ClientID: "operator", HTTPClient: srv.Client()}
+			config, err := p.oauth2Config(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Endpoint.TokenURL).To(Equal(srv.URL + "/token"))
+			Expect(config.Scopes).To(Equal([]string{"openid"}))
+		})
+
+		It("rejects a plain HTTP issuer", func() {
+			p := &OIDCProvider{IssuerURL: "http://accounts.example.com", HTTPClient: srv.Client()}
+			_, err := p.oauth2Config(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("must be an https URL")))
+		})
+
+		It("rejects a plain HTTP token endpoint", func() {
+			discovery["token_endpoint"] = "http://accounts.example.com/token"
+			p := &OIDCProvider{IssuerURL: srv.URL, HTTPClient: srv.Client()}
+			_, err := p.oauth2Config(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("token endpoint")))
+		})
+
+		It("rejects a discovery document of another issuer", func() {
+			discovery["issuer"] = "https://evil.example.com"
+			p := &OIDCProvider{IssuerURL: srv.URL, HTTPClient: srv.Client()}
+			_, err := p.oauth2Config(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("does not match")))
+		})
+	})
+})
@@ -1,57 +1,347 @@
 package frontend
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
-	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	idleTimeout       = 2 * time.Minute
+	// handlerTimeout bounds every request but the event and log streams.
+	handlerTimeout = time.Minute
+	// shutdownTimeout is how long requests in flight are given to finish on shutdown.
+	shutdownTimeout = 10 * time.Second
+
+	// staticPrefix is the path the embedded static files are served under.
+	staticPrefix = "/static/"
 )
 
 type Server struct {
+	// Addr is the address to listen on, e.g. ":8067".
+	Addr string
+	// TLSSecret names a kubernetes.io/tls Secret to serve HTTPS with. A renewed certificate is
+	// picked up without a restart. Plain HTTP is served if the name is empty.
+	TLSSecret types.NamespacedName
+	// MaintenanceAddr is the address to serve the maintenance page on, e.g. ":8068". It is always
+	// plain HTTP, as the ingress controllers proxying to it terminate TLS. Disabled if empty.
+	MaintenanceAddr string
+
 	Client client.Client
+	// APIReader reads directly from the API server, for resources the manager does not cache
+	// (pods and events).
+	APIReader client.Reader
+	// Auth authenticates users. Every request is allowed if nil.
+	Auth *Auth
+	// Authorizer limits users to what their RBAC bindings allow. Every user may do anything if nil.
+	Authorizer *Authorizer
+
+	// Clientset reads pod logs. Logs can't be viewed if nil.
+	Clientset kubernetes.Interface
+
+	watcher *serverWatcher
+
+	certMu      sync.Mutex
+	cert        *tls.Certificate
+	certVersion string
 }
 
-func NewServer(c client.Client) *Server {
+// NewServer returns a Server reading from the client. If informers is not nil, pages are updated
+// live from the informers' events.
+func NewServer(c client.Client, apiReader client.Reader, informers cache.Informers) *Server {
 	if err := LoadTemplates(); err != nil {
 		panic(err)
 	}
-	return &Server{c}
+	s := &Server{Client: c, APIReader: apiReader}
+	if informers != nil {
+		s.watcher = &serverWatcher{
+			client:      c,
+			informers:   informers,
+			subscribers: map[chan *ServerUpdate]struct{}{},
+		}
+	}
+	return s
 }
 
-func (s *Server) ListenAndServe(addr string) error {
+// Start serves the frontend, and the maintenance page if MaintenanceAddr is set, until ctx is
+// done, then shuts them down gracefully. It implements manager.Runnable, so the frontend runs
+// alongside the controllers.
+func (s *Server) Start(ctx context.Context) error {
+	srv := s.newHTTPServer(ctx, s.Addr, s.Handler())
+	if s.TLSSecret.Name != "" {
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.getCertificate,
+		}
+	}
+	servers := []*http.Server{srv}
+	if s.MaintenanceAddr != "" {
+		servers = append(servers, s.newHTTPServer(ctx, s.MaintenanceAddr, s.MaintenanceHandler()))
+	}
+
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+		go func() {
+			log.FromContext(ctx).Info("Starting frontend.", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				errs <- err
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+// newHTTPServer returns an http.Server of the handler, whose requests end with ctx.
+func (s *Server) newHTTPServer(ctx context.Context, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		// No WriteTimeout, as /live and followed logs stream for as long as the page is open -
+		// other requests are limited by handlerTimeout
+		IdleTimeout:    idleTimeout,
+		MaxHeaderBytes: 1 << 20,
+		// Streams end with the manager, rather than holding up the shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica serves the frontend.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the handler of all the frontend's pages.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.index)
+	mux.HandleFunc("/servers", s.createServer)
+	mux.HandleFunc("/servers/", s.server)
+	mux.HandleFunc("/issuers", s.issuers)
+	mux.HandleFunc("/issuers/", s.issuer)
+	mux.HandleFunc("/api/v1/", s.api)
+	mux.HandleFunc("/live", s.live)
+	mux.Handle(staticPrefix, staticHandler())
+
+	var handler http.Handler = mux
+	if s.Auth != nil {
+		mux.HandleFunc("/login", s.login)
+		mux.HandleFunc("/login/oidc", s.loginOIDC)
+		mux.HandleFunc("/oauth2/callback", s.oauth2Callback)
+		mux.HandleFunc("/logout", s.logout)
+		handler = s.Auth.middleware(mux)
+	}
+	return recoverer(withTimeout(handler))
+}
+
+// MaintenanceHandler returns the handler of the maintenance page, which the Ingresses of
+// unavailable Comet Servers proxy to. Requests for any other host are not found.
+func (s *Server) MaintenanceHandler() http.Handler {
+	return recoverer(s.maintenance(withTimeout(http.NotFoundHandler())))
+}
+
+// withTimeout limits the time taken to serve a request, except for the streams of /live and pod
+// logs.
+func withTimeout(next http.Handler) http.Handler {
+	limited := http.TimeoutHandler(next, handlerTimeout, "Timeout")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/live" || (strings.HasPrefix(r.URL.Path, "/servers/") && strings.HasSuffix(r.URL.Path, "/logs")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
 
-	return http.ListenAndServe(addr, mux)
+// staticHandler serves the embedded stylesheets and scripts.
+func staticHandler() http.Handler {
+	files := http.FileServer(http.FS(staticFiles))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		files.ServeHTTP(w, r)
+	})
 }
 
 // --
 
 type PageData struct {
 	PageTitle string
+
+	// User is nil if authentication is disabled.
+	User *User
+	// CSRFToken must be posted with every form, as csrf_token.
+	CSRFToken string
+}
+
+func newPageData(r *http.Request, title string) *PageData {
+	data := &PageData{
+		PageTitle: title,
+		User:      UserFrom(r.Context()),
+	}
+	if sess := sessionFrom(r.Context()); sess != nil {
+		data.CSRFToken = sess.CSRFToken
+	}
+	return data
 }
 
 type IndexPageData struct {
 	*PageData
 
 	Servers []cometdv1alpha1.CometServer
+	// States summarise the servers, by "<namespace>/<name>".
+	States  map[string]string
+	Issuers []cometdv1alpha1.CometLicenseIssuer
+	Form    *CreateServerForm
+	// Live is set if the page can subscribe to updates at /live.
+	Live bool
 }
 
 func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	s.renderIndex(w, r, nil, http.StatusOK)
+}
+
+// renderIndex renders the overview page. If form is nil, the create form is filled with the
+// defaults from the CometOperatorConfig.
+func (s *Server) renderIndex(w http.ResponseWriter, r *http.Request, form *CreateServerForm, status int) {
 	list := &cometdv1alpha1.CometServerList{}
 	err := s.Client.List(r.Context(), list)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Internal Error"))
+		renderError(w, r, err)
+		return
+	}
+	issuers := &cometdv1alpha1.CometLicenseIssuerList{}
+	err = s.Client.List(r.Context(), issuers)
+	if err != nil {
+		renderError(w, r, err)
 		return
 	}
-	err = Render(w, "index", &IndexPageData{
-		PageData: &PageData{
-			PageTitle: "Overview",
-		},
-		Servers: list.Items,
+
+	// Only show the servers of namespaces the user can list, and offer only the issuers of
+	// namespaces the user can create servers in
+	acc := s.access(r)
+	var servers []cometdv1alpha1.CometServer
+	for _, cs := range list.Items {
+		allowed, err := acc.Can("list", "cometservers", cs.Namespace)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		if allowed {
+			servers = append(servers, cs)
+		}
+	}
+	deployments := &appsv1.DeploymentList{}
+	err = s.Client.List(r.Context(), deployments)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	byName := map[string]*appsv1.Deployment{}
+	for i := range deployments.Items {
+		byName[deployments.Items[i].Namespace+"/"+deployments.Items[i].Name] = &deployments.Items[i]
+	}
+	states := map[string]string{}
+	for i := range servers {
+		key := servers[i].Namespace + "/" + servers[i].Name
+		states[key] = serverState(&servers[i], byName[key])
+	}
+	var allowedIssuers []cometdv1alpha1.CometLicenseIssuer
+	for _, issuer := range issuers.Items {
+		allowed, err := acc.Can("create", "cometservers", issuer.Namespace)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		if allowed {
+			allowedIssuers = append(allowedIssuers, issuer)
+		}
+	}
+
+	if form == nil {
+		form, err = s.newCreateServerForm(r, allowedIssuers)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+	}
+	err = RenderStatus(w, status, "index", &IndexPageData{
+		PageData: newPageData(r, "Overview"),
+		Servers:  servers,
+		States:   states,
+		Issuers:  allowedIssuers,
+		Form:     form,
+		Live:     s.watcher != nil,
 	})
 	if err != nil {
-		panic(err)
+		renderError(w, r, err)
+	}
+}
+
+// newCreateServerForm returns an empty create form, filled with the CometServer defaults of the
+// CometOperatorConfig if one exists.
+func (s *Server) newCreateServerForm(r *http.Request, issuers []cometdv1alpha1.CometLicenseIssuer) (*CreateServerForm, error) {
+	form := &CreateServerForm{
+		Version:  cometdv1alpha1.LatestCometServerVersion,
+		Hostname: "example.com",
+	}
+	config := &cometdv1alpha1.CometOperatorConfig{}
+	err := s.Client.Get(r.Context(), types.NamespacedName{Name: cometdv1alpha1.CometOperatorConfigName}, config)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	defaults := config.Spec.CometServer
+	if defaults.Version != "" {
+		form.Version = defaults.Version
+	}
+	if defaults.IngressHost != "" {
+		form.Hostname = defaults.IngressHost
+	}
+	for _, issuer := range issuers {
+		if issuer.Name == defaults.Issuer {
+			form.Issuer = issuer.Namespace + "/" + issuer.Name
+			break
+		}
 	}
+	return form, nil
 }
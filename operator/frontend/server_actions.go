@@ -0,0 +1,173 @@
+package frontend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+)
+
+// restartedAtAnnotation is set on the CometServer to restart its pod. Like any other annotation of
+// the CometServer it is copied onto the pod template, so changing it rolls out a new pod.
+const restartedAtAnnotation = "cometd.cometbackup.com/restarted-at"
+
+// errServerChanged is shown when the CometServer was changed after the page was loaded.
+var errServerChanged = errors.New("the server was changed since this page was loaded - review the changes and try again")
+
+// serverAction handles the forms of the server page, posted to /servers/<namespace>/<name>/<action>.
+// Each form carries the resourceVersion the page was rendered from, so a change made in the
+// meantime is reported as a conflict rather than silently overwritten.
+func (s *Server) serverAction(w http.ResponseWriter, r *http.Request, cs *cometdv1alpha1.CometServer, action string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method Not Allowed"))
+		return
+	}
+	verb := "update"
+	if action == "delete" {
+		verb = "delete"
+	}
+	allowed, err := s.access(r).Can(verb, "cometservers", cs.Namespace)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return
+	}
+	resourceVersion := r.PostFormValue("resourceVersion")
+
+	switch action {
+	case "version":
+		version := strings.TrimSpace(r.PostFormValue("version"))
+		err = s.updateServer(r.Context(), cs, resourceVersion, func(cs *cometdv1alpha1.CometServer) error {
+			cs.Spec.Version = version
+			return nil
+		})
+	case "suspend", "resume":
+		err = s.updateServer(r.Context(), cs, resourceVersion, func(cs *cometdv1alpha1.CometServer) error {
+			cs.Spec.Suspend = action == "suspend"
+			return nil
+		})
+	case "restart":
+		err = s.updateServer(r.Context(), cs, resourceVersion, func(cs *cometdv1alpha1.CometServer) error {
+			if cs.Spec.Suspend {
+				return errors.New("the server is suspended - resume it instead")
+			}
+			if cs.Annotations == nil {
+				cs.Annotations = map[string]string{}
+			}
+			cs.Annotations[restartedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+			return nil
+		})
+	case "features":
+		var features cometdv1alpha1.CometLicenseFeatures
+		features, err = parseLicenseFeatures(r.PostFormValue("features"))
+		if err == nil {
+			err = s.updateServer(r.Context(), cs, resourceVersion, func(cs *cometdv1alpha1.CometServer) error {
+				cs.Spec.License.Features = features
+				return nil
+			})
+		}
+	case "deletion-protection":
+		enabled := r.PostFormValue("enabled") == "true"
+		err = s.updateServer(r.Context(), cs, resourceVersion, func(cs *cometdv1alpha1.CometServer) error {
+			cs.Spec.DeletionProtection = enabled
+			return nil
+		})
+	case "delete":
+		err = s.deleteServer(r.Context(), cs, resourceVersion, r.PostFormValue("confirm"))
+		if err == nil {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err == nil {
+		http.Redirect(w, r, serverPath(cs), http.StatusSeeOther)
+		return
+	}
+
+	// Show the error next to the form, with the server as it is now
+	status := http.StatusUnprocessableEntity
+	if apierrors.IsConflict(err) {
+		status = http.StatusConflict
+		err = errServerChanged
+	}
+	if err := s.Client.Get(r.Context(), client.ObjectKeyFromObject(cs), cs); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		renderError(w, r, err)
+		return
+	}
+	data, err2 := s.getServerPageData(r, cs)
+	if err2 != nil {
+		renderError(w, r, err2)
+		return
+	}
+	data.Errors = map[string]string{action: errorMessage(err)}
+	if err := RenderStatus(w, status, "server", data); err != nil {
+		renderError(w, r, err)
+	}
+}
+
+// updateServer applies mutate to the CometServer and updates it, provided it is still at
+// resourceVersion. The change is validated as the admission webhook would, so errors can be shown
+// even when the webhook is disabled.
+func (s *Server) updateServer(ctx context.Context, cs *cometdv1alpha1.CometServer, resourceVersion string, mutate func(*cometdv1alpha1.CometServer) error) error {
+	if resourceVersion == "" {
+		return errServerChanged
+	}
+	updated := cs.DeepCopy()
+	if err := mutate(updated); err != nil {
+		return err
+	}
+	if err := updated.ValidateUpdate(cs); err != nil {
+		return err
+	}
+	// The API server rejects the update with a conflict if the server has changed since
+	updated.ResourceVersion = resourceVersion
+	return s.Client.Update(ctx, updated)
+}
+
+// deleteServer deletes the CometServer once its name has been typed in to confirm. A server with
+// deletion protection is refused here, rather than left stuck terminating by the finalizer.
+func (s *Server) deleteServer(ctx context.Context, cs *cometdv1alpha1.CometServer, resourceVersion, confirm string) error {
+	if cs.Spec.DeletionProtection {
+		return errors.New("deletion protection is enabled - disable it before deleting the server")
+	}
+	if confirm != cs.Name {
+		return fmt.Errorf("type %q to confirm", cs.Name)
+	}
+	if resourceVersion == "" {
+		return errServerChanged
+	}
+	return s.Client.Delete(ctx, cs, client.Preconditions{UID: &cs.UID, ResourceVersion: &resourceVersion})
+}
+
+// errorMessage formats err for display, listing the causes of validation errors.
+func errorMessage(err error) string {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil && len(status.Status().Details.Causes) > 0 {
+		var causes []string
+		for _, cause := range status.Status().Details.Causes {
+			causes = append(causes, fmt.Sprintf("%s: %s", cause.Field, cause.Message))
+		}
+		return strings.Join(causes, "; ")
+	}
+	return err.Error()
+}
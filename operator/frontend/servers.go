@@ -0,0 +1,376 @@
+package frontend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	"github.com/cometbackup/comet-server-operator/comet"
+)
+
+// createServerFormFields maps CometServer fields to the inputs of the create form.
+var createServerFormFields = map[string]string{
+	"metadata.name":       "name",
+	"spec.version":        "version",
+	"spec.ingress.host":   "hostname",
+	"spec.license.issuer": "issuer",
+}
+
+// CreateServerForm is the "Create a new Comet Server" form of the overview page.
+type CreateServerForm struct {
+	Name     string
+	Version  string
+	Hostname string
+	// Issuer is the <namespace>/<name> of a CometLicenseIssuer. The CometServer is created in
+	// the issuer's namespace.
+	Issuer string
+
+	// Errors by input name, and Error for anything not tied to an input.
+	Errors map[string]string
+	Error  string
+}
+
+// CometServer builds the CometServer from the form. Returns nil if the form has errors.
+func (f *CreateServerForm) CometServer() *cometdv1alpha1.CometServer {
+	f.Errors = map[string]string{}
+	namespace, issuer, ok := strings.Cut(f.Issuer, "/")
+	if !ok || namespace == "" || issuer == "" {
+		f.Errors["issuer"] = "Choose a license issuer."
+		return nil
+	}
+	cs := &cometdv1alpha1.CometServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      f.Name,
+			Namespace: namespace,
+		},
+		Spec: cometdv1alpha1.CometServerSpec{
+			Version: f.Version,
+			License: cometdv1alpha1.CometServerLicense{Issuer: issuer},
+			Ingress: cometdv1alpha1.CometServerIngress{Host: f.Hostname},
+		},
+	}
+	if f.Name == "" {
+		f.Errors["name"] = "A name is required."
+		return nil
+	}
+	return cs
+}
+
+// SetError shows err on the inputs it relates to.
+func (f *CreateServerForm) SetError(err error) {
+	if f.Errors == nil {
+		f.Errors = map[string]string{}
+	}
+	if apierrors.IsAlreadyExists(err) {
+		f.Errors["name"] = "A Comet Server with this name already exists."
+		return
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil && len(status.Status().Details.Causes) > 0 {
+		var unmatched []string
+		for _, cause := range status.Status().Details.Causes {
+			if input, ok := createServerFormFields[cause.Field]; ok {
+				if _, set := f.Errors[input]; !set {
+					f.Errors[input] = cause.Message
+				}
+				continue
+			}
+			unmatched = append(unmatched, fmt.Sprintf("%s: %s", cause.Field, cause.Message))
+		}
+		f.Error = strings.Join(unmatched, "; ")
+		return
+	}
+	f.Error = err.Error()
+}
+
+// createServer handles the "Create a new Comet Server" form.
+func (s *Server) createServer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method Not Allowed"))
+		return
+	}
+	form := &CreateServerForm{
+		Name:     strings.TrimSpace(r.PostFormValue("name")),
+		Version:  strings.TrimSpace(r.PostFormValue("version")),
+		Hostname: strings.TrimSpace(r.PostFormValue("hostname")),
+		Issuer:   r.PostFormValue("issuer"),
+	}
+	status := http.StatusUnprocessableEntity
+	cs := form.CometServer()
+	if cs != nil {
+		allowed, err := s.access(r).Can("create", "cometservers", cs.Namespace)
+		if err == nil && !allowed {
+			err = fmt.Errorf("you are not allowed to create Comet Servers in %s", cs.Namespace)
+			status = http.StatusForbidden
+		}
+		if err == nil {
+			err = s.createCometServer(r.Context(), cs)
+		}
+		if err != nil {
+			form.SetError(err)
+			cs = nil
+		}
+	}
+	if cs == nil {
+		s.renderIndex(w, r, form, status)
+		return
+	}
+	http.Redirect(w, r, serverPath(cs), http.StatusSeeOther)
+}
+
+// createCometServer defaults and validates the CometServer as the admission webhooks would, so
+// errors are reported the same with the webhooks disabled, then creates it.
+func (s *Server) createCometServer(ctx context.Context, cs *cometdv1alpha1.CometServer) error {
+	if err := cometdv1alpha1.NewCometServerDefaulter(s.Client).Default(ctx, cs); err != nil {
+		return err
+	}
+	if err := cs.ValidateCreate(); err != nil {
+		return err
+	}
+	return s.Client.Create(ctx, cs)
+}
+
+// --
+
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups=core,resources=events,verbs=list
+
+// serverEventLimit is the number of recent Events shown on the server page.
+const serverEventLimit = 10
+
+// serverHealthTimeout bounds the Comet admin API call of the server page.
+const serverHealthTimeout = 5 * time.Second
+
+type ServerPageData struct {
+	*PageData
+
+	Server *cometdv1alpha1.CometServer
+	// Features is nil if the issuer does not exist.
+	Features cometdv1alpha1.CometLicenseFeatures
+	Pods     []corev1.Pod
+	PVC      *corev1.PersistentVolumeClaim
+	Ingress  *networkingv1.Ingress
+	Events   []corev1.Event
+	Health   *ServerHealth
+	Can      ServerPermissions
+	// State summarises the server, see serverState.
+	State string
+	// Live is set if the page can subscribe to updates at /live.
+	Live bool
+	// LogContainers are the containers whose logs can be viewed, by name. Nil if logs can't be
+	// viewed.
+	LogContainers map[string]string
+
+	// Errors of the action forms, by action.
+	Errors map[string]string
+}
+
+// ServerPermissions are what the user may do on the server page.
+type ServerPermissions struct {
+	Update     bool
+	Delete     bool
+	ListPods   bool
+	ListEvents bool
+	ViewLogs   bool
+}
+
+// ServerHealth is the Comet Server's own view of itself, from the admin API.
+type ServerHealth struct {
+	Version *comet.ServerMetaVersionInfo
+	Error   string
+}
+
+// server shows the CometServer at /servers/<namespace>/<name>, and handles its actions at
+// /servers/<namespace>/<name>/<action>.
+func (s *Server) server(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/servers/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, name := parts[0], parts[1]
+	allowed, err := s.access(r).Can("get", "cometservers", namespace)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return
+	}
+	cs := &cometdv1alpha1.CometServer{}
+	err = s.Client.Get(r.Context(), types.NamespacedName{Namespace: namespace, Name: name}, cs)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			http.NotFound(w, r)
+			return
+		}
+		renderError(w, r, err)
+		return
+	}
+	if len(parts) == 3 && parts[2] == "logs" {
+		s.serverLogs(w, r, cs)
+		return
+	}
+	if len(parts) == 3 {
+		s.serverAction(w, r, cs, parts[2])
+		return
+	}
+	data, err := s.getServerPageData(r, cs)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	err = Render(w, "server", data)
+	if err != nil {
+		renderError(w, r, err)
+	}
+}
+
+// getServerPageData collects the status of the resources owned by the CometServer. Resources which
+// do not exist (yet) are left nil.
+func (s *Server) getServerPageData(r *http.Request, cs *cometdv1alpha1.CometServer) (*ServerPageData, error) {
+	ctx := r.Context()
+	data := &ServerPageData{
+		PageData: newPageData(r, cs.Name),
+		Server:   cs,
+		Live:     s.watcher != nil,
+	}
+	acc := s.access(r)
+	for _, check := range []struct {
+		allowed  *bool
+		verb     string
+		resource string
+	}{
+		{&data.Can.Update, "update", "cometservers"},
+		{&data.Can.Delete, "delete", "cometservers"},
+		{&data.Can.ListPods, "list", "pods"},
+		{&data.Can.ListEvents, "list", "events"},
+		{&data.Can.ViewLogs, "get", "pods/log"},
+	} {
+		allowed, err := acc.Can(check.verb, check.resource, cs.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		*check.allowed = allowed
+	}
+
+	issuer := &cometdv1alpha1.CometLicenseIssuer{}
+	err := s.Client.Get(ctx, types.NamespacedName{Namespace: cs.Namespace, Name: cs.Spec.License.Issuer}, issuer)
+	if err == nil {
+		data.Features = cs.LicenseFeatures(issuer)
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if data.Can.ListPods {
+		pods := &corev1.PodList{}
+		err = s.APIReader.List(ctx, pods, client.InNamespace(cs.Namespace), client.MatchingLabels{"app": cs.Name})
+		if err != nil {
+			return nil, err
+		}
+		data.Pods = pods.Items
+	}
+
+	depl := &appsv1.Deployment{}
+	err = s.Client.Get(ctx, types.NamespacedName{Namespace: cs.Namespace, Name: cs.Name}, depl)
+	if err == nil {
+		data.State = serverState(cs, depl)
+	} else if apierrors.IsNotFound(err) {
+		data.State = serverState(cs, nil)
+	} else {
+		return nil, err
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err = s.Client.Get(ctx, types.NamespacedName{Namespace: cs.Namespace, Name: cs.Name + "-pvc"}, pvc)
+	if err == nil {
+		data.PVC = pvc
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	ingress := &networkingv1.Ingress{}
+	err = s.Client.Get(ctx, types.NamespacedName{Namespace: cs.Namespace, Name: cs.Name + "-ingress"}, ingress)
+	if err == nil {
+		data.Ingress = ingress
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if data.Can.ListEvents {
+		events := &corev1.EventList{}
+		err = s.APIReader.List(ctx, events, client.InNamespace(cs.Namespace), client.MatchingFields{"involvedObject.name": cs.Name})
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events.Items {
+			if event.InvolvedObject.Kind == "CometServer" {
+				data.Events = append(data.Events, event)
+			}
+		}
+		sort.Slice(data.Events, func(i, j int) bool {
+			return eventTime(&data.Events[i]).After(eventTime(&data.Events[j]))
+		})
+		if len(data.Events) > serverEventLimit {
+			data.Events = data.Events[:serverEventLimit]
+		}
+	}
+
+	if s.Clientset != nil && data.Can.ViewLogs {
+		data.LogContainers = logContainers(cs)
+	}
+
+	if !cs.Spec.Suspend {
+		data.Health = s.getServerHealth(ctx, cs)
+	}
+	return data, nil
+}
+
+// getServerHealth asks the Comet Server for its version and license.
+func (s *Server) getServerHealth(ctx context.Context, cs *cometdv1alpha1.CometServer) *ServerHealth {
+	ctx, cancel := context.WithTimeout(ctx, serverHealthTimeout)
+	defer cancel()
+
+	api, err := comet.ForServer(ctx, s.Client, cs)
+	if err != nil {
+		return &ServerHealth{Error: err.Error()}
+	}
+	version, err := api.Version(ctx)
+	if err != nil {
+		return &ServerHealth{Error: err.Error()}
+	}
+	return &ServerHealth{Version: version}
+}
+
+// eventTime is when the Event last happened.
+func eventTime(e *corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// serverPath is the path of the CometServer's page.
+func serverPath(cs *cometdv1alpha1.CometServer) string {
+	return fmt.Sprintf("/servers/%s/%s", cs.Namespace, cs.Name)
+}
@@ -0,0 +1,181 @@
+package frontend
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	sessionCookieName = "comet_session"
+	// sessionKeyName is the key of the session Secret holding the cookie encryption key.
+	sessionKeyName = "sessionKey"
+	// csrfFieldName is the form field, and csrfHeaderName the header, carrying the CSRF token.
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// Session is stored, encrypted, in the session cookie. Every browser gets a session, so forms are
+// protected against CSRF before login too.
+type Session struct {
+	// User is nil until logged in.
+	User      *User     `json:"user,omitempty"`
+	CSRFToken string    `json:"csrf"`
+	Expires   time.Time `json:"exp"`
+
+	// The OIDC login in progress, and where to return to after logging in.
+	OIDCState string `json:"oidcState,omitempty"`
+	OIDCNonce string `json:"oidcNonce,omitempty"`
+	Next      string `json:"next,omitempty"`
+}
+
+// ValidCSRFToken reports whether the request carries the session's CSRF token.
+func (sess *Session) ValidCSRFToken(r *http.Request) bool {
+	token := r.Header.Get(csrfHeaderName)
+	if token == "" {
+		token = r.PostFormValue(csrfFieldName)
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sess.CSRFToken)) == 1
+}
+
+// SessionStore keeps sessions in cookies encrypted with AES-GCM. The key is kept in a Secret, so
+// all replicas of the operator share it and sessions survive restarts.
+type SessionStore struct {
+	Client client.Client
+	// Secret holding the key, created with a random key if it doesn't exist.
+	Secret types.NamespacedName
+	MaxAge time.Duration
+
+	mu   sync.Mutex
+	aead cipher.AEAD
+}
+
+// New returns an anonymous session.
+func (s *SessionStore) New() *Session {
+	return &Session{
+		CSRFToken: randomString(32),
+		Expires:   time.Now().Add(s.MaxAge),
+	}
+}
+
+// Get returns the session of the request, or nil if it has none or it is invalid or expired.
+func (s *SessionStore) Get(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, nil
+	}
+	aead, err := s.cipher(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, nil
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(sessionCookieName))
+	if err != nil {
+		return nil, nil
+	}
+	sess := &Session{}
+	if err := json.Unmarshal(plaintext, sess); err != nil || time.Now().After(sess.Expires) {
+		return nil, nil
+	}
+	return sess, nil
+}
+
+// Save sets the session cookie.
+func (s *SessionStore) Save(w http.ResponseWriter, r *http.Request, sess *Session) error {
+	aead, err := s.cipher(r.Context())
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(sessionCookieName))),
+		Path:     "/",
+		Expires:  sess.Expires,
+		Secure:   isHTTPS(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// cipher loads the key from the Secret, creating the Secret on first use.
+func (s *SessionStore) cipher(ctx context.Context) (cipher.AEAD, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.aead != nil {
+		return s.aead, nil
+	}
+
+	secret := &corev1.Secret{}
+	err := s.Client.Get(ctx, s.Secret, secret)
+	if apierrors.IsNotFound(err) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.Secret.Name,
+				Namespace: s.Secret.Namespace,
+			},
+			Data: map[string][]byte{sessionKeyName: key},
+		}
+		err = s.Client.Create(ctx, secret)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session key: %w", err)
+	}
+	key := secret.Data[sessionKeyName]
+	if len(key) != 32 {
+		return nil, errors.New("session key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	s.aead, err = cipher.NewGCM(block)
+	return s.aead, err
+}
+
+// isHTTPS reports whether the request was made over HTTPS, either to the frontend itself or to the
+// Ingress in front of it. The cookie is only marked Secure then, so log in still works over plain
+// HTTP, where a browser would drop a Secure cookie.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// randomString returns n random bytes, base64 encoded.
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
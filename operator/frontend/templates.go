@@ -1,17 +1,46 @@
 package frontend
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
+	"html/template"
 	"io/fs"
 	"net/http"
-	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
 //go:embed templates/*
 var files embed.FS
 var templates map[string]*template.Template
 
+// staticFiles are served under /static/.
+//
+//go:embed static
+var staticFiles embed.FS
+
+// funcs are available to all templates.
+var funcs = template.FuncMap{
+	// unix formats a Unix timestamp, as returned by the Comet admin API.
+	"unix": func(sec int64) string {
+		return time.Unix(sec, 0).UTC().Format(time.RFC1123)
+	},
+	// ago formats the time since t, e.g. "5m ago".
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return duration.HumanDuration(time.Since(t)) + " ago"
+	},
+	"eventTime": eventTime,
+	"quantity": func(q resource.Quantity) string {
+		return q.String()
+	},
+}
+
 func LoadTemplates() error {
 	if templates == nil {
 		templates = make(map[string]*template.Template)
@@ -21,7 +50,7 @@ func LoadTemplates() error {
 		return err
 	}
 	for _, tmpl := range tmplFiles {
-		pt, err := template.ParseFS(files, "templates/"+tmpl.Name())
+		pt, err := template.New(tmpl.Name()).Funcs(funcs).ParseFS(files, "templates/"+tmpl.Name())
 		if err != nil {
 			return err
 		}
@@ -31,13 +60,22 @@ func LoadTemplates() error {
 }
 
 func Render(w http.ResponseWriter, name string, data any) error {
+	return RenderStatus(w, http.StatusOK, name, data)
+}
+
+func RenderStatus(w http.ResponseWriter, status int, name string, data any) error {
 	t, ok := templates[name+".html"]
 	if !ok {
 		return fmt.Errorf("template %s not found", name)
 	}
-	w.WriteHeader(http.StatusOK)
-	if err := t.Execute(w, data); err != nil {
+	// Render in full before writing anything, so a failure can still be answered with the
+	// error page
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
 		return fmt.Errorf("failed to execute template: %w", err)
 	}
-	return nil
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+	return err
 }
@@ -0,0 +1,30 @@
+package frontend
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getCertificate returns the certificate of the TLSSecret. The key pair is parsed again only when
+// the Secret changes.
+func (s *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	secret := &corev1.Secret{}
+	if err := s.Client.Get(hello.Context(), s.TLSSecret, secret); err != nil {
+		return nil, fmt.Errorf("failed to get TLS secret %s: %w", s.TLSSecret, err)
+	}
+
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+	if s.cert != nil && s.certVersion == secret.ResourceVersion {
+		return s.cert, nil
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS secret %s: %w", s.TLSSecret, err)
+	}
+	s.cert = &cert
+	s.certVersion = secret.ResourceVersion
+	return s.cert, nil
+}
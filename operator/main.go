@@ -19,19 +19,26 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	cometdv1alpha1 "github.com/cometbackup/comet-server-operator/api/v1alpha1"
+	cometdv1beta1 "github.com/cometbackup/comet-server-operator/api/v1beta1"
 	"github.com/cometbackup/comet-server-operator/controllers"
 	"github.com/cometbackup/comet-server-operator/frontend"
 	//+kubebuilder:scaffold:imports
@@ -44,8 +51,10 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	utilruntime.Must(cometdv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(cometdv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -53,11 +62,42 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var maintenanceBackend string
+	var frontendAddr string
+	var frontendTLSSecret string
+	var maintenanceAddr string
+	var frontendSessionSecret string
+	var frontendUsersSecret string
+	var oidc frontend.OIDCProvider
+	var oidcScopes string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&maintenanceBackend, "maintenance-backend", "",
+		"The host name of the frontend Service (e.g. operator-frontend.operator-system.svc.cluster.local). "+
+			"Ingresses are pointed at it to serve a maintenance page while a Comet Server is unavailable.")
+	flag.StringVar(&frontendAddr, "frontend-bind-address", ":8067", "The address the frontend binds to.")
+	flag.StringVar(&maintenanceAddr, "maintenance-bind-address", ":8068",
+		"The address the maintenance page binds to. Always plain HTTP, as Ingresses proxy to it after terminating TLS.")
+	flag.StringVar(&frontendTLSSecret, "frontend-tls-secret", "",
+		"A kubernetes.io/tls Secret, in the operator's namespace, to serve the frontend over HTTPS with. Plain HTTP if empty.")
+	flag.StringVar(&frontendSessionSecret, "frontend-session-secret", "operator-frontend-session",
+		"The Secret, in the operator's namespace, holding the key of the frontend session cookies. Created if it does not exist.")
+	flag.StringVar(&frontendUsersSecret, "frontend-users-secret", "",
+		"A Secret, in the operator's namespace, of frontend usernames and their passwords. Password log in is disabled if empty.")
+	flag.StringVar(&oidc.IssuerURL, "frontend-oidc-issuer-url", "",
+		"The https URL of the OpenID Connect issuer to log in to the frontend with. OIDC log in is disabled if empty. "+
+			"The client secret is read from the FRONTEND_OIDC_CLIENT_SECRET environment variable.")
+	flag.StringVar(&oidc.ClientID, "frontend-oidc-client-id", "", "The OpenID Connect client ID of the frontend.")
+	flag.StringVar(&oidc.RedirectURL, "frontend-oidc-redirect-url", "",
+		"The frontend's OpenID Connect callback URL, e.g. https://operator.example.com/oauth2/callback.")
+	flag.StringVar(&oidcScopes, "frontend-oidc-scopes", "email,profile", "Comma separated scopes requested in addition to openid.")
+	flag.StringVar(&oidc.UsernameClaim, "frontend-oidc-username-claim", "email", "The ID token claim used as the username.")
+	flag.StringVar(&oidc.UsernamePrefix, "frontend-oidc-username-prefix", "", "Prefixed to usernames, as with the API server's --oidc-username-prefix.")
+	flag.StringVar(&oidc.GroupsClaim, "frontend-oidc-groups-claim", "groups", "The ID token claim listing the user's groups.")
+	flag.StringVar(&oidc.GroupsPrefix, "frontend-oidc-groups-prefix", "", "Prefixed to groups, as with the API server's --oidc-groups-prefix.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -91,12 +131,70 @@ func main() {
 	}
 
 	if err = (&controllers.CometServerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("cometserver-controller"),
+		APIReader: mgr.GetAPIReader(),
+
+		MaintenanceBackend: maintenanceBackend,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CometServer")
 		os.Exit(1)
 	}
+	if err = (&controllers.CometStorageVaultReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("cometstoragevault-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CometStorageVault")
+		os.Exit(1)
+	}
+	if err = (&controllers.CometUserReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("cometuser-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CometUser")
+		os.Exit(1)
+	}
+	if err = (&controllers.CometServerBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("cometserverbackup-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CometServerBackup")
+		os.Exit(1)
+	}
+	if err = (&controllers.CometServerBackupScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("cometserverbackupschedule-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CometServerBackupSchedule")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&cometdv1alpha1.CometServer{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CometServer")
+			os.Exit(1)
+		}
+		if err = (&cometdv1alpha1.CometLicenseIssuer{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CometLicenseIssuer")
+			os.Exit(1)
+		}
+		// Objects stored as v1alpha1 are converted by the webhook, so can only be migrated with it
+		if err = mgr.Add(&controllers.StorageVersionMigrator{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+			Resources: []schema.GroupResource{
+				{Group: cometdv1beta1.GroupVersion.Group, Resource: "cometservers"},
+				{Group: cometdv1beta1.GroupVersion.Group, Resource: "cometlicenseissuers"},
+			},
+		}); err != nil {
+			setupLog.Error(err, "unable to create storage version migrator")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -108,13 +206,51 @@ func main() {
 		os.Exit(1)
 	}
 
-	go func() {
-		srv := frontend.NewServer(mgr.GetClient())
-		err := srv.ListenAndServe(":8067")
-		if err != nil {
-			setupLog.Error(err, "problem running frontend server")
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = "operator-system"
+	}
+	frontendAuth := &frontend.Auth{
+		Sessions: &frontend.SessionStore{
+			Client: mgr.GetClient(),
+			Secret: types.NamespacedName{Namespace: namespace, Name: frontendSessionSecret},
+			MaxAge: 12 * time.Hour,
+		},
+		Tokens: &frontend.TokenReviewAuthenticator{Client: mgr.GetClient()},
+	}
+	if frontendUsersSecret != "" {
+		frontendAuth.Password = &frontend.StaticUsers{
+			Client: mgr.GetClient(),
+			Secret: types.NamespacedName{Namespace: namespace, Name: frontendUsersSecret},
 		}
-	}()
+	}
+	if oidc.IssuerURL != "" {
+		oidc.ClientSecret = os.Getenv("FRONTEND_OIDC_CLIENT_SECRET")
+		oidc.Scopes = strings.Split(oidcScopes, ",")
+		frontendAuth.OIDC = &oidc
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	srv := frontend.NewServer(mgr.GetClient(), mgr.GetAPIReader(), mgr.GetCache())
+	srv.Addr = frontendAddr
+	if maintenanceBackend != "" {
+		srv.MaintenanceAddr = maintenanceAddr
+	}
+	if frontendTLSSecret != "" {
+		srv.TLSSecret = types.NamespacedName{Namespace: namespace, Name: frontendTLSSecret}
+	}
+	srv.Auth = frontendAuth
+	srv.Authorizer = &frontend.Authorizer{Client: mgr.GetClient()}
+	srv.Clientset = clientset
+	if err := mgr.Add(srv); err != nil {
+		setupLog.Error(err, "unable to set up frontend")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {